@@ -0,0 +1,336 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	nos "os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"stkey/internal/content"
+	"stkey/pkg/audit"
+	"stkey/pkg/conf"
+	"stkey/pkg/facts"
+	"stkey/pkg/logger"
+	"stkey/pkg/os"
+	"stkey/pkg/script"
+	"stkey/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	auditdConf = "/etc/audit/auditd.conf"
+	// auditRulesDir augenrules合并该目录下的规则文件生成audit.rules
+	auditRulesDir = "/etc/audit/rules.d"
+	// auditRulesFile ops管理的规则文件，每次执行init audit时整体覆盖
+	auditRulesFile = auditRulesDir + "/ops-exec.rules"
+	// auditRules 没有rules.d的系统(CentOS 6)将规则以受管块写入该文件
+	auditRules = "/etc/audit/audit.rules"
+)
+
+// auditOptions init audit的相关参数
+type auditOptions struct {
+	LogFile   string
+	Immutable bool
+}
+
+func addAuditFlags(cmd *cobra.Command) {
+	cmd.Flags().String("audit-log", audit.DefaultLog, "auditd日志文件，所在目录仅root可读写")
+	cmd.Flags().Bool("audit-immutable", false, "锁定audit规则，重启前无法修改或关闭审计")
+}
+
+func getAuditOptions(cmd *cobra.Command) *auditOptions {
+	opts := &auditOptions{}
+	opts.LogFile, _ = cmd.Flags().GetString("audit-log")
+	opts.Immutable, _ = cmd.Flags().GetBool("audit-immutable")
+	return opts
+}
+
+// 安装auditd并记录登录用户执行的所有命令(execve)，替代通过PROMPT_COMMAND写入的history日志
+func setupAudit(osInfo *os.Data, opts *auditOptions) {
+	logger.Sugar.Infoln("配置auditd记录登录用户执行的命令")
+	logDir, err := auditLogDir(opts.LogFile)
+	if err != nil {
+		logger.Sugar.Fatal(err)
+	}
+	if !utils.TryCommand("auditctl") {
+		pkg := "audit"
+		if osInfo.IsLikeDebian() {
+			pkg = "auditd"
+		}
+		if _, err := pkgInstall(osInfo, pkg).Stdout(); err != nil {
+			logger.Sugar.Fatalf("安装%s失败:%s", pkg, err)
+		}
+	}
+
+	// 日志目录仅root可访问，普通用户无法修改或删除审计日志
+	if err := makePrivateDir(logDir); err != nil {
+		logger.Sugar.Fatalf("设置审计日志目录%s失败:%s", logDir, err)
+	}
+	f, err := conf.LoadKeyValue(auditdConf, " = ")
+	if err != nil {
+		logger.Sugar.Fatalf("读取%s失败:%s", auditdConf, err)
+	}
+	f.Set("log_file", opts.LogFile)
+	f.Set("log_group", "root")
+	confChanged, err := f.Save()
+	if err != nil {
+		logger.Sugar.Fatalf("修改%s失败:%s", auditdConf, err)
+	}
+
+	if osInfo.IsCentOS6() {
+		_, _ = script.ExecAsRoot("chkconfig auditd on").Stdout()
+	} else {
+		_, _ = script.ExecAsRoot("systemctl enable auditd").Stdout()
+	}
+	// auditd拒绝systemctl restart，使用service重启
+	action := "start"
+	if confChanged {
+		action = "restart"
+	}
+	if _, err := script.CommandAsRoot("service", "auditd", action).Stdout(); err != nil {
+		reportWarning("启动auditd失败: %s", err)
+	}
+
+	loadAuditRules(opts)
+	removeShellConf("history")
+	removeLegacyHistory()
+	logger.Sugar.Infoln("auditd已记录登录用户执行的命令，使用ops audit search查询，旧的命令日志/var/log/.hist/command.log未删除")
+}
+
+// 返回审计日志所在目录。该目录会被设为仅root可访问，需为审计专用的目录(名称包含audit)，
+// 避免--audit-log /var/log/ops-audit.log将/var/log锁定导致rsyslog等服务无法写入
+func auditLogDir(logFile string) (string, error) {
+	if !filepath.IsAbs(logFile) {
+		return "", fmt.Errorf("--audit-log必须为绝对路径: %s", logFile)
+	}
+	dir := filepath.Dir(filepath.Clean(logFile))
+	if !strings.Contains(strings.ToLower(filepath.Base(dir)), "audit") {
+		return "", fmt.Errorf("--audit-log所在目录%s将被设为仅root可访问，请使用审计专用的目录，如%s",
+			dir, filepath.Dir(audit.DefaultLog))
+	}
+	return dir, nil
+}
+
+// 创建目录并设为仅root可读写
+func makePrivateDir(dir string) error {
+	path := script.Path(dir)
+	if err := nos.MkdirAll(path, 0700); err != nil {
+		return err
+	}
+	if err := nos.Chown(path, 0, 0); err != nil {
+		return err
+	}
+	return nos.Chmod(path, 0700)
+}
+
+// 写入并加载audit规则
+func loadAuditRules(opts *auditOptions) {
+	rules := audit.Rules(runtime.GOARCH, opts.Immutable)
+	var err error
+	if utils.PathExists(auditRulesDir) {
+		header := "## 由ops管理，执行ops init audit时覆盖，请勿修改\n"
+		if _, err = script.Echo(header + rules).WriteFile(auditRulesFile); err != nil {
+			logger.Sugar.Fatalf("写入%s失败:%s", auditRulesFile, err)
+		}
+		if utils.TryCommand("augenrules") {
+			_, err = script.CommandAsRoot("augenrules", "--load").Stdout()
+		} else {
+			_, err = script.CommandAsRoot("auditctl", "-R", auditRulesFile).Stdout()
+		}
+	} else {
+		setBlock(auditRules, "exec", rules)
+		_, err = script.CommandAsRoot("auditctl", "-R", auditRules).Stdout()
+	}
+	if err != nil {
+		reportWarning("加载audit规则失败，如已锁定(-e 2)需重启后生效: %s", err)
+	}
+}
+
+// 移除setShellConf写入的shell配置
+func removeShellConf(name string) {
+	path := filepath.Join(profileDir, "ops-"+name+".sh")
+	if utils.PathExists(path) {
+		if err := nos.Remove(script.Path(path)); err != nil {
+			reportWarning("删除%s失败: %s", path, err)
+		}
+	}
+	for _, rc := range globalBashrcs {
+		removeBlock(rc, name)
+	}
+}
+
+// legacyHistoryDir 旧版本PROMPT_COMMAND写入的命令日志目录，权限为777
+const legacyHistoryDir = "/var/log/.hist"
+
+// 移除旧版本写入全局bashrc的PROMPT_COMMAND命令记录，并收回其日志目录的777权限，日志保留
+func removeLegacyHistory() {
+	for _, rc := range globalBashrcs {
+		f, err := conf.Load(rc)
+		if err != nil || !f.RemoveText(content.LegacyHistoryLog) {
+			continue
+		}
+		if _, err := f.Save(); err != nil {
+			reportWarning("修改%s失败: %s", rc, err)
+		} else {
+			logger.Sugar.Infof("已从%s移除旧的PROMPT_COMMAND命令记录", rc)
+		}
+	}
+	if !utils.PathExists(legacyHistoryDir) {
+		return
+	}
+	_ = filepath.Walk(script.Path(legacyHistoryDir), func(path string, fi nos.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		mode := nos.FileMode(0600)
+		if fi.IsDir() {
+			mode = 0700
+		}
+		if err := nos.Chmod(path, mode); err != nil {
+			reportWarning("修改%s权限失败: %s", path, err)
+		}
+		return nil
+	})
+}
+
+// auditSearchOptions audit search的相关参数
+type auditSearchOptions struct {
+	Files []string
+	Since time.Time
+	Until time.Time
+	User  string
+	Grep  string
+}
+
+func addAuditSearchFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("file", nil, "auditd日志文件，默认为"+auditdConf+"中log_file指定的日志及其轮转的日志")
+	cmd.Flags().String("since", "", "起始时间，格式为\"2006-01-02 15:04:05\"、2006-01-02或时长(如24h)")
+	cmd.Flags().String("until", "", "截止时间，格式同--since")
+	cmd.Flags().StringP("user", "u", "", "只输出登录用户(LU)或执行用户(NU)为该用户的命令")
+	cmd.Flags().String("grep", "", "只输出包含该字符串的命令")
+}
+
+func getAuditSearchOptions(cmd *cobra.Command) (*auditSearchOptions, error) {
+	opts := &auditSearchOptions{}
+	opts.Files, _ = cmd.Flags().GetStringSlice("file")
+	opts.User, _ = cmd.Flags().GetString("user")
+	opts.Grep, _ = cmd.Flags().GetString("grep")
+	for flag, t := range map[string]*time.Time{"since": &opts.Since, "until": &opts.Until} {
+		s, _ := cmd.Flags().GetString(flag)
+		if s == "" {
+			continue
+		}
+		v, err := parseAuditTime(s)
+		if err != nil {
+			return nil, fmt.Errorf("--%s: %w", flag, err)
+		}
+		*t = v
+	}
+	return opts, nil
+}
+
+// 解析时间点或距今的时长
+func parseAuditTime(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{audit.TimeFormat, "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法解析时间%q", s)
+}
+
+// auditd.conf中log_file指定的日志文件，未配置时为auditd的默认值
+func auditLogFile() string {
+	if f, err := conf.LoadKeyValue(auditdConf, " = "); err == nil {
+		if v, ok := f.Get("log_file"); ok && v != "" {
+			return v
+		}
+	}
+	return audit.DefaultLog
+}
+
+// 默认的日志文件: audit.log及auditd轮转的audit.log.1..N，按从旧到新排序
+func defaultAuditLogs() []string {
+	log := script.Path(auditLogFile())
+	matches, _ := filepath.Glob(log + ".*")
+	var rotated []string
+	for _, m := range matches {
+		if _, err := strconv.Atoi(strings.TrimPrefix(m, log+".")); err == nil {
+			rotated = append(rotated, m)
+		}
+	}
+	sort.Slice(rotated, func(i, j int) bool {
+		a, _ := strconv.Atoi(strings.TrimPrefix(rotated[i], log+"."))
+		b, _ := strconv.Atoi(strings.TrimPrefix(rotated[j], log+"."))
+		return a > b
+	})
+	return append(rotated, log)
+}
+
+// 解析auditd日志，每行输出一条JSON格式的命令记录
+func searchAudit(opts *auditSearchOptions) {
+	files := opts.Files
+	if len(files) == 0 {
+		files = defaultAuditLogs()
+	}
+	hostname, _ := facts.Hostname()
+	p := audit.NewParser(hostname)
+	for _, file := range files {
+		f, err := nos.Open(file)
+		if err != nil {
+			logger.Sugar.Fatalf("读取%s失败，请使用root用户执行: %s", file, err)
+		}
+		err = p.Parse(f)
+		f.Close()
+		if err != nil {
+			logger.Sugar.Fatalf("解析%s失败: %s", file, err)
+		}
+	}
+	enc := json.NewEncoder(nos.Stdout)
+	enc.SetEscapeHTML(false)
+	for _, c := range p.Commands() {
+		if !opts.Since.IsZero() && c.At.Before(opts.Since) {
+			continue
+		}
+		if !opts.Until.IsZero() && c.At.After(opts.Until) {
+			continue
+		}
+		if opts.User != "" && c.LoginUser != opts.User && c.User != opts.User {
+			continue
+		}
+		if opts.Grep != "" && !strings.Contains(c.Cmd, opts.Grep) {
+			continue
+		}
+		_ = enc.Encode(c)
+	}
+}
+
+func buildAuditCmd() *cobra.Command {
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "查询auditd记录的登录用户执行的命令，配置见ops init audit",
+	}
+	searchCmd := &cobra.Command{
+		Use:   "search",
+		Short: "解析auditd日志，按行输出JSON格式的命令记录(字段TIME、HOSTNAME、LI、LU、NU、CMD)",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			opts, err := getAuditSearchOptions(cmd)
+			if err != nil {
+				logger.Sugar.Fatal(err)
+			}
+			searchAudit(opts)
+		},
+	}
+	addAuditSearchFlags(searchCmd)
+	auditCmd.AddCommand(searchCmd)
+	return auditCmd
+}
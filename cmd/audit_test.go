@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	nos "os"
+	"path/filepath"
+	"reflect"
+	"stkey/internal/content"
+	"stkey/pkg/script"
+	"testing"
+)
+
+func TestAuditLogDir(t *testing.T) {
+	tests := []struct {
+		log     string
+		want    string
+		wantErr bool
+	}{
+		{log: "/var/log/audit/audit.log", want: "/var/log/audit"},
+		{log: "/data/ops-audit/audit.log", want: "/data/ops-audit"},
+		{log: "/data/Audit//exec.log", want: "/data/Audit"},
+		{log: "/var/log/ops-audit.log", wantErr: true},
+		{log: "/var/log/audit/../audit.log", wantErr: true},
+		{log: "/audit.log", wantErr: true},
+		{log: "audit/audit.log", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := auditLogDir(tt.log)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("auditLogDir(%q) = %q, %v, want %q, error %v", tt.log, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRemoveLegacyHistory(t *testing.T) {
+	admin := "# System wide functions and aliases\nexport LANG=en_US.UTF-8\n"
+	h := newTestHost(t, withFiles(centos7Files, map[string]string{
+		"/etc/bashrc":                content.LegacyHistoryLog + content.TerminalConf + admin,
+		"/etc/bash.bashrc":           admin,
+		"/var/log/.hist/command.log": "{\"CMD\":\"ls\"}\n",
+	}), script.NewFake())
+	for _, p := range []string{"/var/log/.hist", "/var/log/.hist/command.log"} {
+		if err := nos.Chmod(filepath.Join(h.root, p), 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removeLegacyHistory()
+	if got, want := h.read(t, "/etc/bashrc"), content.TerminalConf+admin; got != want {
+		t.Errorf("/etc/bashrc =\n%s\nwant\n%s", got, want)
+	}
+	if got := h.read(t, "/etc/bash.bashrc"); got != admin {
+		t.Errorf("/etc/bash.bashrc changed:\n%s", got)
+	}
+	for p, want := range map[string]nos.FileMode{"/var/log/.hist": 0700, "/var/log/.hist/command.log": 0600} {
+		fi, err := nos.Stat(filepath.Join(h.root, p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != want {
+			t.Errorf("%s mode = %o, want %o", p, fi.Mode().Perm(), want)
+		}
+	}
+	if h.read(t, "/var/log/.hist/command.log") == "" {
+		t.Error("legacy command log removed")
+	}
+}
+
+func TestDefaultAuditLogs(t *testing.T) {
+	h := newTestHost(t, map[string]string{
+		"/etc/os-release":            "ID=centos\nVERSION_ID=7\n",
+		auditdConf:                   "log_file = /data/audit/exec.log\nlog_group = root\n",
+		"/data/audit/exec.log":       "",
+		"/data/audit/exec.log.1":     "",
+		"/data/audit/exec.log.2":     "",
+		"/data/audit/exec.log.10":    "",
+		"/data/audit/exec.log.1.bak": "",
+	}, script.NewFake())
+	want := []string{
+		filepath.Join(h.root, "/data/audit/exec.log.10"),
+		filepath.Join(h.root, "/data/audit/exec.log.2"),
+		filepath.Join(h.root, "/data/audit/exec.log.1"),
+		filepath.Join(h.root, "/data/audit/exec.log"),
+	}
+	if got := defaultAuditLogs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("defaultAuditLogs() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,410 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	nos "os"
+	"path/filepath"
+	"runtime"
+	"stkey/pkg/bundle"
+	"stkey/pkg/logger"
+	"stkey/pkg/manifest"
+	"stkey/pkg/os"
+	"stkey/pkg/script"
+	"stkey/utils"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	bundleRepoID      = "ops-bundle"
+	bundleYumRepoFile = "/etc/yum.repos.d/ops-bundle.repo"
+	bundleAptListFile = "/etc/apt/ops-bundle.list"
+)
+
+// offline 当前init使用的离线包，未使用时为nil
+var offline *offlineBundle
+
+// offlineBundle 解压后的离线包
+type offlineBundle struct {
+	Dir      string
+	Metadata *bundle.Metadata
+}
+
+// 包管理器只使用离线包本地仓库的参数
+func (b *offlineBundle) repoArgs(osInfo *os.Data) []string {
+	if b == nil {
+		return nil
+	}
+	if osInfo.IsLikeFedora() {
+		return []string{"--disablerepo=*", "--enablerepo=" + bundleRepoID}
+	}
+	return []string{"-o", "Dir::Etc::sourcelist=" + bundleAptListFile, "-o", "Dir::Etc::sourceparts=-"}
+}
+
+func (b *offlineBundle) manifestPath() string {
+	return filepath.Join(b.Dir, bundle.ToolsDir, bundle.ManifestFile)
+}
+
+// 离线包中的工具以SHA-256命名
+func (b *offlineBundle) toolURL(sum string) string {
+	return "file://" + filepath.Join(b.Dir, bundle.ToolsDir, strings.ToLower(sum))
+}
+
+func bundleTarget(osInfo *os.Data) bundle.Target {
+	return bundle.Target{ID: osInfo.ID, VersionID: osInfo.VersionID, Arch: runtime.GOARCH}
+}
+
+func majorVersion(v string) string {
+	return strings.SplitN(v, ".", 2)[0]
+}
+
+// 解压离线包并创建临时本地仓库
+func useBundle(osInfo *os.Data, file string) *offlineBundle {
+	logger.Sugar.Infof("使用离线包%s", file)
+	dir, err := nos.MkdirTemp("/var/tmp", "ops-bundle-")
+	if err != nil {
+		logger.Sugar.Fatal(err)
+	}
+	// apt以_apt用户读取本地仓库
+	_ = nos.Chmod(dir, 0755)
+	b := &offlineBundle{Dir: dir}
+	// Fatal退出时同样删除本地仓库及解压目录
+	logger.AtExit(b.cleanup)
+	if err := bundle.Unpack(file, dir); err != nil {
+		logger.Sugar.Fatalf("解压离线包失败:%s", err)
+	}
+	b.Metadata, err = bundle.ReadMetadata(dir)
+	if err != nil {
+		logger.Sugar.Fatalf("读取离线包信息失败:%s", err)
+	}
+	target, host := b.Metadata.Target, bundleTarget(osInfo)
+	if target.ID != host.ID || majorVersion(target.VersionID) != majorVersion(host.VersionID) || target.Arch != host.Arch {
+		logger.Sugar.Fatalf("离线包适用于%s，与当前系统%s不匹配", target, host)
+	}
+
+	packages := filepath.Join(dir, bundle.PackagesDir)
+	if osInfo.IsLikeFedora() {
+		// 软件包由构建主机的GPG密钥校验
+		keys, _ := filepath.Glob(filepath.Join(dir, bundle.KeysDir, "*"))
+		if len(keys) == 0 {
+			logger.Sugar.Fatal("离线包中没有GPG密钥，无法校验软件包")
+		}
+		gpgkeys := make([]string, 0, len(keys))
+		for _, key := range keys {
+			if _, err := script.CommandAsRoot("rpm", "--import", key).Stdout(); err != nil {
+				logger.Sugar.Fatalf("导入GPG密钥%s失败:%s", filepath.Base(key), err)
+			}
+			gpgkeys = append(gpgkeys, "file://"+key)
+		}
+		repo := fmt.Sprintf("[%s]\nname=ops offline bundle\nbaseurl=file://%s\nenabled=1\ngpgcheck=1\ngpgkey=%s\n",
+			bundleRepoID, packages, strings.Join(gpgkeys, " "))
+		if _, err := script.Echo(repo).WriteFile(bundleYumRepoFile); err != nil {
+			logger.Sugar.Fatal(err)
+		}
+		_, err = pkgCommand("yum", append(b.repoArgs(osInfo), "makecache")...).Stdout()
+	} else {
+		// InRelease由构建时生成的密钥签名
+		key := filepath.Join(dir, bundle.KeysDir, bundle.RepoKeyFile)
+		if _, err := nos.Stat(key); err != nil {
+			logger.Sugar.Fatalf("离线包中没有仓库签名密钥%s，请重新构建离线包", bundle.RepoKeyFile)
+		}
+		list := fmt.Sprintf("deb [signed-by=%s] file:%s ./\n", key, packages)
+		if _, err := script.Echo(list).WriteFile(bundleAptListFile); err != nil {
+			logger.Sugar.Fatal(err)
+		}
+		_, err = pkgCommand("apt-get", append(b.repoArgs(osInfo), "update")...).Stdout()
+	}
+	if err != nil {
+		logger.Sugar.Fatalf("创建离线包本地仓库失败:%s", err)
+	}
+	logger.Sugar.Infof("离线包本地仓库已创建: %s, 软件包: %v", packages, b.Metadata.Packages)
+	return b
+}
+
+// 删除本地仓库及解压目录
+func (b *offlineBundle) cleanup() {
+	if b == nil {
+		return
+	}
+	_ = nos.Remove(script.Path(bundleYumRepoFile))
+	_ = nos.Remove(script.Path(bundleAptListFile))
+	_ = nos.RemoveAll(b.Dir)
+}
+
+// 离线包需要包含的软件包
+func bundlePkgs(osInfo *os.Data) []string {
+	pkgs := append([]string{}, commonPkgs...)
+	if osInfo.IsLikeFedora() {
+		pkgs = append(pkgs, "yum-utils")
+	} else {
+		pkgs = append(pkgs, "apt-transport-https", "ca-certificates", "software-properties-common")
+	}
+	if osInfo.IsCentOS8() || osInfo.IsLikeDebian() {
+		pkgs = append(pkgs, "python2")
+	}
+	if !osInfo.IsCentOS6() {
+		pkgs = append(pkgs, dockerPkg(osInfo))
+	}
+	return pkgs
+}
+
+func buildBundleCmd() *cobra.Command {
+	bundleCmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "构建离线安装包，供ops init --bundle在无网络环境使用",
+	}
+
+	buildCmd := &cobra.Command{
+		Use:   "build",
+		Short: "在与目标系统相同发行版的联网主机上收集软件包、仓库、GPG密钥、docker及工具",
+		Args:  cobra.NoArgs,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			checkUserPermission()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			osInfo := checkGOOS()
+			target := bundleTarget(osInfo)
+			if want, _ := cmd.Flags().GetString("target"); want != "" && want != target.ID+"-"+majorVersion(target.VersionID) {
+				logger.Sugar.Fatalf("当前系统为%s，无法构建%s的离线包，请在目标发行版上执行", target, want)
+			}
+			out, _ := cmd.Flags().GetString("output")
+			if out == "" {
+				out = fmt.Sprintf("ops-bundle-%s-%s-%s.tar.gz", target.ID, target.VersionID, target.Arch)
+			}
+			withTools, _ := cmd.Flags().GetBool("tools")
+			buildBundle(osInfo, out, withTools, getToolsOptions(cmd))
+		},
+	}
+	buildCmd.Flags().StringP("output", "o", "", "输出文件，以.gz/.tgz结尾时使用gzip压缩")
+	buildCmd.Flags().String("target", "", "目标发行版，如centos-7、ubuntu-22，必须与当前系统一致")
+	buildCmd.Flags().Bool("tools", true, "是否包含工具清单中的工具")
+	addToolsFlags(buildCmd)
+	bundleCmd.AddCommand(buildCmd)
+
+	return bundleCmd
+}
+
+func buildBundle(osInfo *os.Data, out string, withTools bool, opts *toolsOptions) {
+	dir, err := nos.MkdirTemp("/var/tmp", "ops-bundle-build-")
+	if err != nil {
+		logger.Sugar.Fatal(err)
+	}
+	defer nos.RemoveAll(dir)
+	logger.AtExit(func() { _ = nos.RemoveAll(dir) })
+	for _, d := range []string{bundle.PackagesDir, bundle.ReposDir, bundle.KeysDir, bundle.ToolsDir} {
+		if err := nos.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			logger.Sugar.Fatal(err)
+		}
+	}
+
+	meta := &bundle.Metadata{Target: bundleTarget(osInfo), Created: time.Now().UTC(), Packages: bundlePkgs(osInfo)}
+	logger.Sugar.Infof("开始构建%s离线包，软件包: %v", meta.Target, meta.Packages)
+	addDockerRepo(osInfo)
+	packages := filepath.Join(dir, bundle.PackagesDir)
+	if osInfo.IsLikeFedora() {
+		collectRpms(osInfo, packages, meta.Packages)
+	} else {
+		collectDebs(packages, meta.Packages)
+		signDebRepo(packages, filepath.Join(dir, bundle.KeysDir, bundle.RepoKeyFile))
+	}
+
+	copyFiles(filepath.Join(dir, bundle.ReposDir), "/etc/yum.repos.d/*.repo", "/etc/apt/sources.list", "/etc/apt/sources.list.d/*")
+	copyFiles(filepath.Join(dir, bundle.KeysDir), "/etc/pki/rpm-gpg/*", "/etc/apt/trusted.gpg.d/*", "/etc/apt/keyrings/*")
+
+	if withTools {
+		meta.Tools = collectTools(osInfo, filepath.Join(dir, bundle.ToolsDir), opts)
+	}
+	if err := bundle.WriteMetadata(dir, meta); err != nil {
+		logger.Sugar.Fatal(err)
+	}
+	if err := bundle.Pack(dir, out); err != nil {
+		logger.Sugar.Fatalf("打包离线包失败:%s", err)
+	}
+	logger.Sugar.Infof("离线包构建完成: %s", out)
+}
+
+// 下载rpm及其依赖并生成repodata，依赖在空的installroot中解析，不会遗漏构建主机已安装的软件包
+func collectRpms(osInfo *os.Data, dir string, pkgs []string) {
+	var err error
+	if osInfo.IsCentOS8() {
+		_, _ = pkgExec("dnf install -y dnf-plugins-core createrepo").Stdout()
+		_, err = pkgCommand("dnf", append([]string{"download", "--resolve", "--alldeps", "--destdir", dir}, pkgs...)...).Stdout()
+	} else {
+		_, _ = pkgExec("yum install -y yum-utils createrepo").Stdout()
+		root := emptyRoot()
+		defer nos.RemoveAll(root)
+		// installroot中读取yum变量，如$contentdir
+		vars := filepath.Join(root, "etc/yum/vars")
+		if err := nos.MkdirAll(vars, 0755); err != nil {
+			logger.Sugar.Fatal(err)
+		}
+		copyFiles(vars, "/etc/yum/vars/*")
+		_, err = pkgCommand("yumdownloader", append([]string{"--resolve", "--installroot=" + root,
+			"--releasever=" + majorVersion(osInfo.VersionID), "--setopt=reposdir=/etc/yum.repos.d", "--destdir", dir}, pkgs...)...).Stdout()
+	}
+	if err != nil {
+		logger.Sugar.Fatalf("下载软件包失败:%s", err)
+	}
+	if osInfo.IsCentOS6() {
+		if err := utils.DownloadFile(filepath.Join(dir, filepath.Base(centos6DockerRPM)), centos6DockerRPM); err != nil {
+			logger.Sugar.Fatalf("下载docker失败:%s", err)
+		}
+	}
+	if _, err := script.Command("createrepo", dir).Stdout(); err != nil {
+		logger.Sugar.Fatalf("生成repodata失败:%s", err)
+	}
+}
+
+// 下载deb及其依赖并生成Packages索引，依赖按空的dpkg状态解析，不会遗漏构建主机已安装的软件包
+func collectDebs(dir string, pkgs []string) {
+	_, _ = pkgExec("apt-get install -y dpkg-dev").Stdout()
+	if err := nos.MkdirAll(filepath.Join(dir, "partial"), 0755); err != nil {
+		logger.Sugar.Fatal(err)
+	}
+	root := emptyRoot()
+	defer nos.RemoveAll(root)
+	status := filepath.Join(root, "status")
+	if err := nos.WriteFile(status, nil, 0644); err != nil {
+		logger.Sugar.Fatal(err)
+	}
+	_, err := pkgCommand("apt-get", append([]string{"install", "-y", "--download-only",
+		"-o", "Dir::State::status=" + status, "-o", "Dir::Cache::archives=" + dir}, pkgs...)...).Stdout()
+	if err != nil {
+		logger.Sugar.Fatalf("下载软件包失败:%s", err)
+	}
+	_ = nos.RemoveAll(filepath.Join(dir, "partial"))
+	_ = nos.Remove(filepath.Join(dir, "lock"))
+	res, err := script.NewPipe().WithDir(dir).RunCommand("dpkg-scanpackages", "-m", ".", "/dev/null")
+	if err != nil {
+		logger.Sugar.Fatalf("生成Packages失败:%s", err)
+	}
+	if err := writePackagesIndex(dir, []byte(res.Stdout)); err != nil {
+		logger.Sugar.Fatalf("生成Packages失败:%s", err)
+	}
+}
+
+// 创建解析依赖用的空目录，Fatal退出时同样删除
+func emptyRoot() string {
+	root, err := nos.MkdirTemp("/var/tmp", "ops-bundle-root-")
+	if err != nil {
+		logger.Sugar.Fatal(err)
+	}
+	logger.AtExit(func() { _ = nos.RemoveAll(root) })
+	return root
+}
+
+// 写入Packages及gzip压缩的Packages.gz
+func writePackagesIndex(dir string, index []byte) error {
+	if err := nos.WriteFile(filepath.Join(dir, "Packages"), index, 0644); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := gz.Write(index); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return nos.WriteFile(filepath.Join(dir, "Packages.gz"), buf.Bytes(), 0644)
+}
+
+// 以临时生成的密钥签名本地仓库的InRelease，并导出公钥供signed-by使用
+func signDebRepo(dir, key string) {
+	_, _ = pkgExec("apt-get install -y gnupg").Stdout()
+	home := emptyRoot()
+	defer nos.RemoveAll(home)
+	gpg := []string{"--batch", "--homedir", home, "--pinentry-mode", "loopback", "--passphrase", ""}
+	if _, err := script.NewPipe().RunCommand("gpg", append(gpg, "--quick-gen-key", "ops offline bundle", "rsa3072", "sign", "never")...); err != nil {
+		logger.Sugar.Fatalf("生成仓库签名密钥失败:%s", err)
+	}
+	if err := writeRelease(dir, time.Now()); err != nil {
+		logger.Sugar.Fatalf("生成Release失败:%s", err)
+	}
+	if _, err := script.NewPipe().WithDir(dir).RunCommand("gpg", append(gpg, "--clearsign", "-o", "InRelease", "Release")...); err != nil {
+		logger.Sugar.Fatalf("签名InRelease失败:%s", err)
+	}
+	if _, err := script.NewPipe().RunCommand("gpg", append(gpg, "--export", "-o", key)...); err != nil {
+		logger.Sugar.Fatalf("导出仓库签名密钥失败:%s", err)
+	}
+}
+
+// 写入列出Packages及Packages.gz校验和的Release
+func writeRelease(dir string, date time.Time) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Origin: ops\nLabel: ops offline bundle\nDate: %s\nSHA256:\n", date.UTC().Format(time.RFC1123))
+	for _, name := range []string{"Packages", "Packages.gz"} {
+		data, err := nos.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, " %x %d %s\n", sha256.Sum256(data), len(data), name)
+	}
+	return nos.WriteFile(filepath.Join(dir, "Release"), []byte(b.String()), 0644)
+}
+
+// 下载工具清单及适用于当前系统的工具，工具以SHA-256命名
+func collectTools(osInfo *os.Data, dir string, opts *toolsOptions) []string {
+	data, sig, m, err := fetchManifest(opts)
+	if err != nil {
+		logger.Sugar.Fatalf("工具清单校验失败:%s", err)
+	}
+	if err := nos.WriteFile(filepath.Join(dir, bundle.ManifestFile), data, 0644); err != nil {
+		logger.Sugar.Fatal(err)
+	}
+	if err := nos.WriteFile(filepath.Join(dir, bundle.ManifestFile+".sig"), sig, 0644); err != nil {
+		logger.Sugar.Fatal(err)
+	}
+	d := newToolsDownloader(opts)
+	platform := hostPlatform(osInfo)
+	var tools []string
+	for _, tool := range m.Tools {
+		artifact := tool.Select(platform)
+		if artifact == nil {
+			logger.Sugar.Infof("%s没有适用于%s的版本，跳过", tool.Name, platform)
+			continue
+		}
+		if err := d.Download(filepath.Join(dir, strings.ToLower(artifact.SHA256)), artifact.URL, artifact.SHA256); err != nil {
+			logger.Sugar.Fatalf("下载%s失败:%s", tool.Name, err)
+		}
+		tools = append(tools, tool.Name)
+	}
+	return tools
+}
+
+func hostPlatform(osInfo *os.Data) manifest.Platform {
+	return manifest.Platform{
+		Arch:      runtime.GOARCH,
+		ID:        osInfo.ID,
+		IDLike:    osInfo.IDLike,
+		VersionID: osInfo.VersionID,
+	}
+}
+
+// 复制匹配patterns的文件到dir
+func copyFiles(dir string, patterns ...string) {
+	for _, pattern := range patterns {
+		files, _ := filepath.Glob(pattern)
+		for _, f := range files {
+			if fi, err := nos.Stat(f); err != nil || !fi.Mode().IsRegular() {
+				continue
+			}
+			data, err := nos.ReadFile(f)
+			if err != nil {
+				logger.Sugar.Errorln(err)
+				continue
+			}
+			if err := nos.WriteFile(filepath.Join(dir, filepath.Base(f)), data, 0644); err != nil {
+				logger.Sugar.Errorln(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	nos "os"
+	"path/filepath"
+	"regexp"
+	"stkey/pkg/bundle"
+	"stkey/pkg/script"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+func TestCollectDebsIndex(t *testing.T) {
+	index := "Package: jq\nVersion: 1.6-2.1ubuntu3\nFilename: ./jq_1.6-2.1ubuntu3_amd64.deb\n\n"
+	fake := script.NewFake().
+		On(`^apt-get `, "", 0).
+		On(`^dpkg-scanpackages -m \. /dev/null$`, index, 0)
+	h := newTestHost(t, ubuntu22Files, fake)
+	dir := t.TempDir()
+	collectDebs(dir, []string{"jq"})
+
+	b, err := nos.ReadFile(filepath.Join(dir, "Packages"))
+	if err != nil || string(b) != index {
+		t.Errorf("Packages = %q, %v, want %q", b, err, index)
+	}
+	f, err := nos.Open(filepath.Join(dir, "Packages.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := io.ReadAll(gz); err != nil || !bytes.Equal(b, []byte(index)) {
+		t.Errorf("Packages.gz = %q, %v, want %q", b, err, index)
+	}
+	var scanned bool
+	for _, c := range h.rec.Calls() {
+		if c.Argv[0] != "dpkg-scanpackages" {
+			continue
+		}
+		scanned = true
+		if c.Dir != dir {
+			t.Errorf("dpkg-scanpackages run in %q, want %q", c.Dir, dir)
+		}
+	}
+	if !scanned {
+		t.Errorf("dpkg-scanpackages not run, commands: %q", h.commands())
+	}
+	want := regexp.MustCompile(`^apt-get install -y --download-only -o Dir::State::status=\S+/status -o Dir::Cache::archives=` + regexp.QuoteMeta(dir) + ` jq$`)
+	if !matchAny(want, h.rec.Calls()) {
+		t.Errorf("apt-get did not resolve against an empty status, commands: %q", h.commands())
+	}
+}
+
+// matchAny 是否有命令的参数以空格连接后匹配re
+func matchAny(re *regexp.Regexp, calls []script.Call) bool {
+	for _, c := range calls {
+		if re.MatchString(strings.Join(c.Argv, " ")) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCollectRpms(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{name: "centos7", files: centos7Files,
+			want: `^yumdownloader --resolve --installroot=\S+ --releasever=7 --setopt=reposdir=/etc/yum.repos.d --destdir DIR jq$`},
+		{name: "centos8", files: centos8Files, want: `^dnf download --resolve --alldeps --destdir DIR jq$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := script.NewFake().On(`^(yum|dnf|yumdownloader|createrepo) `, "", 0)
+			h := newTestHost(t, tt.files, fake)
+			dir := t.TempDir()
+			collectRpms(h.info, dir, []string{"jq"})
+			want := regexp.MustCompile(strings.Replace(tt.want, "DIR", regexp.QuoteMeta(dir), 1))
+			if !matchAny(want, h.rec.Calls()) {
+				t.Errorf("no command matches %s, commands: %q", want, h.commands())
+			}
+		})
+	}
+}
+
+func TestWriteRelease(t *testing.T) {
+	dir := t.TempDir()
+	if err := writePackagesIndex(dir, []byte("Package: jq\n\n")); err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2023, 10, 12, 8, 0, 0, 0, time.UTC)
+	if err := writeRelease(dir, date); err != nil {
+		t.Fatal(err)
+	}
+	release, err := nos.ReadFile(filepath.Join(dir, "Release"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(release), "Date: Thu, 12 Oct 2023 08:00:00 UTC\nSHA256:\n") {
+		t.Errorf("Release without date and SHA256 field:\n%s", release)
+	}
+	for _, name := range []string{"Packages", "Packages.gz"} {
+		data, err := nos.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		line := fmt.Sprintf(" %x %d %s\n", sha256.Sum256(data), len(data), name)
+		if !strings.Contains(string(release), line) {
+			t.Errorf("Release does not contain %q:\n%s", line, release)
+		}
+	}
+}
+
+// packBundle 打包只含bundle.json及GPG密钥的离线包
+func packBundle(t *testing.T, h *testHost, keys ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, d := range []string{bundle.PackagesDir, bundle.KeysDir} {
+		if err := nos.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, key := range keys {
+		if err := nos.WriteFile(filepath.Join(dir, bundle.KeysDir, key), []byte("key"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bundle.WriteMetadata(dir, &bundle.Metadata{Target: bundleTarget(h.info)}); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	if err := bundle.Pack(dir, out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestUseBundle(t *testing.T) {
+	t.Run("yum", func(t *testing.T) {
+		h := newTestHost(t, centos7Files, script.NewFake().On(`^(rpm|yum) `, "", 0))
+		b := useBundle(h.info, packBundle(t, h, "RPM-GPG-KEY-CentOS-7", "RPM-GPG-KEY-EPEL-7"))
+		defer nos.RemoveAll(b.Dir)
+		keys := filepath.Join(b.Dir, bundle.KeysDir)
+		repo := h.read(t, bundleYumRepoFile)
+		want := fmt.Sprintf("gpgcheck=1\ngpgkey=file://%s/RPM-GPG-KEY-CentOS-7 file://%s/RPM-GPG-KEY-EPEL-7\n", keys, keys)
+		if !strings.HasSuffix(repo, want) {
+			t.Errorf("%s =\n%s\nwant it to end with\n%s", bundleYumRepoFile, repo, want)
+		}
+		for _, key := range []string{"RPM-GPG-KEY-CentOS-7", "RPM-GPG-KEY-EPEL-7"} {
+			if !slices.Contains(h.commands(), "rpm --import "+filepath.Join(keys, key)) {
+				t.Errorf("%s not imported, commands: %q", key, h.commands())
+			}
+		}
+	})
+	t.Run("apt", func(t *testing.T) {
+		h := newTestHost(t, ubuntu22Files, script.NewFake().On(`^apt-get `, "", 0))
+		b := useBundle(h.info, packBundle(t, h, bundle.RepoKeyFile))
+		defer nos.RemoveAll(b.Dir)
+		want := fmt.Sprintf("deb [signed-by=%s] file:%s ./\n", filepath.Join(b.Dir, bundle.KeysDir, bundle.RepoKeyFile),
+			filepath.Join(b.Dir, bundle.PackagesDir))
+		if got := h.read(t, bundleAptListFile); got != want {
+			t.Errorf("%s = %q, want %q", bundleAptListFile, got, want)
+		}
+	})
+}
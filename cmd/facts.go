@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	nos "os"
+	"stkey/pkg/facts"
+	"stkey/pkg/logger"
+	"stkey/pkg/yaml"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// 未指定--endpoint/--token时读取的环境变量
+	factsEndpointEnv = "OPS_FACTS_ENDPOINT"
+	factsTokenEnv    = "OPS_FACTS_TOKEN"
+)
+
+type factsOptions struct {
+	Endpoint string
+	Token    string
+	State    string
+	Force    bool
+	Timeout  time.Duration
+}
+
+func addFactsPushFlags(cmd *cobra.Command) {
+	cmd.Flags().String("endpoint", nos.Getenv(factsEndpointEnv), "接收facts的HTTP地址，默认读取环境变量"+factsEndpointEnv)
+	cmd.Flags().String("token", "", "Bearer token，默认读取环境变量"+factsTokenEnv)
+	cmd.Flags().String("state", facts.DefaultStatePath, "记录上次推送结果的文件，为空则每次都推送")
+	cmd.Flags().Bool("force", false, "facts未变化时也推送")
+	cmd.Flags().Duration("timeout", 30*time.Second, "推送超时时间")
+}
+
+func getFactsPushOptions(cmd *cobra.Command) *factsOptions {
+	opts := &factsOptions{}
+	opts.Endpoint, _ = cmd.Flags().GetString("endpoint")
+	opts.Token, _ = cmd.Flags().GetString("token")
+	if opts.Token == "" {
+		opts.Token = nos.Getenv(factsTokenEnv)
+	}
+	opts.State, _ = cmd.Flags().GetString("state")
+	opts.Force, _ = cmd.Flags().GetBool("force")
+	opts.Timeout, _ = cmd.Flags().GetDuration("timeout")
+	return opts
+}
+
+func gatherFacts() *facts.Facts {
+	f, err := facts.Gather(checkGOOS())
+	if err != nil {
+		logger.Sugar.Fatal("收集facts失败:", err)
+	}
+	return f
+}
+
+// 推送facts，与上次推送相同则跳过
+func pushFacts(opts *factsOptions) {
+	if opts.Endpoint == "" {
+		logger.Sugar.Fatalf("未指定--endpoint或环境变量%s", factsEndpointEnv)
+	}
+	f := gatherFacts()
+	p := facts.NewPusher(opts.Endpoint)
+	p.Token = opts.Token
+	p.StatePath = opts.State
+	p.Client.Timeout = opts.Timeout
+	pushed, err := p.Push(f, opts.Force)
+	if errors.Is(err, facts.ErrStateNotSaved) {
+		// 已推送，下次运行时会重新推送
+		logger.Sugar.Warn(err)
+	} else if err != nil {
+		logger.Sugar.Fatal(err)
+	}
+	if !pushed {
+		logger.Sugar.Infof("facts未变化，跳过推送(fingerprint %s)", f.Fingerprint())
+		return
+	}
+	logger.Sugar.Infof("facts已推送至%s(fingerprint %s)", opts.Endpoint, f.Fingerprint())
+}
+
+func buildFactsCmd() *cobra.Command {
+	factsCmd := &cobra.Command{
+		Use:   "facts",
+		Short: "输出主机facts: 主机名、IP、序列号、machine-id、运行时间及系统信息",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			output, _ := cmd.Flags().GetString("output")
+			f := gatherFacts()
+			switch output {
+			case "json":
+				b, _ := json.MarshalIndent(f, "", "  ")
+				fmt.Println(string(b))
+			case "yaml":
+				b, err := yaml.Marshal(f)
+				if err != nil {
+					logger.Sugar.Fatal(err)
+				}
+				fmt.Print(string(b))
+			default:
+				logger.Sugar.Fatalf("不支持的输出格式%s，可选json|yaml", output)
+			}
+		},
+	}
+	factsCmd.Flags().StringP("output", "o", "json", "输出格式: json|yaml")
+
+	pushCmd := &cobra.Command{
+		Use:   "push",
+		Short: "以JSON POST推送facts至HTTP地址，仅在facts变化时推送",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			pushFacts(getFactsPushOptions(cmd))
+		},
+	}
+	addFactsPushFlags(pushCmd)
+	factsCmd.AddCommand(pushCmd)
+	return factsCmd
+}
@@ -0,0 +1,412 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	nos "os"
+	"regexp"
+	"stkey/pkg/logger"
+	"stkey/pkg/network"
+	"stkey/pkg/os"
+	"stkey/pkg/script"
+	"stkey/pkg/yaml"
+	"stkey/utils"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/spf13/cobra"
+)
+
+// hostInventory ops info输出的主机清单，字段名即JSON/YAML的键，供CMDB采集
+type hostInventory struct {
+	Hostname       string          `json:"hostname"`
+	OS             inventoryOS     `json:"os"`
+	Kernel         string          `json:"kernel"`
+	Arch           string          `json:"arch"`
+	Virtualization string          `json:"virtualization"`
+	Cloud          string          `json:"cloud,omitempty"`
+	Container      string          `json:"container,omitempty"`
+	CPU            inventoryCPU    `json:"cpu"`
+	Memory         inventoryMemory `json:"memory"`
+	Disks          []inventoryDisk `json:"disks"`
+	// DefaultInterface 默认路由所在网卡
+	DefaultInterface string            `json:"default_interface,omitempty"`
+	Interfaces       []inventoryNIC    `json:"interfaces"`
+	Software         inventorySoftware `json:"software"`
+	Security         inventorySecurity `json:"security"`
+	Limits           inventoryLimits   `json:"limits"`
+	// Warnings 采集失败的项，同时输出到标准错误，标准输出只有清单本身
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+func (inv *hostInventory) warnf(format string, args ...interface{}) {
+	inv.Warnings = append(inv.Warnings, fmt.Sprintf(format, args...))
+}
+
+type inventoryOS struct {
+	ID         string `json:"id"`
+	IDLike     string `json:"id_like,omitempty"`
+	Name       string `json:"name"`
+	PrettyName string `json:"pretty_name"`
+	Version    string `json:"version"`
+	Codename   string `json:"codename,omitempty"`
+	EOL        bool   `json:"eol"`
+}
+
+type inventoryCPU struct {
+	Model   string `json:"model"`
+	Sockets int    `json:"sockets"`
+	Cores   int    `json:"cores"`
+	Threads int    `json:"threads"`
+}
+
+// inventoryMemory 单位为字节
+type inventoryMemory struct {
+	Total     uint64 `json:"total"`
+	Available uint64 `json:"available"`
+	SwapTotal uint64 `json:"swap_total"`
+}
+
+type inventoryDisk struct {
+	Device      string  `json:"device"`
+	Mountpoint  string  `json:"mountpoint"`
+	Fstype      string  `json:"fstype"`
+	Total       uint64  `json:"total"`
+	Used        uint64  `json:"used"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+type inventoryNIC struct {
+	Name      string   `json:"name"`
+	Kind      string   `json:"kind"`
+	MAC       string   `json:"mac,omitempty"`
+	MTU       int      `json:"mtu"`
+	Speed     int      `json:"speed"`
+	OperState string   `json:"oper_state,omitempty"`
+	Up        bool     `json:"up"`
+	Addrs     []string `json:"addrs"`
+}
+
+// inventorySoftware 未安装时版本为空
+type inventorySoftware struct {
+	Docker string `json:"docker"`
+	Chrony string `json:"chrony"`
+}
+
+type inventorySecurity struct {
+	// SELinux 当前模式: enforcing|permissive|disabled，未安装为空
+	SELinux string `json:"selinux"`
+	// SELinuxConfig /etc/selinux/config中配置的开机模式
+	SELinuxConfig string `json:"selinux_config,omitempty"`
+	// Firewalld active|inactive|not-installed
+	Firewalld        string `json:"firewalld"`
+	FirewalldEnabled bool   `json:"firewalld_enabled"`
+}
+
+// inventoryLimits 当前登录会话的资源限制及内核全局限制，unlimited为-1
+type inventoryLimits struct {
+	NofileSoft int64 `json:"nofile_soft"`
+	NofileHard int64 `json:"nofile_hard"`
+	NprocSoft  int64 `json:"nproc_soft"`
+	NprocHard  int64 `json:"nproc_hard"`
+	FileMax    int64 `json:"file_max"`
+	NrOpen     int64 `json:"nr_open"`
+}
+
+var versionRegexp = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// 收集主机清单，单项失败不影响其他项
+func collectInventory(osInfo *os.Data) *hostInventory {
+	inv := &hostInventory{
+		Hostname: osInfo.HostName,
+		OS: inventoryOS{
+			ID:         osInfo.ID,
+			IDLike:     osInfo.IDLike,
+			Name:       osInfo.Name,
+			PrettyName: osInfo.PrettyName,
+			Version:    osInfo.VersionID,
+			Codename:   osInfo.Codename,
+			EOL:        osInfo.EOL() != nil,
+		},
+		Kernel:         osInfo.Kernel,
+		Arch:           osInfo.Arch,
+		Virtualization: osInfo.Virtualization,
+		Cloud:          osInfo.Cloud,
+		Container:      osInfo.Container,
+		Disks:          []inventoryDisk{},
+		Interfaces:     []inventoryNIC{},
+	}
+
+	if infos, err := cpu.Info(); err == nil && len(infos) > 0 {
+		inv.CPU.Model = infos[0].ModelName
+		sockets := map[string]bool{}
+		for _, i := range infos {
+			sockets[i.PhysicalID] = true
+		}
+		inv.CPU.Sockets = len(sockets)
+	} else if err != nil {
+		inv.warnf("获取CPU信息失败: %v", err)
+	}
+	inv.CPU.Cores, _ = cpu.Counts(false)
+	inv.CPU.Threads, _ = cpu.Counts(true)
+
+	if vm, err := mem.VirtualMemory(); err == nil {
+		inv.Memory.Total = vm.Total
+		inv.Memory.Available = vm.Available
+	} else {
+		inv.warnf("获取内存信息失败: %v", err)
+	}
+	if swap, err := mem.SwapMemory(); err == nil {
+		inv.Memory.SwapTotal = swap.Total
+	}
+
+	if parts, err := disk.Partitions(false); err == nil {
+		for _, p := range parts {
+			usage, err := disk.Usage(p.Mountpoint)
+			if err != nil || usage.Total == 0 {
+				continue
+			}
+			inv.Disks = append(inv.Disks, inventoryDisk{
+				Device:      p.Device,
+				Mountpoint:  p.Mountpoint,
+				Fstype:      p.Fstype,
+				Total:       usage.Total,
+				Used:        usage.Used,
+				UsedPercent: float64(int(usage.UsedPercent*10)) / 10,
+			})
+		}
+	} else {
+		inv.warnf("获取磁盘信息失败: %v", err)
+	}
+
+	if iface, err := network.DefaultInterface(); err == nil {
+		inv.DefaultInterface = iface.Name
+	}
+	if ifaces, err := network.Interfaces(); err == nil {
+		for _, i := range ifaces {
+			nic := inventoryNIC{
+				Name:      i.Name,
+				Kind:      i.Kind,
+				MAC:       i.MAC,
+				MTU:       i.MTU,
+				Speed:     i.Speed,
+				OperState: i.OperState,
+				Up:        i.Up,
+				Addrs:     i.Addrs,
+			}
+			if nic.Addrs == nil {
+				nic.Addrs = []string{}
+			}
+			inv.Interfaces = append(inv.Interfaces, nic)
+		}
+	} else {
+		inv.warnf("获取网卡信息失败: %v", err)
+	}
+
+	inv.Software.Docker = commandVersion("docker", "--version")
+	inv.Software.Chrony = commandVersion("chronyd", "-v")
+	inv.Security = securityState(osInfo)
+	inv.Limits = readLimits()
+	return inv
+}
+
+// 执行name args获取软件版本号，未安装返回空
+func commandVersion(name string, args ...string) string {
+	if !utils.TryCommand(name) {
+		return ""
+	}
+	out, _ := script.Command(name, args...).String()
+	return versionRegexp.FindString(out)
+}
+
+func securityState(osInfo *os.Data) inventorySecurity {
+	var s inventorySecurity
+	if b, err := nos.ReadFile("/sys/fs/selinux/enforce"); err == nil {
+		s.SELinux = "permissive"
+		if strings.TrimSpace(string(b)) == "1" {
+			s.SELinux = "enforcing"
+		}
+	}
+	if content, err := nos.ReadFile("/etc/selinux/config"); err == nil {
+		for _, line := range strings.Split(string(content), "\n") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(line), "SELINUX="); ok {
+				s.SELinuxConfig = strings.TrimSpace(v)
+			}
+		}
+		if s.SELinux == "" {
+			s.SELinux = "disabled"
+		}
+	}
+
+	switch {
+	case isServiceActive(osInfo, "firewalld"):
+		s.Firewalld = "active"
+	case utils.TryCommand("firewalld") || utils.TryCommand("firewall-cmd"):
+		s.Firewalld = "inactive"
+	default:
+		s.Firewalld = "not-installed"
+	}
+	if s.Firewalld != "not-installed" {
+		s.FirewalldEnabled = isServiceEnabled(osInfo, "firewalld")
+	}
+	return s
+}
+
+// 读取/proc/self/limits及fs.file-max、fs.nr_open
+func readLimits() inventoryLimits {
+	l := inventoryLimits{NofileSoft: -1, NofileHard: -1, NprocSoft: -1, NprocHard: -1}
+	parse := func(s string) int64 {
+		n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return -1
+		}
+		return n
+	}
+	if content, err := nos.ReadFile("/proc/self/limits"); err == nil {
+		for _, line := range strings.Split(string(content), "\n") {
+			// Max open files            1024                 524288               files
+			fields := strings.Fields(line)
+			if len(fields) < 5 {
+				continue
+			}
+			name := strings.Join(fields[:len(fields)-3], " ")
+			soft, hard := parse(fields[len(fields)-3]), parse(fields[len(fields)-2])
+			switch name {
+			case "Max open files":
+				l.NofileSoft, l.NofileHard = soft, hard
+			case "Max processes":
+				l.NprocSoft, l.NprocHard = soft, hard
+			}
+		}
+	}
+	l.FileMax, l.NrOpen = -1, -1
+	if b, err := nos.ReadFile("/proc/sys/fs/file-max"); err == nil {
+		l.FileMax = parse(string(b))
+	}
+	if b, err := nos.ReadFile("/proc/sys/fs/nr_open"); err == nil {
+		l.NrOpen = parse(string(b))
+	}
+	return l
+}
+
+// 以1024为进制格式化字节数
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func formatLimit(n int64) string {
+	if n < 0 {
+		return "unlimited"
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func printInventoryTable(inv *hostInventory) {
+	w := tabwriter.NewWriter(nos.Stdout, 0, 0, 2, ' ', 0)
+	osLine := inv.OS.PrettyName
+	if inv.OS.EOL {
+		osLine += " (EOL)"
+	}
+	rows := [][2]string{
+		{"Hostname", inv.Hostname},
+		{"OS", osLine},
+		{"Kernel", inv.Kernel},
+		{"Arch", inv.Arch},
+		{"Virtualization", inv.Virtualization},
+		{"Cloud", orDash(inv.Cloud)},
+		{"Container", orDash(inv.Container)},
+		{"CPU", fmt.Sprintf("%s, %d sockets, %d cores, %d threads", inv.CPU.Model, inv.CPU.Sockets, inv.CPU.Cores, inv.CPU.Threads)},
+		{"Memory", fmt.Sprintf("%s total, %s available, %s swap", formatBytes(inv.Memory.Total),
+			formatBytes(inv.Memory.Available), formatBytes(inv.Memory.SwapTotal))},
+		{"Docker", orDash(inv.Software.Docker)},
+		{"Chrony", orDash(inv.Software.Chrony)},
+		{"SELinux", orDash(inv.Security.SELinux)},
+		{"Firewalld", fmt.Sprintf("%s (enabled: %t)", inv.Security.Firewalld, inv.Security.FirewalldEnabled)},
+		{"Nofile", formatLimit(inv.Limits.NofileSoft) + "/" + formatLimit(inv.Limits.NofileHard)},
+		{"Nproc", formatLimit(inv.Limits.NprocSoft) + "/" + formatLimit(inv.Limits.NprocHard)},
+		{"fs.file-max", formatLimit(inv.Limits.FileMax)},
+		{"fs.nr_open", formatLimit(inv.Limits.NrOpen)},
+	}
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s:\t%s\n", r[0], r[1])
+	}
+	_ = w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(nos.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DEVICE\tMOUNTPOINT\tFSTYPE\tSIZE\tUSED\tUSE%")
+	for _, d := range inv.Disks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%.1f%%\n", d.Device, d.Mountpoint, d.Fstype,
+			formatBytes(d.Total), formatBytes(d.Used), d.UsedPercent)
+	}
+	_ = w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(nos.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INTERFACE\tKIND\tSTATE\tMTU\tSPEED\tMAC\tADDRESSES")
+	for _, i := range inv.Interfaces {
+		name := i.Name
+		if name == inv.DefaultInterface {
+			name += "*"
+		}
+		speed := "-"
+		if i.Speed > 0 {
+			speed = strconv.Itoa(i.Speed) + "Mb/s"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n", name, orDash(i.Kind), orDash(i.OperState), i.MTU,
+			speed, orDash(i.MAC), orDash(strings.Join(i.Addrs, ",")))
+	}
+	_ = w.Flush()
+}
+
+func buildInfoCmd() *cobra.Command {
+	infoCmd := &cobra.Command{
+		Use:   "info",
+		Short: "输出主机清单: 系统、内核、CPU/内存/磁盘、网卡、软件版本及安全配置",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			output, _ := cmd.Flags().GetString("output")
+			inv := collectInventory(checkGOOS())
+			for _, w := range inv.Warnings {
+				fmt.Fprintln(nos.Stderr, "WARN", w)
+			}
+			switch output {
+			case "table":
+				printInventoryTable(inv)
+			case "json":
+				b, _ := json.MarshalIndent(inv, "", "  ")
+				fmt.Println(string(b))
+			case "yaml":
+				b, err := yaml.Marshal(inv)
+				if err != nil {
+					logger.Sugar.Fatal(err)
+				}
+				fmt.Print(string(b))
+			default:
+				logger.Sugar.Fatalf("不支持的输出格式%s，可选table|json|yaml", output)
+			}
+		},
+	}
+	infoCmd.Flags().StringP("output", "o", "table", "输出格式: table|json|yaml")
+	return infoCmd
+}
@@ -1,16 +1,17 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
-	"net"
 	nos "os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"sort"
 	"stkey/internal/content"
+	"stkey/pkg/conf"
 	"stkey/pkg/logger"
+	"stkey/pkg/network"
 	"stkey/pkg/os"
 	"stkey/pkg/script"
 	"stkey/utils"
@@ -31,8 +32,9 @@ func buildInitCmd() *cobra.Command {
 Commands:
     kernel          更新内核参数
     system          优化系统设置
-    time            安装chrony、设置时区Asia/Shanghai
+    time            安装chrony、设置时区(默认Asia/Shanghai)及NTP服务器
     pkg             安装YUM或APT源仓库及依赖工具
+    audit           配置auditd记录登录用户执行的命令，使用ops audit search查询
     docker          安装docker
 	tools		    安装常用工具
     all             执行所有指令
@@ -41,11 +43,20 @@ Commands:
 		PreRun: func(cmd *cobra.Command, args []string) {
 			osInfo = checkGOOS()
 			checkUserPermission()
+			checkEOL(osInfo)
+			reportHost(osInfo)
+			if file, _ := cmd.Flags().GetString("bundle"); file != "" {
+				offline = useBundle(osInfo, file)
+			}
+			mirrorChoice, _ = cmd.Flags().GetString("mirror")
+			pkgTimeout, _ = cmd.Flags().GetDuration("pkg-timeout")
 			disableUbuntuAutoUpgrade(osInfo)
+			// Fatal退出时不执行PostRun，同样恢复自动更新
+			logger.AtExit(func() { enableUbuntuAutoUpgrade(osInfo) })
 		},
 		Run: func(cmd *cobra.Command, args []string) {
 
-			allOptions := []string{"kernel", "system", "time", "pkg", "docker", "tools"}
+			allOptions := []string{"kernel", "system", "time", "pkg", "audit", "docker", "tools"}
 			except, _ := cmd.Flags().GetStringSlice("except")
 
 			// 如果参数包含all,则执行所有指令
@@ -71,6 +82,7 @@ Commands:
 				if slices.Contains(except, option) {
 					continue
 				}
+				script.SetStep(option)
 
 				switch option {
 				case "kernel":
@@ -78,46 +90,115 @@ Commands:
 				case "system":
 					optimizeSystem(osInfo)
 				case "time":
-					syncTime(osInfo)
+					syncTime(osInfo, getTimeOptions(cmd))
 				case "pkg":
 					updatePkg(osInfo)
+				case "audit":
+					setupAudit(osInfo, getAuditOptions(cmd))
 				case "docker":
-					installDocker(osInfo)
+					mtu, _ := cmd.Flags().GetInt("mtu")
+					overlay, _ := cmd.Flags().GetString("overlay")
+					installDocker(osInfo, mtu, overlay)
 				case "tools":
-					downloadTools()
+					downloadTools(osInfo, getToolsOptions(cmd))
 				}
 			}
 
 		},
 		PostRun: func(cmd *cobra.Command, args []string) {
+			script.SetStep("")
 			enableUbuntuAutoUpgrade(osInfo)
+			offline.cleanup()
+			printInitReport()
 		},
 	}
 
 	initCmd.Flags().StringSliceP("except", "x", []string{}, "排除这些指令，比如排除這2個：-x docker -x tools")
+	initCmd.Flags().Int("mtu", 0, "指定docker网桥MTU，默认取默认路由网卡的MTU")
+	initCmd.Flags().String("overlay", "none", "docker网络的封装类型，MTU将扣除封装开销: none|vxlan|geneve|gre|ipip|sit|wireguard|ipsec")
+	initCmd.Flags().String("mirror", defaultMirror, "软件源镜像站: auto(云主机优先使用内网镜像站，否则探测最快的镜像站)|tencent|aliyun|huawei|tsinghua|official|tencent-internal|aliyun-internal|huawei-internal|<内部镜像站URL>")
+	initCmd.Flags().Duration("pkg-timeout", pkgTimeout, "单条yum/apt-get命令的超时时间，超时则终止并报错")
+	initCmd.Flags().String("bundle", "", "使用ops bundle build构建的离线包安装，不访问网络")
+	addTimeFlags(initCmd)
+	addToolsFlags(initCmd)
+	addAuditFlags(initCmd)
 
 	return initCmd
 }
 
+// initWarnings init结束时需要提醒的问题
+var initWarnings []string
+
+func reportWarning(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	logger.Sugar.Warnln(msg)
+	initWarnings = append(initWarnings, msg)
+}
+
+func printInitReport() {
+	if len(initWarnings) == 0 {
+		return
+	}
+	logger.Sugar.Warnln("初始化完成，请注意以下问题:")
+	for _, w := range initWarnings {
+		logger.Sugar.Warnln(" - " + w)
+	}
+}
+
+// 输出识别到的系统环境
+func reportHost(osInfo *os.Data) {
+	cloud := osInfo.Cloud
+	if cloud == "" {
+		cloud = "none"
+	}
+	logger.Sugar.Infof("系统:%s 内核:%s 架构:%s 虚拟化:%s 云厂商:%s", osInfo.PrettyName, osInfo.Kernel,
+		osInfo.Arch, osInfo.Virtualization, cloud)
+	if osInfo.InContainer() {
+		logger.Sugar.Infof("运行在%s容器中", osInfo.Container)
+	}
+}
+
+// 检查系统是否已停止维护
+func checkEOL(osInfo *os.Data) {
+	if eol := osInfo.EOL(); eol != nil {
+		reportWarning("%s %s已于%s停止维护(EOL)，上游不再提供更新及安全补丁，软件源将使用vault归档，建议升级系统",
+			osInfo.ID, osInfo.VersionID, eol.Date)
+	}
+}
+
 func checkGOOS() *os.Data {
 	var sysType string = runtime.GOOS
 	var o *os.Data
 	if sysType == "windows" {
 		o = &os.Data{}
 	} else if sysType == "linux" {
-		o = os.Parse(os.EtcOsRelease, os.IssueOsRelease)
+		var err error
+		if o, err = os.Parse(); err != nil {
+			logger.Sugar.Fatal("识别系统版本失败:", err)
+		}
 	}
 	return o
 }
 
+// br_netfilter从3.18内核开始从bridge模块拆分，CentOS 7的3.10内核向后移植了该模块
+func hasBrNetfilter(osInfo *os.Data) bool {
+	if osInfo.KernelVersion.AtLeast(3, 18) {
+		return true
+	}
+	dep, _ := script.File("/lib/modules/" + osInfo.Kernel + "/modules.dep").Match("/br_netfilter.ko").String()
+	return dep != ""
+}
+
 // 优化内核设置
 func updateKernel(osInfo *os.Data) {
 	logger.Sugar.Infoln("开始检查并更新内核参数")
-	var modules []string
-	if osInfo.IsCentOS6() {
-		modules = []string{"ip_vs", "ip_vs_rr", "ip_vs_wrr", "ip_vs_sh", "nf_conntrack"}
-	} else {
-		modules = []string{"br_netfilter", "ip_vs", "ip_vs_rr", "ip_vs_wrr", "ip_vs_sh", "nf_conntrack"}
+	if osInfo.InContainer() {
+		reportWarning("当前运行在%s容器中，内核模块及参数由宿主机决定，跳过kernel", osInfo.Container)
+		return
+	}
+	modules := []string{"ip_vs", "ip_vs_rr", "ip_vs_wrr", "ip_vs_sh", "nf_conntrack"}
+	if hasBrNetfilter(osInfo) {
+		modules = append([]string{"br_netfilter"}, modules...)
 	}
 	p, _ := script.File(osInfo.FileMap["modulePath"]).Match(modules[0]).String()
 	if len(p) == 0 {
@@ -129,36 +210,62 @@ func updateKernel(osInfo *os.Data) {
 	if len(p) == 0 && osInfo.IsCentOS() {
 		for _, m := range modules {
 			_, _ = script.Echo("modprobe " + m + "\n").AppendFile(osInfo.FileMap["rcLocalPath"])
-			_, _ = script.Exec("sudo chmod +x " + osInfo.FileMap["rcLocalPath"]).Stdout()
+			_, _ = script.CommandAsRoot("chmod", "+x", osInfo.FileMap["rcLocalPath"]).Stdout()
 		}
 	}
 	for _, m := range modules {
-		_, _ = script.Exec("sudo modprobe " + m).Stdout()
+		_, _ = script.CommandAsRoot("modprobe", m).Stdout()
 	}
 	//centos7新增fs.may_detach_mounts
 	if osInfo.IsCentOS7() {
-		_ = utils.AppendFileIf(osInfo.FileMap["sysctlPath"], "fs.may_detach_mounts", "fs.may_detach_mounts = 1\n")
+		setConf(osInfo.FileMap["sysctlPath"], " = ", "fs.may_detach_mounts", "1")
 	}
 	if osInfo.IsCentOS6() {
 		_ = utils.AppendFileIf(osInfo.FileMap["sysctlPath"], "start check kernel", content.CentOs6SysctlText)
 	} else {
 		_ = utils.AppendFileIf(osInfo.FileMap["sysctlPath"], "start check kernel", content.SysctlText)
 	}
-	s := script.Exec("sudo sysctl -p")
-	s.Wait()
-	if s.ExitStatus() != 0 {
-		logger.Sugar.Fatal("sysctl -p 更新sysctl失败,请检查")
-	} else {
-		logger.Sugar.Infoln("sysctl -p:")
-		_, _ = script.Exec("sudo sysctl -p").Stdout()
-		logger.Sugar.Infoln("更新内核参数成功")
+	res, err := script.NewPipe().AsRoot().WithEnv("LC_ALL=C").Run("sysctl -p")
+	var exitErr *script.ExitError
+	if errors.As(err, &exitErr) {
+		keys, onlyUnknown := unknownSysctlKeys(res.StderrLines())
+		if !onlyUnknown {
+			logger.Sugar.Fatalf("sysctl -p 更新sysctl失败,请检查: %s", strings.TrimSpace(res.Stderr))
+		}
+		reportWarning("当前内核不支持以下sysctl参数，已忽略: %s", strings.Join(keys, ", "))
+	} else if err != nil {
+		logger.Sugar.Fatal("sysctl -p 更新sysctl失败,请检查: ", err)
+	}
+	logger.Sugar.Infoln("sysctl -p:")
+	for _, line := range strings.Split(strings.TrimRight(res.Stdout, "\n"), "\n") {
+		logger.Sugar.Infoln(line)
+	}
+	logger.Sugar.Infoln("更新内核参数成功")
+}
+
+// sysctl -p对内核不存在的参数的报错，新旧版本procps格式不同
+var sysctlUnknownKey = regexp.MustCompile(`cannot stat /proc/sys/(\S+?): No such file or directory|"(\S+)" is an unknown key`)
+
+// 从sysctl -p的错误输出中提取内核不支持的参数，有其他错误或没有错误输出时onlyUnknown为false
+func unknownSysctlKeys(lines []string) (keys []string, onlyUnknown bool) {
+	for _, line := range lines {
+		m := sysctlUnknownKey.FindStringSubmatch(line)
+		if m == nil {
+			return keys, false
+		}
+		if m[1] != "" {
+			keys = append(keys, strings.ReplaceAll(m[1], "/", "."))
+		} else {
+			keys = append(keys, m[2])
+		}
 	}
+	return keys, len(keys) > 0
 }
 
 // 关闭swap
 func disableSwap() {
 	logger.Sugar.Infoln("关闭swap")
-	_, _ = script.Exec("sudo swapoff -a").Stdout()
+	_, _ = script.ExecAsRoot("swapoff -a").Stdout()
 }
 
 // 检查设置limit
@@ -171,65 +278,91 @@ func updateLimit(osInfo *os.Data) {
 	}
 
 	if !osInfo.IsCentOS6() {
-		_ = utils.Replace("/etc/systemd/system.conf", "#DefaultLimitNOFILE=", "DefaultLimitNOFILE=102400")
-		_ = utils.Replace("/etc/systemd/system.conf", "#DefaultLimitNPROC=", "DefaultLimitNPROC=102400")
+		setSystemdManager(map[string]string{
+			"DefaultLimitNOFILE": "102400",
+			"DefaultLimitNPROC":  "102400",
+		})
 	}
-	_ = exec.Command("/bin/bash", "-c", "ulimit -n 65535").Run()
+	script.Command("/bin/bash", "-c", "ulimit -n 65535").Wait()
 }
 
 // 检查bashrc
 func updateBashrc() {
 	logger.Sugar.Infoln("检查用户Bashrc设置")
-	_, _ = script.Echo(content.BashrcConf).WriteFile("/root/.bashrc")
-	if utils.PathExists("/etc/bashrc") {
-		_, _ = script.Echo(content.TerminalConf).AppendFile("/etc/bashrc")
-		_ = exec.Command("/bin/bash", "-c", "source /etc/bashrc").Run()
+	setBlock("/root/.bashrc", "aliases", content.BashrcConf)
+	setShellConf("terminal", content.TerminalConf)
+	// 移除旧版本追加到全局bashrc中的整段相同设置，单独出现的相同行属于用户配置，保留
+	for _, rc := range globalBashrcs {
+		f, err := conf.Load(rc)
+		if err != nil || !f.RemoveText(content.TerminalConf) {
+			continue
+		}
+		if _, err := f.Save(); err != nil {
+			reportWarning("修改%s失败: %s", rc, err)
+		}
 	}
+}
 
-	if utils.PathExists("/etc/bash.bashrc") {
-		_, _ = script.Echo(content.TerminalConf).AppendFile("/etc/bash.bashrc")
-		_ = exec.Command("/bin/bash", "-c", "source /etc/bash.bashrc").Run()
+// profileDir 登录shell加载的配置目录，ops的配置以ops-<name>.sh写入
+const profileDir = "/etc/profile.d"
+
+// globalBashrcs 所有用户的bashrc: CentOS为/etc/bashrc，Ubuntu/Debian为/etc/bash.bashrc
+var globalBashrcs = []string{"/etc/bashrc", "/etc/bash.bashrc"}
+
+// 写入所有用户的shell配置，优先使用/etc/profile.d/ops-<name>.sh，
+// 没有profile.d时以受管块写入全局bashrc，不影响文件的其他内容。
+// profile.d只由登录shell加载，Ubuntu/Debian的/etc/bash.bashrc不会加载，
+// 因此同时在全局bashrc中写入加载该文件的受管块，使非登录的交互shell(如su、tmux)同样生效
+func setShellConf(name, text string) {
+	if utils.PathExists(profileDir) {
+		path := filepath.Join(profileDir, "ops-"+name+".sh")
+		setBlock(path, name, text)
+		text = fmt.Sprintf("[ -r %[1]s ] && . %[1]s\n", path)
+	}
+	for _, rc := range globalBashrcs {
+		if utils.PathExists(rc) {
+			setBlock(rc, name, text)
+		}
 	}
 }
 
-// CentOS关闭selinux,firewalld
-func disableDefault(osInfo *os.Data) {
-	logger.Sugar.Infoln("检查并关闭SELinux,FireWalld(如果存在)")
-	if osInfo.IsCentOS() {
-		_, _ = script.Exec("sudo setenforce 0").Stdout()
-		_ = utils.Replace("/etc/selinux/config", "SELINUX=enforcing", "SELINUX=disabled")
+// 以"# BEGIN ops <name>"、"# END ops <name>"包围的受管块写入text，已存在则原地更新
+func setBlock(path, name, text string) {
+	f, err := conf.Load(path)
+	if err == nil {
+		f.SetBlock(name, text)
+		_, err = f.Save()
 	}
-
-	if osInfo.IsCentOS() && !osInfo.IsCentOS6() {
-		if utils.TryCommand("firewall-cmd") {
-			_, _ = script.Exec("sudo systemctl stop firewalld").Stdout()
-			_, _ = script.Exec("sudo systemctl disable firewalld").Stdout()
-		}
+	if err != nil {
+		reportWarning("写入%s失败: %s", path, err)
 	}
 }
 
-// 设置history命令记录
-func updateHistory() {
-	logger.Sugar.Infoln("设置history命令记录,history记录目录:/var/log/.hist")
-	err := utils.MustMakeDir("/var/log/.hist")
+// 移除受管块，文件不存在时跳过
+func removeBlock(path, name string) {
+	f, err := conf.Load(path)
+	if err == nil && f.RemoveBlock(name) {
+		_, err = f.Save()
+	}
 	if err != nil {
-		logger.Sugar.Fatal("updateHistory()", err)
+		reportWarning("修改%s失败: %s", path, err)
 	}
+}
 
-	time.Sleep(time.Duration(1) * time.Second)
-	if utils.PathExists("/etc/bashrc") {
-		_, _ = script.Echo(content.HistoryLog).WriteFile("/etc/bashrc")
-		_ = exec.Command("/bin/bash", "-c", "source /etc/bashrc").Run()
+// CentOS关闭selinux,firewalld
+func disableDefault(osInfo *os.Data) {
+	logger.Sugar.Infoln("检查并关闭SELinux,FireWalld(如果存在)")
+	if osInfo.IsCentOS() {
+		_, _ = script.ExecAsRoot("setenforce 0").Stdout()
+		setConf("/etc/selinux/config", "=", "SELINUX", "disabled")
 	}
 
-	if utils.PathExists("/etc/bash.bashrc") {
-		_, _ = script.Echo(content.HistoryLog).WriteFile("/etc/bash.bashrc")
-		_ = exec.Command("/bin/bash", "-c", "source /etc/bash.bashrc").Run()
+	if osInfo.IsCentOS() && !osInfo.IsCentOS6() {
+		if utils.TryCommand("firewall-cmd") {
+			_, _ = script.ExecAsRoot("systemctl stop firewalld").Stdout()
+			_, _ = script.ExecAsRoot("systemctl disable firewalld").Stdout()
+		}
 	}
-
-	logger.Sugar.Infoln("添加history logrotate")
-	_, _ = script.Echo(content.LogrotateHistory).WriteFile("/etc/logrotate.d/command")
-	_, _ = script.Exec("sudo chmod -R 777 " + "/var/log/.hist").Stdout()
 }
 
 func optimizeSystem(osInfo *os.Data) {
@@ -237,238 +370,56 @@ func optimizeSystem(osInfo *os.Data) {
 	updateLimit(osInfo)
 	updateBashrc()
 	disableDefault(osInfo)
-	updateHistory()
 }
 
-var spaceRegexp = regexp.MustCompile(`\s+`)
-var lineRegexp = regexp.MustCompile(`\n+`)
-
-// 下载更新s3存储上的相关工具，文件列表：https://s3.load.cool:8000/software/linux-software.txt
-func downloadTools() {
-	logger.Sugar.Infoln("检查安装os相关command")
-	_ = utils.MustMakeDir("/usr/libexec/docker/cli-plugins/")
-	time.Sleep(time.Duration(1) * time.Second)
-
-	_content := utils.HttpGet("https://s3.load.cool:8000/software/linux-software.txt")
-	if _content == "" {
-		logger.Sugar.Errorln("获取文件列表失败")
+func getRepo(osInfo *os.Data) {
+	if offline != nil {
+		logger.Sugar.Infoln("使用离线包本地仓库，跳过更新软件源")
 		return
 	}
-	for _, line := range lineRegexp.Split(strings.TrimSpace(_content), -1) {
-		segments := spaceRegexp.Split(strings.TrimSpace(line), -1)
-		if len(segments) < 3 {
-			logger.Sugar.Infoln("格式错误，跳过：" + line)
-			continue
-		}
-
-		_url := segments[0]
-		_md5 := segments[1]
-		_paths := segments[2:]
-
-		for _, _path := range _paths {
-			// 如果文件不存在，下载
-			if !utils.PathExists(_path) {
-				_ = utils.MustMakeDir(filepath.Dir(_path))
-				logger.Sugar.Infoln("文件不存在开始下载：" + _url + " --->" + _path)
-				if err := utils.DownloadFile(_path, _url); err != nil {
-					logger.Sugar.Errorln(err)
-				}
-			} else {
-				// 如果文件存在，但是md5不匹配，下载
-				currentMd5 := utils.MD5File(_path)
-				if !strings.EqualFold(currentMd5, _md5) {
-					logger.Sugar.Infoln("MD5不匹配，开始下载：" + _url + " --->" + _path)
-					if err := utils.DownloadFile(_path, _url); err != nil {
-						logger.Sugar.Errorln(err)
-					}
-				} else {
-					logger.Sugar.Infoln("文件已存在並且MD5相符，跳过：" + _path)
-				}
-			}
-			script.Exec("sudo chmod +x " + _path).Stdout()
-		}
-	}
-}
-
-// 安装设置Chrony时间同步
-func syncTime(osInfo *os.Data) {
-	logger.Sugar.Infoln("安装配置chrony时间同步")
-	if osInfo.IsLikeFedora() {
-		ntpConf := "/etc/chrony.conf"
-		ntpConfPath := content.FedoraChronyConf
-		if !utils.TryCommand("chronyd") {
-			logger.Sugar.Infoln("检测到chrony服务不存在,开始安装chrony")
-			_, err := script.Exec("sudo yum install chrony -y").Stdout()
-			if err != nil {
-				logger.Sugar.Fatal(err)
-			}
-		} else {
-			logger.Sugar.Infoln("检测到chrony服务已存在，开始设置chrony服务")
-		}
-		if utils.PathExists(ntpConf) {
-			script.Echo(ntpConfPath).WriteFile(ntpConf)
-		} else {
-			logger.Sugar.Fatalf("配置文件%s不存在，请检查chrony服务", ntpConf)
-		}
-
-		if osInfo.IsCentOS6() {
-			_, err := script.Exec("sudo /etc/init.d/chronyd start").Stdout()
-			if err != nil {
-				logger.Sugar.Fatal(err)
-			}
-			_, err = script.Exec("sudo chkconfig chronyd on").Stdout()
-			if err != nil {
-				logger.Sugar.Fatal(err)
-			}
-			_, err = script.Exec("sudo ln -sf /usr/share/zoneinfo/Asia/Shanghai /etc/localtime").Stdout()
-			if err != nil {
-				logger.Sugar.Infoln("时区设置失败")
-			} else {
-				logger.Sugar.Infof("更新chrony配置文件:%s", ntpConf)
-				script.File(ntpConf).Stdout()
-				logger.Sugar.Infoln("chrony同步状态:")
-				script.Exec("chronyc sources -v").Stdout()
-				logger.Sugar.Infoln("chrony设置成功")
-			}
-		} else {
-			if osInfo.IsLikeFedora() && !osInfo.IsCentOS6() {
-				_, _ = script.Exec("sudo systemctl restart chronyd").Stdout()
-				_, err := script.Exec("sudo systemctl enable chronyd --now").Stdout()
-				if err != nil {
-					logger.Sugar.Fatal(err)
-				}
-			} else if osInfo.IsLikeDebian() {
-				_, _ = script.Exec("sudo systemctl restart chrony").Stdout()
-				_, err := script.Exec("sudo systemctl enable chrony --now").Stdout()
-				if err != nil {
-					logger.Sugar.Fatal(err)
-				}
-			}
-			_, err := script.Exec("sudo timedatectl set-timezone Asia/Shanghai").Stdout()
-			if err != nil {
-				logger.Sugar.Infoln("时区设置失败")
-			} else {
-				logger.Sugar.Infof("chrony配置文件:%s", ntpConf)
-				script.File(ntpConf).Stdout()
-				logger.Sugar.Infoln("chrony同步状态:")
-				script.Exec("chronyc sources -v").Stdout()
-				logger.Sugar.Infoln("timedatectl status:")
-				script.Exec("timedatectl status").Stdout()
-			}
-		}
-	} else {
-		ntpConf := "/etc/chrony/chrony.conf"
-		ntpConfPath := content.DebianChronyConf
-		if !utils.TryCommand("chronyd") {
-			_, err := script.Exec("sudo apt-get install -y chrony").Stdout()
-			if err != nil {
-				logger.Sugar.Fatal(err)
-			}
-		} else {
-			logger.Sugar.Infoln("检测到chrony服务已存在，开始设置chrony服务")
-		}
-		if utils.PathExists(ntpConf) {
-			script.Echo(ntpConfPath).WriteFile(ntpConf)
-		} else {
-			logger.Sugar.Fatalf("配置文件%s不存在，请检查chrony服务", ntpConf)
-		}
-		_, _ = script.Exec("sudo systemctl restart chrony").Stdout()
-		_, err := script.Exec("sudo systemctl enable chrony --now").Stdout()
-		if err != nil {
-			logger.Sugar.Fatal(err)
-		}
-		_, err = script.Exec("sudo timedatectl set-timezone Asia/Shanghai").Stdout()
-		if err != nil {
-			logger.Sugar.Infoln("时区设置失败")
-		} else {
-			logger.Sugar.Infof("chrony配置文件:%s", ntpConf)
-			script.File(ntpConf).Stdout()
-			logger.Sugar.Infoln("chrony同步状态:")
-			script.Exec("chronyc sources -v").Stdout()
-			script.Exec("timedatectl status").Stdout()
-		}
-	}
-}
-func getRepo(osInfo *os.Data) {
 	if osInfo.IsLikeFedora() {
 		logger.Sugar.Infoln("开始更新YUM源")
 	} else if osInfo.IsLikeDebian() {
 		logger.Sugar.Infoln("开始更新APT源")
 	}
 	if osInfo.IsCentOS() {
-		if osInfo.IsCentOS7() {
-			logger.Sugar.Infoln("curl -fsSL -o /etc/yum.repos.d/CentOS-Base.repo https://mirrors.cloud.tencent.com/repo/centos7_base.repo")
-			_, err := script.Exec("curl -fsSL -o /etc/yum.repos.d/CentOS-Base.repo https://mirrors.cloud.tencent.com/repo/centos7_base.repo").Stdout()
-			if err != nil {
-				logger.Sugar.Fatal(err)
-			}
-			logger.Sugar.Infoln("curl -fsSL -o /etc/yum.repos.d/epel.repo https://mirrors.cloud.tencent.com/repo/epel-7.repo")
-			_, err = script.Exec("curl -fsSL -o /etc/yum.repos.d/epel.repo https://mirrors.cloud.tencent.com/repo/epel-7.repo").Stdout()
-			if err != nil {
-				logger.Sugar.Fatal(err)
-			}
+		data := newRepoData(osInfo)
+		if osInfo.IsCentOS7() || osInfo.IsCentOS6() {
+			writeRepoFile("/etc/yum.repos.d/CentOS-Base.repo", content.CentosBaseRepo, data)
+			writeRepoFile("/etc/yum.repos.d/epel.repo", content.EpelRepo, data)
 		} else if osInfo.IsCentOS8() {
-			_ = exec.Command("/bin/bash", "-c", "rm -rf /etc/yum.repos.d/*.repo").Run()
-			time.Sleep(time.Duration(1) * time.Second)
-			_, err := script.Echo(content.Centos8BaseRepo).WriteFile("/etc/yum.repos.d/CentOS-Base.repo")
-			if err != nil {
-				logger.Sugar.Fatal(err)
-			}
-			_, err = script.Echo(content.Centos8EpelRepo).WriteFile("/etc/yum.repos.d/CentOS-Epel.repo")
-			if err != nil {
-				logger.Sugar.Fatal(err)
-			}
-			_, err = script.Echo(content.Centos8AppStreamRepo).WriteFile("/etc/yum.repos.d/CentOS-Linux-AppStream.repo")
-			if err != nil {
-				logger.Sugar.Fatal(err)
-			}
-			_, err = script.Echo(content.Centos8EpelKey).WriteFile("/etc/pki/rpm-gpg/RPM-GPG-KEY-EPEL-8")
-			if err != nil {
-				logger.Sugar.Fatal(err)
-			}
-		} else if osInfo.IsCentOS6() {
-			logger.Sugar.Infoln("curl -fsSL -o /etc/yum.repos.d/CentOS-Base.repo https://mirrors.cloud.tencent.com/repo/centos6_base.repo")
-			_, err := script.Exec("curl -fsSL -o /etc/yum.repos.d/CentOS-Base.repo https://mirrors.cloud.tencent.com/repo/centos6_base.repo").Stdout()
-			if err != nil {
-				logger.Sugar.Fatal(err)
-			}
-			logger.Sugar.Infoln("curl -fsSL -o /etc/yum.repos.d/epel.repo https://mirrors.cloud.tencent.com/repo/epel-6.repo")
-			_, err = script.Exec("curl -fsSL -o /etc/yum.repos.d/epel.repo https://mirrors.cloud.tencent.com/repo/epel-6.repo").Stdout()
+			removeRepoFiles("/etc/yum.repos.d/*.repo")
+			writeRepoFile("/etc/yum.repos.d/CentOS-Base.repo", content.Centos8BaseRepo, data)
+			writeRepoFile("/etc/yum.repos.d/CentOS-Epel.repo", content.Centos8EpelRepo, data)
+			writeRepoFile("/etc/yum.repos.d/CentOS-Linux-AppStream.repo", content.Centos8AppStreamRepo, data)
+			_, err := script.Echo(content.Centos8EpelKey).WriteFile("/etc/pki/rpm-gpg/RPM-GPG-KEY-EPEL-8")
 			if err != nil {
 				logger.Sugar.Fatal(err)
 			}
 		}
 
 		logger.Sugar.Infoln("yum clean all:")
-		script.Exec("sudo yum clean all").Stdout()
+		pkgExec("yum clean all").Stdout()
 		logger.Sugar.Infoln("yum makecache生成缓存:")
-		_, err := script.Exec("sudo yum makecache").Stdout()
+		_, err := pkgExec("yum makecache").Stdout()
 		if err != nil {
 			logger.Sugar.Fatalf("更新YUM源失败:%s", err)
 		} else if osInfo.IsCentOS6() && !osInfo.IsLikeDebian() {
 			logger.Sugar.Infoln("当前yum repolist:")
-			script.Exec("yum repolist").Stdout()
+			pkgExec("yum repolist").Stdout()
 			logger.Sugar.Infoln("更新YUM源成功")
 		} else if osInfo.IsCentOS7() {
-			p := script.Exec("sudo yum install yum-complete-transaction -y")
+			p := pkgExec("yum install yum-complete-transaction -y")
 			p.Wait()
-			script.Exec("sudo yum-complete-transaction --cleanup-only").Stdout()
+			pkgExec("yum-complete-transaction --cleanup-only").Stdout()
 			logger.Sugar.Infoln("当前yum repolist:")
-			script.Exec("yum repolist").Stdout()
+			pkgExec("yum repolist").Stdout()
 			logger.Sugar.Infoln("更新YUM源成功")
 		}
 	} else if osInfo.IsLikeDebian() {
-		nickName, err := script.Exec("lsb_release -cs").First(1).String()
-		osNickName := strings.Split(nickName, "\n")[0]
-		if err != nil {
-			logger.Sugar.Fatal("获取lsb_release失败，安装退出")
-		}
-		_, err = script.Echo(content.AptSourceConf).WriteFile("/etc/apt/sources.list")
-		if err == nil {
-			_ = utils.Replace("/etc/apt/sources.list", "lsb_release", osNickName)
-		}
+		writeRepoFile("/etc/apt/sources.list", content.AptSourceConf, newRepoData(osInfo))
 		logger.Sugar.Infoln("apt-get update:")
-		_, err = script.Exec("sudo apt-get update").Stdout()
+		_, err := pkgExec("apt-get update").Stdout()
 		if err != nil {
 			logger.Sugar.Fatalf("更新APT源失败:%s", err)
 		} else {
@@ -478,30 +429,72 @@ func getRepo(osInfo *os.Data) {
 	}
 }
 
+// 删除匹配pattern的仓库文件
+func removeRepoFiles(pattern string) {
+	files, _ := filepath.Glob(script.Path(pattern))
+	for _, f := range files {
+		if err := nos.Remove(f); err != nil {
+			logger.Sugar.Fatalf("删除%s失败:%s", f, err)
+		}
+	}
+}
+
+// 常用工具软件
+var commonPkgs = []string{"wget", "curl", "iftop", "rsync", "telnet", "jq", "git", "unzip", "net-tools", "lrzsz", "bash-completion", "sysstat", "chrony", "nc", "tcpdump"}
+
+// pkgTimeout 单条包管理命令(yum/apt-get)的超时时间，--pkg-timeout参数
+var pkgTimeout = 30 * time.Minute
+
+// pkgEnv 包管理命令的环境变量: apt不弹出交互式配置，输出使用英文便于解析
+var pkgEnv = []string{"DEBIAN_FRONTEND=noninteractive", "LC_ALL=C"}
+
+// 以root权限执行包管理命令，超时则终止命令及其子进程
+func pkgExec(cmdLine string) *script.Pipe {
+	return script.NewPipe().AsRoot().WithEnv(pkgEnv...).WithTimeout(pkgTimeout).Exec(cmdLine)
+}
+
+// 同pkgExec，参数不经过shell解析
+func pkgCommand(name string, args ...string) *script.Pipe {
+	return script.NewPipe().AsRoot().WithEnv(pkgEnv...).WithTimeout(pkgTimeout).Command(name, args...)
+}
+
+// 返回安装软件包的命令参数，使用离线包时只启用本地仓库，不支持时返回nil
+func pkgInstallArgs(osInfo *os.Data) []string {
+	var args []string
+	if utils.TryCommand("yum") && !osInfo.IsCentOS8() {
+		args = []string{"yum", "-y", "-q", "install"}
+	} else if utils.TryCommand("apt-get") {
+		args = []string{"apt-get", "-y", "install"}
+	} else if utils.TryCommand("dnf") || osInfo.IsCentOS8() {
+		args = []string{"dnf", "-y", "-q", "install", "--nogpgcheck"}
+	} else {
+		return nil
+	}
+	return append(args, offline.repoArgs(osInfo)...)
+}
+
+// 安装软件包
+func pkgInstall(osInfo *os.Data, pkgs ...string) *script.Pipe {
+	args := pkgInstallArgs(osInfo)
+	if args == nil {
+		return script.NewPipe().WithError(errors.New("no yum, dnf or apt-get found"))
+	}
+	return pkgCommand(args[0], append(args[1:], pkgs...)...)
+}
+
 func updatePkg(osInfo *os.Data) {
 	getRepo(osInfo)
 	logger.Sugar.Infoln("检查安装常用工具软件")
-	pkgs := []string{"wget", "curl", "iftop", "rsync", "telnet", "jq", "git", "unzip", "net-tools", "lrzsz", "bash-completion", "sysstat", "chrony", "nc", "tcpdump"}
+	pkgs := commonPkgs
 	logger.Sugar.Infoln("检查及安装:", pkgs)
+	canInstall := pkgInstallArgs(osInfo) != nil
 	for i := 0; i < len(pkgs); i++ {
 		if utils.TryCommand(pkgs[i]) {
 			logger.Sugar.Infoln("command is exists:", pkgs[i])
 			continue
-		} else if utils.TryCommand("yum") && !osInfo.IsCentOS8() {
-			logger.Sugar.Infof("开始安装%s:", pkgs[i])
-			_, err := script.Exec("sudo yum -y -q install " + pkgs[i]).Stdout()
-			if err != nil {
-				logger.Sugar.Infoln("install failed", pkgs[i])
-			}
-		} else if utils.TryCommand("apt-get") {
-			logger.Sugar.Infof("开始安装%s:", pkgs[i])
-			_, err := script.Exec("sudo apt-get -y install " + pkgs[i]).Stdout()
-			if err != nil {
-				logger.Sugar.Infoln("install failed", pkgs[i])
-			}
-		} else if utils.TryCommand("dnf") || osInfo.IsCentOS8() {
+		} else if canInstall {
 			logger.Sugar.Infof("开始安装%s:", pkgs[i])
-			_, err := script.Exec("sudo dnf -y -q install --nogpgcheck " + pkgs[i]).Stdout()
+			_, err := pkgInstall(osInfo, pkgs[i]).Stdout()
 			if err != nil {
 				logger.Sugar.Infoln("install failed", pkgs[i])
 			}
@@ -509,10 +502,8 @@ func updatePkg(osInfo *os.Data) {
 			logger.Sugar.Infoln("no", pkgs[i], "command found and can not be installed by neither yum,dnf nor apt-get")
 		}
 	}
-	if osInfo.IsCentOS8() && !utils.TryCommand("python2") {
-		script.Exec("sudo yum install -y python2").Stdout()
-	} else if osInfo.IsLikeDebian() && !utils.TryCommand("python2") {
-		script.Exec("sudo apt-get install -y python2").Stdout()
+	if (osInfo.IsCentOS8() || osInfo.IsLikeDebian()) && !utils.TryCommand("python2") {
+		pkgInstall(osInfo, "python2").Stdout()
 	}
 	//兼容ubuntu18/20/22, centos8创建python2软链接
 	if utils.TryCommand("python2") && !utils.TryCommand("python") {
@@ -525,39 +516,114 @@ func updatePkg(osInfo *os.Data) {
 
 	if osInfo.IsLikeFedora() {
 		logger.Sugar.Infoln("yum clean all:")
-		script.Exec("sudo yum clean all")
+		pkgExec("yum clean all")
 	} else if osInfo.IsLikeDebian() {
-		script.Exec("sudo apt-get autoremove -y").Stdout()
-		script.Exec("sudo apt-get autoclean -y").Stdout()
+		pkgExec("apt-get autoremove -y").Stdout()
+		pkgExec("apt-get autoclean -y").Stdout()
 	}
 }
 
-func checkMtu() (dockermtu int) {
+// 检查网卡MTU: 优先使用--mtu, 否则取默认路由所在网卡的MTU并减去overlay封装开销
+func checkMtu(override int, overlay string) (dockermtu int) {
 	logger.Sugar.Infoln("检查系统网卡MTU值")
-	n, _ := net.Interfaces()
-	for i := 0; i < len(n); i++ {
-		if utils.ContainsI(n[i].Name, "ens") || utils.ContainsI(n[i].Name, "eth") || utils.ContainsI(n[i].Name, "enp") || utils.ContainsI(n[i].Name, "wlp") {
-			dockermtu = n[i].MTU
-			logger.Sugar.Infoln("成功获取网卡MTU:", dockermtu)
-			break
+	reportInterfaces()
+	if override > 0 {
+		logger.Sugar.Infoln("使用--mtu指定的MTU:", override)
+		return override
+	}
+
+	iface, err := network.DefaultInterface()
+	if err != nil {
+		logger.Sugar.Infof("获取默认路由网卡失败(%s)，使用默认值: %d", err, network.DefaultMTU)
+		dockermtu = network.DefaultMTU
+	} else {
+		dockermtu = iface.MTU
+		logger.Sugar.Infof("默认路由网卡%s(%s) MTU: %d", iface.Name, iface.Kind, dockermtu)
+		if iface.IsTunnel() {
+			logger.Sugar.Infof("默认路由网卡%s为隧道设备，其MTU已扣除封装开销", iface.Name)
 		}
 	}
-	if dockermtu == 0 {
-		logger.Sugar.Infoln("获取网卡mtu失败，使用默认值: 1500")
-		dockermtu = 1500
+
+	overhead, ok := network.Overhead[overlay]
+	if !ok {
+		logger.Sugar.Fatalf("不支持的overlay类型: %s", overlay)
+	}
+	if overhead > 0 {
+		dockermtu -= overhead
+		logger.Sugar.Infof("%s封装开销%d字节，docker MTU调整为: %d", overlay, overhead, dockermtu)
 	}
 	return
 }
 
-// 默认使用腾讯docker源安装, centos6.X使用YUM RPM安装
+// 输出所有网卡的地址、MTU、速率及链路状态
+func reportInterfaces() {
+	ifaces, err := network.Interfaces()
+	if err != nil {
+		logger.Sugar.Errorln("获取网卡列表失败:", err)
+		return
+	}
+	for _, i := range ifaces {
+		speed := "-"
+		if i.Speed > 0 {
+			speed = fmt.Sprintf("%dMb/s", i.Speed)
+		}
+		logger.Sugar.Infof("%-16s kind=%-8s mtu=%-5d speed=%-9s state=%-8s addrs=%s",
+			i.Name, i.Kind, i.MTU, speed, i.OperState, strings.Join(i.Addrs, ","))
+	}
+}
+
+const (
+	dockerVersion    = "20.10.16"
+	centos6DockerRPM = "https://get.docker.com/rpm/1.7.1/centos-6/RPMS/x86_64/docker-engine-1.7.1-1.el6.x86_64.rpm"
+)
+
+// docker软件包名称
+func dockerPkg(osInfo *os.Data) string {
+	if osInfo.IsCentOS6() {
+		return "docker-engine"
+	} else if osInfo.IsLikeFedora() {
+		return "docker-ce-" + dockerVersion
+	}
+	return "docker-ce"
+}
+
+// 添加docker-ce软件源，使用离线包时跳过
+func addDockerRepo(osInfo *os.Data) {
+	if offline != nil || osInfo.IsCentOS6() {
+		return
+	}
+	data := newRepoData(osInfo)
+	spec := &repoSpec{Name: "docker-ce", Check: true}
+	if osInfo.IsLikeFedora() {
+		spec.URL = data.DockerCE + "/linux/centos/$releasever/$basearch/stable"
+		spec.Key = data.DockerCE + "/linux/centos/gpg"
+	} else {
+		_, _ = pkgExec("apt-get install -y apt-transport-https ca-certificates curl").Stdout()
+		spec.URL = data.DockerCE + "/linux/ubuntu"
+		spec.Suite = data.Codename
+		spec.Components = []string{"stable"}
+		spec.Arch = debArch(osInfo)
+		spec.Key = data.DockerCE + "/linux/ubuntu/gpg"
+		// 旧版本通过apt-key添加的docker.list
+		_ = nos.Remove(script.Path("/etc/apt/sources.list.d/docker.list"))
+	}
+	if err := addRepo(osInfo, spec); err != nil {
+		logger.Sugar.Errorln("添加docker-ce软件源失败:", err)
+		return
+	}
+	if osInfo.IsLikeDebian() {
+		refreshRepoCache(osInfo)
+	}
+}
+
+// 默认使用--mirror镜像站的docker源安装, centos6.X使用YUM RPM安装
 // 默认安装版本: default:20.10.16, centos6.X:1.7.1;
-func installDocker(osInfo *os.Data) {
+func installDocker(osInfo *os.Data, mtuOverride int, overlay string) {
 	logger.Sugar.Infof("开始在%s%s系统安装docker", osInfo.ID, osInfo.VersionID)
 	_ = utils.MustMakeDir("/etc/docker/")
 	_ = utils.MustMakeDir("/www/docker/")
 	time.Sleep(time.Duration(1) * time.Second)
-	dockerVersion := "20.10.16"
-	mtu := checkMtu()
+	mtu := checkMtu(mtuOverride, overlay)
 	dockerConf := fmt.Sprintf(`{
     "mtu": %d,
     "bip": "10.254.0.1/16",
@@ -582,60 +648,60 @@ func installDocker(osInfo *os.Data) {
 		logger.Sugar.Fatal("写入docker配置文件失败，请检查")
 	}
 	if osInfo.IsLikeFedora() && !osInfo.IsCentOS6() {
-		_, _ = script.Exec("sudo yum install -y yum-utils").Stdout()
-		_, _ = script.Exec("sudo yum-config-manager --add-repo https://mirrors.cloud.tencent.com/docker-ce/linux/centos/docker-ce.repo").Stdout()
-		_, err := script.Exec("sudo yum install -y docker-ce-" + dockerVersion).Stdout()
+		addDockerRepo(osInfo)
+		_, err := pkgInstall(osInfo, dockerPkg(osInfo)).Stdout()
 		if err != nil {
 			logger.Sugar.Fatalf("安装docker-%s失败:%s", dockerVersion, err)
 		} else {
 			logger.Sugar.Infoln("安装docker成功", dockerVersion)
 		}
 	} else if osInfo.IsLikeDebian() {
-		nickName, err := script.Exec("lsb_release -cs").First(1).String()
-		if err != nil {
-			logger.Sugar.Fatalf("获取%s%s版本代号失败,docker安装退出:%s", osInfo.ID, osInfo.VersionID, err)
-
-		}
-		osNickName := strings.Split(nickName, "\n")[0]
-		dockerRepoConf := fmt.Sprintf(`deb [arch=amd64] https://mirrors.cloud.tencent.com/docker-ce/linux/ubuntu %s stable
-`, osNickName)
-		_, _ = script.Exec("sudo apt-get install -y apt-transport-https ca-certificates curl software-properties-common").Stdout()
-		_ = exec.Command("/bin/bash", "-c", "curl -fsSL  https://mirrors.cloud.tencent.com/docker-ce/linux/ubuntu/gpg | apt-key add -").Run()
-		_, _ = script.Echo(dockerRepoConf).WriteFile("/etc/apt/sources.list.d/docker.list")
-		logger.Sugar.Infoln("apt-get update:")
-		_, _ = script.Exec("sudo apt-get update").Stdout()
-		//logger.Sugar.Infof("apt-get install -y docker-ce=5:20.10.16~3-0~ubuntu-%s:", osNickName)
-		//script.Exec("sudo apt-get install -y docker-ce=5:20.10.16~3-0~ubuntu-" + osNickName).Stdout()
+		addDockerRepo(osInfo)
 		logger.Sugar.Infof("apt-get install -y docker-ce")
-		_, _ = script.Exec("sudo apt-get install -y docker-ce").Stdout()
+		_, _ = pkgInstall(osInfo, dockerPkg(osInfo)).Stdout()
 		//修复swap limit警告，参考https://docs.docker.com/engine/install/linux-postinstall/
-		_ = utils.Replace("/etc/default/grub", "GRUB_CMDLINE_LINUX=\"\"", "GRUB_CMDLINE_LINUX=\"cgroup_enable=memory swapaccount=1\"")
-		_ = exec.Command("/bin/bash", "-c", "update-grub && apt autoremove -y && apt autoclean -y").Run()
+		if changed, err := setGrubCmdline("cgroup_enable=memory", "swapaccount=1"); err != nil {
+			reportWarning("修改%s失败: %s", grubDefault, err)
+		} else if changed {
+			if _, err := script.CommandAsRoot("update-grub").String(); err != nil {
+				reportWarning("update-grub失败，swap limit设置需手动更新grub后重启生效: %s", err)
+			}
+		}
+		pkgCommand("apt-get", "autoremove", "-y").Wait()
+		pkgCommand("apt-get", "autoclean", "-y").Wait()
 	}
 	if osInfo.IsCentOS6() {
-		_, _ = script.Exec("yum install -y https://get.docker.com/rpm/1.7.1/centos-6/RPMS/x86_64/docker-engine-1.7.1-1.el6.x86_64.rpm").Stdout()
-		_, _ = script.Exec("sudo chkconfig docker on").Stdout()
+		if offline != nil {
+			_, _ = pkgInstall(osInfo, dockerPkg(osInfo)).Stdout()
+		} else {
+			_, _ = pkgCommand("yum", "install", "-y", centos6DockerRPM).Stdout()
+		}
+		_, _ = script.ExecAsRoot("chkconfig docker on").Stdout()
 		//docker1.7配置文件:/etc/sysconfig/docker
-		err := utils.Replace("/etc/sysconfig/docker", "other_args=\"\"", "other_args=\"--graph=/www/docker\"")
+		f, err := conf.LoadKeyValue("/etc/sysconfig/docker", "=")
+		if err == nil {
+			f.Set("other_args", `"--graph=/www/docker"`)
+			_, err = f.Save()
+		}
 		if err != nil {
 			logger.Sugar.Fatal(err)
 		}
-		_, err = script.Exec("sudo /etc/init.d/docker restart").Stdout()
+		_, err = script.ExecAsRoot("/etc/init.d/docker restart").Stdout()
 		if err != nil {
 			logger.Sugar.Fatal("启动docker服务失败,安装docker退出", err)
 		} else {
 			logger.Sugar.Infoln("docker info:")
-			_, _ = script.Exec("sudo docker info").Stdout()
+			_, _ = script.ExecAsRoot("docker info").Stdout()
 		}
 	} else {
-		p := script.Exec("sudo systemctl restart docker")
+		p := script.ExecAsRoot("systemctl restart docker")
 		p.Wait()
-		_, err := script.Exec("sudo systemctl enable docker --now").Stdout()
+		_, err := script.ExecAsRoot("systemctl enable docker --now").Stdout()
 		if err != nil {
 			logger.Sugar.Fatal("启动docker服务失败,安装docker退出", err)
 		} else {
 			logger.Sugar.Infoln("docker info:")
-			_, _ = script.Exec("sudo docker info").Stdout()
+			_, _ = script.ExecAsRoot("docker info").Stdout()
 		}
 	}
 }
@@ -646,14 +712,130 @@ func checkUserPermission() {
 	}
 }
 
+// autoUpgradesConf Ubuntu自动更新的配置文件，init期间暂停自动更新，避免与apt-get争用dpkg锁
+const autoUpgradesConf = "/etc/apt/apt.conf.d/20auto-upgrades"
+
+// autoUpgradeKeys 需要暂停的自动更新配置项
+var autoUpgradeKeys = []string{"APT::Periodic::Update-Package-Lists", "APT::Periodic::Unattended-Upgrade"}
+
+// autoUpgradeSaved 暂停前的配置项的值，init结束时恢复
+var autoUpgradeSaved = map[string]string{}
+
 func disableUbuntuAutoUpgrade(osInfo *os.Data) {
-	if osInfo.IsUbuntu() {
-		_ = utils.Replace("/etc/apt/apt.conf.d/20auto-upgrades", "1", "0")
+	if !osInfo.IsUbuntu() {
+		return
+	}
+	f, err := conf.LoadAptConf(autoUpgradesConf)
+	if err != nil {
+		logger.Sugar.Warnf("读取%s失败: %s", autoUpgradesConf, err)
+		return
+	}
+	for _, key := range autoUpgradeKeys {
+		if v, ok := f.Get(key); ok && v != "0" {
+			autoUpgradeSaved[key] = v
+			f.Set(key, "0")
+		}
+	}
+	if _, err := f.Save(); err != nil {
+		logger.Sugar.Warnf("暂停Ubuntu自动更新失败: %s", err)
+		autoUpgradeSaved = map[string]string{}
 	}
 }
 
+// 恢复disableUbuntuAutoUpgrade暂停的自动更新，未暂停的配置项保持不变
 func enableUbuntuAutoUpgrade(osInfo *os.Data) {
-	if osInfo.IsUbuntu() {
-		_ = utils.Replace("/etc/apt/apt.conf.d/20auto-upgrades", "0", "1")
+	if !osInfo.IsUbuntu() || len(autoUpgradeSaved) == 0 {
+		return
+	}
+	f, err := conf.LoadAptConf(autoUpgradesConf)
+	if err != nil {
+		logger.Sugar.Warnf("读取%s失败: %s", autoUpgradesConf, err)
+		return
+	}
+	for key, v := range autoUpgradeSaved {
+		f.Set(key, v)
+	}
+	if _, err := f.Save(); err != nil {
+		logger.Sugar.Warnf("恢复Ubuntu自动更新失败: %s", err)
+	}
+}
+
+// 设置key=value格式的配置文件中的配置项，sep为写入时key与value之间的分隔符，文件不存在则跳过
+func setConf(path, sep, key, value string) {
+	f, err := conf.LoadKeyValue(path, sep)
+	if err == nil && f.Exists() {
+		f.Set(key, value)
+		_, err = f.Save()
+	}
+	if err != nil {
+		reportWarning("修改%s中的%s失败: %s", path, key, err)
+	}
+}
+
+// grubDefault grub的默认配置，update-grub据此生成grub.cfg
+const grubDefault = "/etc/default/grub"
+
+// 将内核参数args合并到grubDefault的GRUB_CMDLINE_LINUX，返回是否修改，文件不存在时跳过
+func setGrubCmdline(args ...string) (bool, error) {
+	f, err := conf.LoadKeyValue(grubDefault, "=")
+	if err != nil || !f.Exists() {
+		return false, err
+	}
+	value, _ := f.Get("GRUB_CMDLINE_LINUX")
+	if !f.Set("GRUB_CMDLINE_LINUX", mergeKernelArgs(value, args)) {
+		return false, nil
+	}
+	return f.Save()
+}
+
+// 合并引号内的内核参数，同名参数替换为args中的值，其他参数保留，保持原来的引号
+func mergeKernelArgs(value string, args []string) string {
+	value = strings.TrimSpace(value)
+	quote := `"`
+	if n := len(value); n >= 2 && (value[0] == '"' || value[0] == '\'') && value[n-1] == value[0] {
+		quote, value = value[:1], value[1:n-1]
+	}
+	fields := strings.Fields(value)
+	for _, arg := range args {
+		name, _, _ := strings.Cut(arg, "=")
+		found := false
+		for i, f := range fields {
+			if n, _, _ := strings.Cut(f, "="); n == name {
+				fields[i], found = arg, true
+			}
+		}
+		if !found {
+			fields = append(fields, arg)
+		}
+	}
+	return quote + strings.Join(fields, " ") + quote
+}
+
+// systemdSystemConf systemd的全局配置文件
+const systemdSystemConf = "/etc/systemd/system.conf"
+
+// 设置/etc/systemd/system.conf中[Manager]的配置项，已有其他值时也会修改，需重启或daemon-reexec后生效
+func setSystemdManager(settings map[string]string) {
+	f, err := conf.LoadINI(systemdSystemConf)
+	if err != nil {
+		reportWarning("读取%s失败: %s", systemdSystemConf, err)
+		return
+	}
+	if !f.Exists() {
+		return
+	}
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		f.Set("Manager", k, settings[k])
+	}
+	changed, err := f.Save()
+	if err != nil {
+		reportWarning("修改%s失败: %s", systemdSystemConf, err)
+	} else if changed {
+		logger.Sugar.Infof("已修改%s，重启后生效", systemdSystemConf)
 	}
 }
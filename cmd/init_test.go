@@ -0,0 +1,373 @@
+package cmd
+
+import (
+	nos "os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"stkey/internal/content"
+	"stkey/pkg/logger"
+	"stkey/pkg/script"
+	"strings"
+	"testing"
+)
+
+func TestUpdateKernel(t *testing.T) {
+	ipvs := []string{"ip_vs", "ip_vs_rr", "ip_vs_wrr", "ip_vs_sh", "nf_conntrack"}
+	tests := []struct {
+		name  string
+		files map[string]string
+		fake  *script.Fake
+		// modules 写入modulePath并加载的内核模块
+		modules []string
+		// rcLocal 开机加载模块的rc.local，""为不写入
+		rcLocal  string
+		warnings int
+	}{
+		{
+			name:    "centos7 without br_netfilter",
+			files:   centos7Files,
+			fake:    script.NewFake().On(`^sysctl -p$`, "vm.swappiness = 0\n", 0),
+			modules: ipvs,
+			rcLocal: "/etc/rc.d/rc.local",
+		},
+		{
+			name: "centos7 with backported br_netfilter",
+			files: withFiles(centos7Files, map[string]string{
+				"/lib/modules/3.10.0-1160.el7.x86_64/modules.dep": "kernel/net/bridge/br_netfilter.ko.xz: kernel/net/bridge/bridge.ko.xz\n",
+			}),
+			fake:    script.NewFake().On(`^sysctl -p$`, "vm.swappiness = 0\n", 0),
+			modules: append([]string{"br_netfilter"}, ipvs...),
+			rcLocal: "/etc/rc.d/rc.local",
+		},
+		{
+			name:    "ubuntu22",
+			files:   ubuntu22Files,
+			fake:    script.NewFake().On(`^sysctl -p$`, "vm.swappiness = 0\n", 0),
+			modules: append([]string{"br_netfilter"}, ipvs...),
+		},
+		{
+			name:  "ubuntu22 with unknown sysctl keys",
+			files: ubuntu22Files,
+			fake: script.NewFake().Add(script.FakeRule{
+				Pattern:  regexp.MustCompile(`^sysctl -p$`),
+				Stderr:   "sysctl: cannot stat /proc/sys/net/ipv4/tcp_tw_recycle: No such file or directory\n",
+				ExitCode: 255,
+			}),
+			modules:  append([]string{"br_netfilter"}, ipvs...),
+			warnings: 1,
+		},
+		{
+			name:  "in container",
+			files: withFiles(ubuntu22Files, map[string]string{"/.dockerenv": ""}),
+			fake:  script.NewFake(),
+			// 容器中跳过，不加载模块
+			warnings: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fake.On(`^(modprobe|chmod) `, "", 0)
+			h := newTestHost(t, tt.files, tt.fake)
+			updateKernel(h.info)
+
+			var loaded []string
+			for _, c := range h.commands() {
+				if m, ok := strings.CutPrefix(c, "modprobe "); ok {
+					loaded = append(loaded, m)
+				}
+			}
+			if !reflect.DeepEqual(loaded, tt.modules) {
+				t.Errorf("modprobe %v, want %v", loaded, tt.modules)
+			}
+			if len(tt.modules) == 0 {
+				if len(initWarnings) != tt.warnings {
+					t.Errorf("warnings %q, want %d", initWarnings, tt.warnings)
+				}
+				return
+			}
+			if got, want := h.read(t, h.info.FileMap["modulePath"]), strings.Join(tt.modules, "\n")+"\n"; got != want {
+				t.Errorf("%s = %q, want %q", h.info.FileMap["modulePath"], got, want)
+			}
+			rcLocal := h.read(t, h.info.FileMap["rcLocalPath"])
+			if tt.rcLocal == "" && rcLocal != "" {
+				t.Errorf("%s written on %s: %q", h.info.FileMap["rcLocalPath"], h.info.ID, rcLocal)
+			}
+			if tt.rcLocal != "" && !strings.Contains(rcLocal, "modprobe "+tt.modules[0]+"\n") {
+				t.Errorf("%s = %q, want modprobe lines", tt.rcLocal, rcLocal)
+			}
+			if !strings.Contains(h.read(t, "/etc/sysctl.conf"), "start check kernel") {
+				t.Error("sysctl settings not appended to /etc/sysctl.conf")
+			}
+			if len(initWarnings) != tt.warnings {
+				t.Errorf("warnings %q, want %d", initWarnings, tt.warnings)
+			}
+
+			// 再次执行不重复写入
+			updateKernel(h.info)
+			if got := strings.Count(h.read(t, "/etc/sysctl.conf"), "start check kernel"); got != 1 {
+				t.Errorf("sysctl settings appended %d times, want once", got)
+			}
+			if got, want := h.read(t, h.info.FileMap["modulePath"]), strings.Join(tt.modules, "\n")+"\n"; got != want {
+				t.Errorf("%s after second run = %q, want %q", h.info.FileMap["modulePath"], got, want)
+			}
+		})
+	}
+}
+
+func TestUpdateKernelLogsSysctl(t *testing.T) {
+	h := newTestHost(t, ubuntu22Files, script.NewFake().On(`^sysctl -p$`, "vm.swappiness = 0\nvm.max_map_count = 262144\n", 0))
+	log := filepath.Join(t.TempDir(), "ops.log")
+	if err := logger.OpenFile(log); err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Init()
+	updateKernel(h.info)
+	b, err := nos.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"vm.swappiness = 0", "vm.max_map_count = 262144"} {
+		if !strings.Contains(string(b), `"msg":"`+line+`"`) {
+			t.Errorf("sysctl -p output %q not in the log file:\n%s", line, b)
+		}
+	}
+}
+
+func TestGetRepo(t *testing.T) {
+	yum := script.NewFake().On(`^yum`, "", 0)
+	tests := []struct {
+		name  string
+		files map[string]string
+		fake  *script.Fake
+		// repos 写入的仓库文件及其应包含的内容
+		repos map[string]string
+		// removed 应被删除的文件，kept 应保留的文件
+		removed  []string
+		kept     []string
+		commands []string
+	}{
+		{
+			name:  "centos6",
+			files: centos6Files,
+			fake:  yum,
+			repos: map[string]string{
+				"/etc/yum.repos.d/CentOS-Base.repo": "https://mirrors.cloud.tencent.com/centos-vault/6.10/",
+				"/etc/yum.repos.d/epel.repo":        "https://mirrors.cloud.tencent.com/epel-archive/6/",
+			},
+			commands: []string{"yum clean all", "yum makecache", "yum repolist"},
+		},
+		{
+			name: "centos7",
+			files: withFiles(centos7Files, map[string]string{
+				"/etc/yum.repos.d/docker-ce.repo": "[docker-ce-stable]\n",
+			}),
+			fake: yum,
+			repos: map[string]string{
+				"/etc/yum.repos.d/CentOS-Base.repo": "https://mirrors.cloud.tencent.com/centos",
+				"/etc/yum.repos.d/epel.repo":        "https://mirrors.cloud.tencent.com/epel-archive/7/",
+			},
+			kept: []string{"/etc/yum.repos.d/docker-ce.repo"},
+			commands: []string{"yum clean all", "yum makecache", "yum install yum-complete-transaction -y",
+				"yum-complete-transaction --cleanup-only", "yum repolist"},
+		},
+		{
+			name: "centos8",
+			files: withFiles(centos8Files, map[string]string{
+				"/etc/yum.repos.d/CentOS-Linux-BaseOS.repo": "[baseos]\n",
+				"/etc/yum.repos.d/keep.txt":                 "not a repo\n",
+			}),
+			fake: yum,
+			repos: map[string]string{
+				"/etc/yum.repos.d/CentOS-Base.repo":            "https://mirrors.cloud.tencent.com/centos-vault/8.5.2111/",
+				"/etc/yum.repos.d/CentOS-Epel.repo":            "https://mirrors.cloud.tencent.com/epel/8/Everything/",
+				"/etc/yum.repos.d/CentOS-Linux-AppStream.repo": "AppStream",
+				"/etc/pki/rpm-gpg/RPM-GPG-KEY-EPEL-8":          "BEGIN PGP PUBLIC KEY BLOCK",
+			},
+			removed:  []string{"/etc/yum.repos.d/CentOS-Linux-BaseOS.repo"},
+			kept:     []string{"/etc/yum.repos.d/keep.txt"},
+			commands: []string{"yum clean all", "yum makecache"},
+		},
+		{
+			name:  "ubuntu22",
+			files: ubuntu22Files,
+			fake:  script.NewFake().On(`^apt-get update$`, "", 0),
+			repos: map[string]string{
+				"/etc/apt/sources.list": "https://mirrors.cloud.tencent.com/ubuntu/ jammy main",
+			},
+			commands: []string{"apt-get update"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHost(t, tt.files, tt.fake)
+			getRepo(h.info)
+
+			for path, want := range tt.repos {
+				if got := h.read(t, path); !strings.Contains(got, want) {
+					t.Errorf("%s does not contain %q:\n%s", path, want, got)
+				}
+			}
+			for _, path := range tt.removed {
+				if h.read(t, path) != "" {
+					t.Errorf("%s not removed", path)
+				}
+			}
+			for _, path := range tt.kept {
+				if h.read(t, path) == "" {
+					t.Errorf("%s removed", path)
+				}
+			}
+			if got := h.commands(); !reflect.DeepEqual(got, tt.commands) {
+				t.Errorf("commands %q, want %q", got, tt.commands)
+			}
+		})
+	}
+}
+
+func TestGetRepoOffline(t *testing.T) {
+	h := newTestHost(t, centos7Files, script.NewFake())
+	offline = &offlineBundle{}
+	getRepo(h.info)
+	if got := h.commands(); len(got) != 0 {
+		t.Errorf("commands %q, want none with an offline bundle", got)
+	}
+	if got := h.read(t, "/etc/yum.repos.d/CentOS-Base.repo"); got != "" {
+		t.Errorf("CentOS-Base.repo written with an offline bundle: %q", got)
+	}
+}
+
+func TestUpdateBashrc(t *testing.T) {
+	admin := "[ -z \"$PS1\" ] && return\nexport LANG=en_US.UTF-8\n"
+	sourced := "[ -r /etc/profile.d/ops-terminal.sh ] && . /etc/profile.d/ops-terminal.sh"
+	tests := []struct {
+		name  string
+		files map[string]string
+		// want 全局bashrc更新后的内容
+		rc, want string
+		// profile profile.d中写入的内容，为空表示不写入
+		profile string
+	}{
+		{
+			name: "ubuntu22 with profile.d",
+			files: withFiles(ubuntu22Files, map[string]string{
+				"/etc/profile.d/":  "",
+				"/etc/bash.bashrc": admin + content.TerminalConf,
+			}),
+			rc:      "/etc/bash.bashrc",
+			want:    admin + "\n# BEGIN ops terminal\n" + sourced + "\n# END ops terminal\n",
+			profile: "# BEGIN ops terminal\n" + content.TerminalConf + "# END ops terminal\n",
+		},
+		{
+			name: "centos7 without profile.d",
+			files: withFiles(centos7Files, map[string]string{
+				"/etc/bashrc": admin + content.TerminalConf,
+			}),
+			rc:   "/etc/bashrc",
+			want: admin + "\n# BEGIN ops terminal\n" + content.TerminalConf + "# END ops terminal\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHost(t, tt.files, script.NewFake())
+			for i := 0; i < 2; i++ {
+				updateBashrc()
+				if got := h.read(t, tt.rc); got != tt.want {
+					t.Errorf("run %d: %s =\n%s\nwant\n%s", i+1, tt.rc, got, tt.want)
+				}
+			}
+			if got := h.read(t, "/etc/profile.d/ops-terminal.sh"); got != tt.profile {
+				t.Errorf("ops-terminal.sh =\n%s\nwant\n%s", got, tt.profile)
+			}
+			if !strings.Contains(h.read(t, "/root/.bashrc"), "# BEGIN ops aliases") {
+				t.Error("/root/.bashrc has no aliases block")
+			}
+		})
+	}
+}
+
+func TestUnknownSysctlKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		lines       []string
+		keys        []string
+		onlyUnknown bool
+	}{
+		{
+			name: "old procps",
+			lines: []string{
+				"error: \"net.ipv4.tcp_tw_recycle\" is an unknown key",
+				"error: \"net.bridge.bridge-nf-call-iptables\" is an unknown key",
+			},
+			keys:        []string{"net.ipv4.tcp_tw_recycle", "net.bridge.bridge-nf-call-iptables"},
+			onlyUnknown: true,
+		},
+		{
+			name:        "new procps",
+			lines:       []string{"sysctl: cannot stat /proc/sys/net/ipv4/tcp_tw_recycle: No such file or directory"},
+			keys:        []string{"net.ipv4.tcp_tw_recycle"},
+			onlyUnknown: true,
+		},
+		{
+			name: "other error",
+			lines: []string{
+				"sysctl: cannot stat /proc/sys/net/ipv4/tcp_tw_recycle: No such file or directory",
+				"sysctl: setting key \"kernel.pid_max\": Invalid argument",
+			},
+			keys: []string{"net.ipv4.tcp_tw_recycle"},
+		},
+		// 没有错误输出的失败不能当作仅有未知参数
+		{name: "no stderr"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, onlyUnknown := unknownSysctlKeys(tt.lines)
+			if !reflect.DeepEqual(keys, tt.keys) || onlyUnknown != tt.onlyUnknown {
+				t.Errorf("unknownSysctlKeys() = %q, %v, want %q, %v", keys, onlyUnknown, tt.keys, tt.onlyUnknown)
+			}
+		})
+	}
+}
+
+func TestMergeKernelArgs(t *testing.T) {
+	args := []string{"cgroup_enable=memory", "swapaccount=1"}
+	tests := []struct {
+		value, want string
+	}{
+		{`""`, `"cgroup_enable=memory swapaccount=1"`},
+		{``, `"cgroup_enable=memory swapaccount=1"`},
+		{`"quiet splash"`, `"quiet splash cgroup_enable=memory swapaccount=1"`},
+		{`"swapaccount=0 quiet"`, `"swapaccount=1 quiet cgroup_enable=memory"`},
+		{`'console=ttyS0,115200 $extra'`, `'console=ttyS0,115200 $extra cgroup_enable=memory swapaccount=1'`},
+		{`"cgroup_enable=memory swapaccount=1"`, `"cgroup_enable=memory swapaccount=1"`},
+	}
+	for _, tt := range tests {
+		if got := mergeKernelArgs(tt.value, args); got != tt.want {
+			t.Errorf("mergeKernelArgs(%s) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSetGrubCmdline(t *testing.T) {
+	grub := "GRUB_DEFAULT=0\nGRUB_CMDLINE_LINUX_DEFAULT=\"quiet\"\nGRUB_CMDLINE_LINUX=\"console=tty1\"\n"
+	h := newTestHost(t, withFiles(ubuntu22Files, map[string]string{grubDefault: grub}), script.NewFake())
+	for i, want := range []bool{true, false} {
+		changed, err := setGrubCmdline("cgroup_enable=memory", "swapaccount=1")
+		if err != nil || changed != want {
+			t.Errorf("run %d: setGrubCmdline() = %v, %v, want %v", i+1, changed, err, want)
+		}
+	}
+	want := "GRUB_DEFAULT=0\nGRUB_CMDLINE_LINUX_DEFAULT=\"quiet\"\nGRUB_CMDLINE_LINUX=\"console=tty1 cgroup_enable=memory swapaccount=1\"\n"
+	if got := h.read(t, grubDefault); got != want {
+		t.Errorf("%s =\n%s\nwant\n%s", grubDefault, got, want)
+	}
+
+	// 没有grub时跳过
+	h = newTestHost(t, ubuntu22Files, script.NewFake())
+	if changed, err := setGrubCmdline("swapaccount=1"); changed || err != nil {
+		t.Errorf("setGrubCmdline() without grub = %v, %v", changed, err)
+	}
+	if h.read(t, grubDefault) != "" {
+		t.Errorf("%s created", grubDefault)
+	}
+}
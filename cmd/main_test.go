@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	nos "os"
+	"path/filepath"
+	"stkey/pkg/logger"
+	"stkey/pkg/os"
+	"stkey/pkg/script"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	logger.Init()
+	nos.Exit(m.Run())
+}
+
+// testHost 在临时目录中模拟一台主机: 文件读写均在root下，命令由fake应答并记录，不会修改本机
+type testHost struct {
+	root string
+	info *os.Data
+	rec  *script.Recorder
+}
+
+// 以files(路径到内容)构造根文件系统，以fake应答命令，fake未指定的命令均视为不存在
+func newTestHost(t *testing.T, files map[string]string, fake *script.Fake) *testHost {
+	t.Helper()
+	fake.On(`command -v `, "", 1)
+	h := &testHost{root: t.TempDir(), rec: script.NewRecorder(fake)}
+	for name, text := range files {
+		h.write(t, name, text)
+	}
+	info, err := os.ParseRoot(h.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.info = info
+
+	script.SetRoot(h.root)
+	script.SetExecutor(h.rec)
+	script.SetEscalation(script.EscalationNone)
+	mirrorChoice, repoMirror = defaultMirror, nil
+	offline, initWarnings = nil, nil
+	t.Cleanup(func() {
+		script.SetRoot("")
+		script.SetExecutor(script.OSExecutor{})
+		script.SetEscalation(script.EscalationAuto)
+		mirrorChoice, repoMirror = defaultMirror, nil
+		offline, initWarnings = nil, nil
+	})
+	return h
+}
+
+// write 写入root下的文件，以/结尾时只创建目录
+func (h *testHost) write(t *testing.T, name, text string) {
+	t.Helper()
+	path := filepath.Join(h.root, name)
+	if strings.HasSuffix(name, "/") {
+		if err := nos.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if err := nos.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := nos.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// read 读取root下的文件，不存在时返回""
+func (h *testHost) read(t *testing.T, name string) string {
+	t.Helper()
+	b, err := nos.ReadFile(filepath.Join(h.root, name))
+	if err != nil && !nos.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// commands 返回执行过的命令，忽略检查命令是否存在的command -v
+func (h *testHost) commands() []string {
+	var cmds []string
+	for _, c := range h.rec.Calls() {
+		if s := c.String(); !strings.Contains(s, "command -v") {
+			cmds = append(cmds, s)
+		}
+	}
+	return cmds
+}
+
+// 各发行版的release文件
+var (
+	centos6Files = map[string]string{
+		"/etc/redhat-release":               "CentOS release 6.10 (Final)\n",
+		"/proc/sys/kernel/osrelease":        "2.6.32-754.el6.x86_64\n",
+		"/etc/yum.repos.d/":                 "",
+		"/etc/sysconfig/modules/":           "",
+		"/etc/rc.d/":                        "",
+		"/usr/share/zoneinfo/Asia/Shanghai": "TZif",
+	}
+	centos7Files = map[string]string{
+		"/etc/os-release": `NAME="CentOS Linux"
+VERSION="7 (Core)"
+ID="centos"
+ID_LIKE="rhel fedora"
+VERSION_ID="7"
+PRETTY_NAME="CentOS Linux 7 (Core)"
+`,
+		"/proc/sys/kernel/osrelease":        "3.10.0-1160.el7.x86_64\n",
+		"/etc/yum.repos.d/":                 "",
+		"/etc/sysconfig/modules/":           "",
+		"/etc/rc.d/":                        "",
+		"/usr/share/zoneinfo/Asia/Shanghai": "TZif",
+	}
+	centos8Files = map[string]string{
+		"/etc/os-release": `NAME="CentOS Linux"
+VERSION="8"
+ID="centos"
+ID_LIKE="rhel fedora"
+VERSION_ID="8"
+PRETTY_NAME="CentOS Linux 8"
+`,
+		"/proc/sys/kernel/osrelease":        "4.18.0-348.el8.x86_64\n",
+		"/etc/yum.repos.d/":                 "",
+		"/etc/pki/rpm-gpg/":                 "",
+		"/etc/sysconfig/modules/":           "",
+		"/etc/rc.d/":                        "",
+		"/usr/share/zoneinfo/Asia/Shanghai": "TZif",
+	}
+	ubuntu22Files = map[string]string{
+		"/etc/os-release": `NAME="Ubuntu"
+VERSION="22.04.3 LTS (Jammy Jellyfish)"
+ID=ubuntu
+ID_LIKE=debian
+VERSION_ID="22.04"
+VERSION_CODENAME=jammy
+PRETTY_NAME="Ubuntu 22.04.3 LTS"
+`,
+		"/proc/sys/kernel/osrelease":        "5.15.0-91-generic\n",
+		"/etc/apt/":                         "",
+		"/etc/modules-load.d/":              "",
+		"/usr/share/zoneinfo/Asia/Shanghai": "TZif",
+	}
+)
+
+// 合并多组文件，后面的覆盖前面的
+func withFiles(sets ...map[string]string) map[string]string {
+	files := map[string]string{}
+	for _, set := range sets {
+		for k, v := range set {
+			files[k] = v
+		}
+	}
+	return files
+}
@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	nos "os"
+	"stkey/pkg/logger"
+	"stkey/pkg/mirror"
+	"stkey/pkg/os"
+	"stkey/pkg/script"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultMirror = "tencent"
+
+var (
+	// mirrorChoice --mirror参数: auto|<name>|<url>
+	mirrorChoice = defaultMirror
+	// repoMirror 解析后的镜像站，首次使用时才解析，避免auto在不需要时探测
+	repoMirror *mirror.Mirror
+)
+
+// repoData 渲染content中软件源模板的数据
+type repoData struct {
+	CentOS   string
+	EPEL     string
+	Ubuntu   string
+	DockerCE string
+	Codename string
+	Major    string
+	// Release CentOS仓库的版本目录，EOL版本为vault中的版本
+	Release     string
+	EPELRelease string
+	EPELKey     string
+}
+
+func newRepoData(osInfo *os.Data) *repoData {
+	m := currentMirror(osInfo)
+	d := &repoData{
+		CentOS:   m.RepoURL(mirror.CentOS),
+		EPEL:     m.RepoURL(mirror.EPEL),
+		Ubuntu:   m.RepoURL(ubuntuRepo(osInfo)),
+		DockerCE: m.RepoURL(mirror.DockerCE),
+		Major:    majorVersion(osInfo.VersionID),
+		Release:  "$releasever",
+	}
+	d.EPELRelease = d.Major
+	if eol := osInfo.EOL(); eol != nil {
+		// EOL版本的软件包已从主仓库移除，改用vault；EPEL同样EOL时改用EPEL归档
+		d.CentOS = m.RepoURL(mirror.CentOSVault)
+		d.Release = eol.VaultVersion
+		if eol.EPELVersion != "" {
+			d.EPEL = m.RepoURL(mirror.EPELArchive)
+			d.EPELRelease = eol.EPELVersion
+		}
+	}
+	d.EPELKey = d.EPEL + "/RPM-GPG-KEY-EPEL-" + d.Major
+	if osInfo.IsLikeDebian() {
+		d.Codename = osCodename(osInfo)
+	}
+	return d
+}
+
+// 渲染软件源模板并写入path
+func writeRepoFile(path string, tpl string, data *repoData) {
+	t, err := template.New(path).Option("missingkey=error").Parse(tpl)
+	if err != nil {
+		logger.Sugar.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		logger.Sugar.Fatal(err)
+	}
+	logger.Sugar.Infoln("写入软件源:", path)
+	if _, err := script.Echo(buf.String()).WriteFile(path); err != nil {
+		logger.Sugar.Fatal(err)
+	}
+}
+
+// 获取Debian系发行版代号，如jammy，os-release中没有时使用lsb_release
+func osCodename(osInfo *os.Data) string {
+	if osInfo.Codename != "" {
+		return osInfo.Codename
+	}
+	nickName, err := script.Exec("lsb_release -cs").First(1).String()
+	if err != nil {
+		logger.Sugar.Fatalf("获取%s%s版本代号失败:%s", osInfo.ID, osInfo.VersionID, err)
+	}
+	return strings.Split(nickName, "\n")[0]
+}
+
+// 返回--mirror选择的镜像站，auto时探测并选择最快的镜像站
+func currentMirror(osInfo *os.Data) *mirror.Mirror {
+	if repoMirror != nil {
+		return repoMirror
+	}
+	if mirrorChoice == mirror.Auto {
+		repo, path := probeTarget(osInfo)
+		// 云主机优先使用云厂商内网镜像站，不占用公网带宽
+		if m := mirror.ForCloud(osInfo.Cloud); m != nil {
+			if r := mirror.NewProber().Probe(m, repo, path); r.Err == nil {
+				repoMirror = m
+				logger.Sugar.Infof("使用%s内网镜像站%s", osInfo.Cloud, m.URL)
+				return repoMirror
+			}
+		}
+		results := mirror.NewProber().ProbeAll(mirror.Available(osInfo.Cloud), repo, path)
+		printProbeResults(results)
+		if results[0].Err != nil {
+			logger.Sugar.Warnf("所有镜像站均不可用，使用默认镜像站%s", defaultMirror)
+			repoMirror, _ = mirror.Get(defaultMirror)
+		} else {
+			repoMirror = results[0].Mirror
+		}
+	} else {
+		m, err := mirror.Get(mirrorChoice)
+		if err != nil {
+			logger.Sugar.Fatal(err)
+		}
+		repoMirror = m
+	}
+	logger.Sugar.Infof("使用镜像站%s %s", repoMirror.Name, repoMirror.URL)
+	return repoMirror
+}
+
+// debArch 将uname -m的架构名转换为Debian的架构名
+func debArch(osInfo *os.Data) string {
+	switch osInfo.Arch {
+	case "x86_64":
+		return "amd64"
+	case "i386", "i686":
+		return "i386"
+	case "aarch64":
+		return "arm64"
+	case "armv7l":
+		return "armhf"
+	case "ppc64le":
+		return "ppc64el"
+	}
+	return osInfo.Arch
+}
+
+// ubuntuRepo Ubuntu仓库，amd64和i386以外的架构由ubuntu-ports提供
+func ubuntuRepo(osInfo *os.Data) string {
+	switch debArch(osInfo) {
+	case "amd64", "i386":
+		return mirror.Ubuntu
+	}
+	return mirror.UbuntuPorts
+}
+
+// 探测镜像站时下载的文件，选择与当前系统相关的仓库
+func probeTarget(osInfo *os.Data) (string, string) {
+	if osInfo.IsLikeDebian() {
+		return ubuntuRepo(osInfo), "dists/" + osCodename(osInfo) + "/main/binary-" + debArch(osInfo) + "/Packages.gz"
+	}
+	// EPEL 7及以下已归档，统一探测EPEL 9
+	major := majorVersion(osInfo.VersionID)
+	if n, err := strconv.Atoi(major); err != nil || n < 8 {
+		major = "9"
+	}
+	return mirror.EPEL, major + "/Everything/x86_64/repodata/repomd.xml"
+}
+
+func printProbeResults(results []mirror.Result) {
+	w := tabwriter.NewWriter(nos.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tLATENCY\tTHROUGHPUT\tSTATUS\tURL")
+	for _, r := range results {
+		status := "ok"
+		if r.Err != nil {
+			status = r.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.1f KB/s\t%s\t%s\n", r.Mirror.Name, r.Latency.Round(time.Millisecond),
+			r.Throughput/1024, status, r.URL)
+	}
+	_ = w.Flush()
+}
+
+func buildRepoCmd() *cobra.Command {
+	repoCmd := &cobra.Command{
+		Use:   "repo",
+		Short: "管理YUM/APT软件源及镜像站",
+	}
+
+	mirrorsCmd := &cobra.Command{
+		Use:   "mirrors",
+		Short: "列出内置镜像站，--probe探测各镜像站的延迟及吞吐量",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			probe, _ := cmd.Flags().GetBool("probe")
+			// 云厂商内网镜像站只在对应云主机上列出及探测
+			osInfo := checkGOOS()
+			var cloud string
+			if osInfo != nil {
+				cloud = osInfo.Cloud
+			}
+			if !probe {
+				w := tabwriter.NewWriter(nos.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "NAME\tURL")
+				for _, m := range mirror.Available(cloud) {
+					u := m.URL
+					if u == "" {
+						u = "-"
+					}
+					fmt.Fprintf(w, "%s\t%s\n", m.Name, u)
+				}
+				_ = w.Flush()
+				return
+			}
+			repo, _ := cmd.Flags().GetString("repo")
+			path, _ := cmd.Flags().GetString("path")
+			if repo == "" || path == "" {
+				repo, path = probeTarget(osInfo)
+			}
+			mirrors := mirror.Available(cloud)
+			if extra, _ := cmd.Flags().GetStringSlice("mirror"); len(extra) > 0 {
+				for _, name := range extra {
+					m, err := mirror.Get(name)
+					if err != nil {
+						logger.Sugar.Fatal(err)
+					}
+					mirrors = append(mirrors, m)
+				}
+			}
+			prober := mirror.NewProber()
+			prober.Client.Timeout, _ = cmd.Flags().GetDuration("timeout")
+			printProbeResults(prober.ProbeAll(mirrors, repo, path))
+		},
+	}
+	mirrorsCmd.Flags().Bool("probe", false, "探测各镜像站的延迟及吞吐量，按速度排序")
+	mirrorsCmd.Flags().String("repo", "", "探测的仓库，如ubuntu、epel，默认根据当前系统选择")
+	mirrorsCmd.Flags().String("path", "", "探测下载的仓库内文件路径，需与--repo一起使用")
+	mirrorsCmd.Flags().StringSlice("mirror", nil, "额外探测的内部镜像站URL")
+	mirrorsCmd.Flags().Duration("timeout", 15*time.Second, "每个镜像站的探测超时时间")
+	repoCmd.AddCommand(mirrorsCmd)
+	addRepoManageCmds(repoCmd)
+
+	return repoCmd
+}
@@ -0,0 +1,416 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	nos "os"
+	"path/filepath"
+	"stkey/pkg/logger"
+	"stkey/pkg/os"
+	"stkey/pkg/repo"
+	"stkey/pkg/script"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// repoEntry ops repo list/export输出的软件源
+type repoEntry struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	File       string            `json:"file"`
+	Enabled    bool              `json:"enabled"`
+	URLs       []string          `json:"urls"`
+	Suites     []string          `json:"suites,omitempty"`
+	Components []string          `json:"components,omitempty"`
+	Options    map[string]string `json:"options,omitempty"`
+}
+
+// repoSpec ops repo add添加的软件源
+type repoSpec struct {
+	Name       string
+	URL        string
+	Suite      string
+	Components []string
+	Arch       string
+	// Key 公钥的URL或本地文件
+	Key   string
+	Check bool
+	// NoGPGCheck 不指定公钥时允许添加不校验签名的yum软件源
+	NoGPGCheck bool
+}
+
+func hostYumVars(osInfo *os.Data) map[string]string {
+	basearch := osInfo.Arch
+	if basearch == "i686" {
+		basearch = "i386"
+	}
+	return repo.YumVars(majorVersion(osInfo.VersionID), basearch)
+}
+
+// 读取URL或本地文件
+func readKey(src string) ([]byte, error) {
+	read := script.File
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		read = script.Get
+	}
+	key, err := read(src).String()
+	if err != nil {
+		return nil, fmt.Errorf("获取公钥%s失败: %w", src, err)
+	}
+	return []byte(key), nil
+}
+
+func listRepos(osInfo *os.Data) []repoEntry {
+	var entries []repoEntry
+	if osInfo.IsLikeFedora() {
+		files, err := repo.ReadYumDir(repo.YumReposDir)
+		if err != nil {
+			logger.Sugar.Fatal(err)
+		}
+		for _, f := range files {
+			for _, r := range f.Repos {
+				e := repoEntry{Name: r.ID, Type: "yum", File: f.Path, Enabled: r.Enabled(), Options: map[string]string{}}
+				for _, o := range r.Options {
+					switch o.Key {
+					case "", "enabled":
+					case "baseurl":
+						e.URLs = strings.Fields(o.Value)
+					default:
+						e.Options[o.Key] = o.Value
+					}
+				}
+				if len(e.URLs) == 0 {
+					for _, k := range []string{"metalink", "mirrorlist"} {
+						if u := r.Get(k); u != "" {
+							e.URLs = []string{u}
+						}
+					}
+				}
+				entries = append(entries, e)
+			}
+		}
+		return entries
+	}
+	files, err := repo.ReadAptSources()
+	if err != nil {
+		logger.Sugar.Fatal(err)
+	}
+	for _, f := range files {
+		for _, s := range f.Sources {
+			entries = append(entries, repoEntry{
+				Name:       f.Name(),
+				Type:       strings.Join(s.Types, ","),
+				File:       f.Path,
+				Enabled:    s.Enabled,
+				URLs:       s.URIs,
+				Suites:     s.Suites,
+				Components: s.Components,
+				Options:    s.Options,
+			})
+		}
+	}
+	return entries
+}
+
+// 校验软件源，返回空字符串表示可用
+func checkRepo(osInfo *os.Data, e *repoEntry) string {
+	checker := repo.NewChecker()
+	var err error
+	if e.Type == "yum" {
+		f, _ := repo.ReadYumFile(e.File)
+		if r := f.Repo(e.Name); r != nil {
+			err = checker.CheckYum(r, hostYumVars(osInfo))
+		}
+	} else {
+		err = checker.CheckApt(&repo.AptSource{URIs: e.URLs, Suites: e.Suites})
+	}
+	if err != nil {
+		return strings.ReplaceAll(err.Error(), "\n", "; ")
+	}
+	return ""
+}
+
+// 添加软件源，yum写入/etc/yum.repos.d/<name>.repo，apt写入
+// /etc/apt/sources.list.d/<name>.sources，公钥保存到/etc/apt/keyrings。
+// yum软件源默认校验GPG签名，没有公钥时需要明确指定NoGPGCheck
+func addRepo(osInfo *os.Data, spec *repoSpec) error {
+	if err := repo.CheckName(spec.Name); err != nil {
+		return err
+	}
+	var key []byte
+	if spec.Key != "" {
+		var err error
+		if key, err = readKey(spec.Key); err != nil {
+			return err
+		}
+	}
+	if osInfo.IsLikeFedora() {
+		if key == nil && !spec.NoGPGCheck {
+			return fmt.Errorf("添加yum软件源%s需要--key指定GPG公钥，或使用--no-gpgcheck不校验签名", spec.Name)
+		}
+		r := &repo.YumRepo{ID: spec.Name}
+		r.Set("name", spec.Name)
+		r.Set("baseurl", spec.URL)
+		r.SetEnabled(true)
+		if spec.Check {
+			if err := repo.NewChecker().CheckYum(r, hostYumVars(osInfo)); err != nil {
+				return fmt.Errorf("软件源%s不可用: %w", spec.Name, err)
+			}
+		}
+		if key == nil {
+			logger.Sugar.Warnf("软件源%s不校验GPG签名，无法确认软件包未被篡改", spec.Name)
+			r.Set("gpgcheck", "0")
+		} else {
+			path, err := repo.InstallYumKey(spec.Name, key)
+			if err != nil {
+				return err
+			}
+			r.Set("gpgcheck", "1")
+			r.Set("gpgkey", "file://"+path)
+		}
+		f := &repo.YumFile{Path: filepath.Join(repo.YumReposDir, spec.Name+".repo"), Repos: []*repo.YumRepo{r}}
+		logger.Sugar.Infoln("写入软件源:", f.Path)
+		return f.Write()
+	}
+
+	if spec.NoGPGCheck {
+		return fmt.Errorf("--no-gpgcheck只适用于yum软件源")
+	}
+	s := &repo.AptSource{
+		Types:      []string{"deb"},
+		URIs:       []string{spec.URL},
+		Suites:     []string{spec.Suite},
+		Components: spec.Components,
+		Enabled:    true,
+	}
+	if spec.Suite == "" {
+		s.Suites = []string{osCodename(osInfo)}
+	}
+	if strings.HasSuffix(s.Suites[0], "/") {
+		// flat仓库不能指定components
+		s.Components = nil
+	}
+	s.SetOption("Architectures", spec.Arch)
+	if spec.Check {
+		if err := repo.NewChecker().CheckApt(s); err != nil {
+			return fmt.Errorf("软件源%s不可用: %w", spec.Name, err)
+		}
+	}
+	if key != nil {
+		path, err := repo.InstallAptKey(spec.Name, key)
+		if err != nil {
+			return err
+		}
+		s.SetOption("Signed-By", path)
+	}
+	// 替换旧的同名.list
+	_ = nos.Remove(script.Path(filepath.Join(repo.AptSourcesDir, spec.Name+".list")))
+	f := &repo.AptFile{
+		Path:    filepath.Join(repo.AptSourcesDir, spec.Name+".sources"),
+		Format:  repo.Deb822,
+		Sources: []*repo.AptSource{s},
+	}
+	logger.Sugar.Infoln("写入软件源:", f.Path)
+	return f.Write()
+}
+
+// 删除软件源，yum按repo id删除，apt按文件名删除
+func removeRepo(osInfo *os.Data, name string) error {
+	if osInfo.IsLikeFedora() {
+		files, err := repo.ReadYumDir(repo.YumReposDir)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if !f.Remove(name) {
+				continue
+			}
+			logger.Sugar.Infof("从%s删除软件源%s", f.Path, name)
+			if len(f.Repos) == 0 {
+				return nos.Remove(script.Path(f.Path))
+			}
+			return f.Write()
+		}
+		return fmt.Errorf("软件源%s不存在", name)
+	}
+	f, err := findAptFile(name)
+	if err != nil {
+		return err
+	}
+	if f.Path == repo.AptSourcesList {
+		return fmt.Errorf("不能删除%s，请使用disable", repo.AptSourcesList)
+	}
+	logger.Sugar.Infoln("删除软件源:", f.Path)
+	repo.RemoveAptKey(name)
+	return nos.Remove(script.Path(f.Path))
+}
+
+func setRepoEnabled(osInfo *os.Data, name string, enabled bool) error {
+	if osInfo.IsLikeFedora() {
+		files, err := repo.ReadYumDir(repo.YumReposDir)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if r := f.Repo(name); r != nil {
+				r.SetEnabled(enabled)
+				return f.Write()
+			}
+		}
+		return fmt.Errorf("软件源%s不存在", name)
+	}
+	f, err := findAptFile(name)
+	if err != nil {
+		return err
+	}
+	if !f.SetEnabled(enabled) {
+		if enabled {
+			logger.Sugar.Infof("%s中没有ops禁用的软件源", f.Path)
+		}
+		return nil
+	}
+	return f.Write()
+}
+
+func findAptFile(name string) (*repo.AptFile, error) {
+	files, err := repo.ReadAptSources()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.Name() == name {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("软件源%s不存在", name)
+}
+
+// 刷新软件源缓存
+func refreshRepoCache(osInfo *os.Data) {
+	if osInfo.IsLikeFedora() {
+		logger.Sugar.Infoln("yum makecache生成缓存:")
+		_, _ = pkgExec("yum makecache").Stdout()
+	} else {
+		logger.Sugar.Infoln("apt-get update:")
+		_, _ = pkgExec("apt-get update").Stdout()
+	}
+}
+
+func addRepoManageCmds(repoCmd *cobra.Command) {
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "列出软件源，--check获取元数据校验是否可用",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			osInfo := checkGOOS()
+			check, _ := cmd.Flags().GetBool("check")
+			w := tabwriter.NewWriter(nos.Stdout, 0, 0, 2, ' ', 0)
+			header := "NAME\tTYPE\tENABLED\tFILE\tURL"
+			if check {
+				header += "\tSTATUS"
+			}
+			fmt.Fprintln(w, header)
+			for _, e := range listRepos(osInfo) {
+				line := fmt.Sprintf("%s\t%s\t%t\t%s\t%s", e.Name, e.Type, e.Enabled, e.File, strings.Join(e.URLs, " "))
+				if check {
+					status := "-"
+					if e.Enabled {
+						if status = checkRepo(osInfo, &e); status == "" {
+							status = "ok"
+						}
+					}
+					line += "\t" + status
+				}
+				fmt.Fprintln(w, line)
+			}
+			_ = w.Flush()
+		},
+	}
+	listCmd.Flags().Bool("check", false, "获取已启用软件源的元数据，校验是否可用")
+	repoCmd.AddCommand(listCmd)
+
+	addCmd := &cobra.Command{
+		Use:   "add <name> --url <url>",
+		Short: "添加软件源，写入前获取元数据校验是否可用",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			osInfo := checkGOOS()
+			spec := &repoSpec{Name: args[0]}
+			spec.URL, _ = cmd.Flags().GetString("url")
+			spec.Suite, _ = cmd.Flags().GetString("suite")
+			spec.Components, _ = cmd.Flags().GetStringSlice("components")
+			spec.Arch, _ = cmd.Flags().GetString("arch")
+			spec.Key, _ = cmd.Flags().GetString("key")
+			spec.NoGPGCheck, _ = cmd.Flags().GetBool("no-gpgcheck")
+			noCheck, _ := cmd.Flags().GetBool("no-check")
+			spec.Check = !noCheck
+			if err := addRepo(osInfo, spec); err != nil {
+				logger.Sugar.Fatal(err)
+			}
+			refreshRepoCache(osInfo)
+		},
+	}
+	addCmd.Flags().String("url", "", "yum的baseurl或apt的URI")
+	addCmd.Flags().String("suite", "", "apt的suite，默认为当前系统代号，以/结尾表示flat仓库")
+	addCmd.Flags().StringSlice("components", []string{"main"}, "apt的components")
+	addCmd.Flags().String("arch", "", "apt的Architectures，如amd64")
+	addCmd.Flags().String("key", "", "软件源GPG公钥的URL或本地文件")
+	addCmd.Flags().Bool("no-check", false, "不校验软件源元数据")
+	addCmd.Flags().Bool("no-gpgcheck", false, "不指定--key时添加不校验GPG签名的yum软件源")
+	addCmd.MarkFlagsMutuallyExclusive("key", "no-gpgcheck")
+	_ = addCmd.MarkFlagRequired("url")
+	repoCmd.AddCommand(addCmd)
+
+	repoCmd.AddCommand(&cobra.Command{
+		Use:   "remove <name>",
+		Short: "删除软件源，yum为repo id，apt为sources.list.d下的文件名",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := removeRepo(checkGOOS(), args[0]); err != nil {
+				logger.Sugar.Fatal(err)
+			}
+		},
+	})
+
+	for _, enabled := range []bool{true, false} {
+		enabled := enabled
+		use, short := "enable", "启用软件源"
+		if !enabled {
+			use, short = "disable", "禁用软件源"
+		}
+		repoCmd.AddCommand(&cobra.Command{
+			Use:   use + " <name>",
+			Short: short,
+			Args:  cobra.ExactArgs(1),
+			Run: func(cmd *cobra.Command, args []string) {
+				if err := setRepoEnabled(checkGOOS(), args[0], enabled); err != nil {
+					logger.Sugar.Fatal(err)
+				}
+			},
+		})
+	}
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "以JSON导出软件源定义",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			data, err := json.MarshalIndent(listRepos(checkGOOS()), "", "  ")
+			if err != nil {
+				logger.Sugar.Fatal(err)
+			}
+			out, _ := cmd.Flags().GetString("output")
+			if out == "" {
+				fmt.Println(string(data))
+				return
+			}
+			if err := nos.WriteFile(out, append(data, '\n'), 0644); err != nil {
+				logger.Sugar.Fatal(err)
+			}
+		},
+	}
+	exportCmd.Flags().StringP("output", "o", "", "输出文件，默认输出到标准输出")
+	repoCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	nos "os"
+	"path/filepath"
+	"stkey/pkg/script"
+	"strings"
+	"testing"
+)
+
+func TestAddRemoveRepo(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		spec  repoSpec
+		// repoFile 添加的软件源文件，key 保存的公钥
+		repoFile, key string
+	}{
+		{
+			name:     "yum",
+			files:    withFiles(centos7Files, map[string]string{"/root/docker.gpg": "key"}),
+			spec:     repoSpec{Name: "docker-ce", URL: "https://download.docker.com/linux/centos/7/x86_64/stable", Key: "/root/docker.gpg"},
+			repoFile: "/etc/yum.repos.d/docker-ce.repo",
+			key:      "/etc/pki/rpm-gpg/RPM-GPG-KEY-docker-ce",
+		},
+		{
+			name: "apt",
+			files: withFiles(ubuntu22Files, map[string]string{
+				"/root/docker.gpg":                       "key",
+				"/etc/apt/sources.list.d/docker-ce.list": "deb https://download.docker.com/linux/ubuntu jammy stable\n",
+			}),
+			spec:     repoSpec{Name: "docker-ce", URL: "https://download.docker.com/linux/ubuntu", Suite: "jammy", Components: []string{"stable"}, Key: "/root/docker.gpg"},
+			repoFile: "/etc/apt/sources.list.d/docker-ce.sources",
+			key:      "/etc/apt/keyrings/docker-ce.gpg",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHost(t, tt.files, script.NewFake())
+			exists := func(name string) bool {
+				_, err := nos.Stat(filepath.Join(h.root, name))
+				return err == nil
+			}
+			if err := addRepo(h.info, &tt.spec); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(h.read(t, tt.repoFile), tt.spec.URL) {
+				t.Errorf("%s does not contain %s", tt.repoFile, tt.spec.URL)
+			}
+			if !exists(tt.key) {
+				t.Errorf("key %s not saved under the root", tt.key)
+			}
+			if exists("/etc/apt/sources.list.d/docker-ce.list") {
+				t.Error("old docker-ce.list not replaced")
+			}
+
+			if err := removeRepo(h.info, tt.spec.Name); err != nil {
+				t.Fatal(err)
+			}
+			if exists(tt.repoFile) {
+				t.Errorf("%s not removed", tt.repoFile)
+			}
+		})
+	}
+}
+
+func TestAddYumRepoWithoutKey(t *testing.T) {
+	h := newTestHost(t, centos7Files, script.NewFake())
+	spec := repoSpec{Name: "local", URL: "http://10.0.0.1/centos/7/local"}
+	if err := addRepo(h.info, &spec); err == nil {
+		t.Fatal("addRepo() without key or --no-gpgcheck succeeded")
+	}
+	if _, err := nos.Stat(filepath.Join(h.root, "/etc/yum.repos.d/local.repo")); !nos.IsNotExist(err) {
+		t.Errorf("local.repo written without GPG check: %v", err)
+	}
+
+	spec.NoGPGCheck = true
+	if err := addRepo(h.info, &spec); err != nil {
+		t.Fatal(err)
+	}
+	if repo := h.read(t, "/etc/yum.repos.d/local.repo"); !strings.Contains(repo, "gpgcheck=0\n") {
+		t.Errorf("local.repo =\n%s\nwant gpgcheck=0", repo)
+	}
+
+	h = newTestHost(t, ubuntu22Files, script.NewFake())
+	spec = repoSpec{Name: "local", URL: "http://10.0.0.1/ubuntu", Suite: "jammy", NoGPGCheck: true}
+	if err := addRepo(h.info, &spec); err == nil {
+		t.Error("addRepo() with --no-gpgcheck for apt succeeded")
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"stkey/pkg/script"
+	"testing"
+)
+
+func TestNewRepoData(t *testing.T) {
+	stream8Files := map[string]string{
+		"/etc/os-release": "NAME=\"CentOS Stream\"\nID=\"centos\"\nID_LIKE=\"rhel fedora\"\nVERSION_ID=\"8\"\nPRETTY_NAME=\"CentOS Stream 8\"\n",
+	}
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  repoData
+	}{
+		{
+			name:  "centos6",
+			files: centos6Files,
+			want: repoData{
+				CentOS: "https://mirrors.cloud.tencent.com/centos-vault", Release: "6.10",
+				EPEL: "https://mirrors.cloud.tencent.com/epel-archive", EPELRelease: "6",
+				EPELKey: "https://mirrors.cloud.tencent.com/epel-archive/RPM-GPG-KEY-EPEL-6",
+			},
+		},
+		{
+			name:  "centos7",
+			files: centos7Files,
+			want: repoData{
+				CentOS: "https://mirrors.cloud.tencent.com/centos-vault", Release: "7.9.2009",
+				EPEL: "https://mirrors.cloud.tencent.com/epel-archive", EPELRelease: "7",
+				EPELKey: "https://mirrors.cloud.tencent.com/epel-archive/RPM-GPG-KEY-EPEL-7",
+			},
+		},
+		{
+			// CentOS 8已EOL，EPEL 8仍在维护
+			name:  "centos8",
+			files: centos8Files,
+			want: repoData{
+				CentOS: "https://mirrors.cloud.tencent.com/centos-vault", Release: "8.5.2111",
+				EPEL: "https://mirrors.cloud.tencent.com/epel", EPELRelease: "8",
+				EPELKey: "https://mirrors.cloud.tencent.com/epel/RPM-GPG-KEY-EPEL-8",
+			},
+		},
+		{
+			name:  "centos8 stream",
+			files: stream8Files,
+			want: repoData{
+				CentOS: "https://mirrors.cloud.tencent.com/centos-vault", Release: "8-stream",
+				EPEL: "https://mirrors.cloud.tencent.com/epel", EPELRelease: "8",
+				EPELKey: "https://mirrors.cloud.tencent.com/epel/RPM-GPG-KEY-EPEL-8",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHost(t, tt.files, script.NewFake())
+			d := newRepoData(h.info)
+			got := repoData{CentOS: d.CentOS, Release: d.Release, EPEL: d.EPEL, EPELRelease: d.EPELRelease, EPELKey: d.EPELKey}
+			if got != tt.want {
+				t.Errorf("newRepoData() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeTarget(t *testing.T) {
+	tests := []struct {
+		arch     string
+		wantRepo string
+		wantPath string
+	}{
+		{"x86_64", "ubuntu", "dists/jammy/main/binary-amd64/Packages.gz"},
+		{"aarch64", "ubuntu-ports", "dists/jammy/main/binary-arm64/Packages.gz"},
+		{"ppc64le", "ubuntu-ports", "dists/jammy/main/binary-ppc64el/Packages.gz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arch, func(t *testing.T) {
+			h := newTestHost(t, ubuntu22Files, script.NewFake())
+			h.info.Arch = tt.arch
+			repo, path := probeTarget(h.info)
+			if repo != tt.wantRepo || path != tt.wantPath {
+				t.Errorf("probeTarget() = %s, %s, want %s, %s", repo, path, tt.wantRepo, tt.wantPath)
+			}
+			if got, want := newRepoData(h.info).Ubuntu, "https://mirrors.cloud.tencent.com/"+tt.wantRepo; got != want {
+				t.Errorf("newRepoData().Ubuntu = %s, want %s", got, want)
+			}
+		})
+	}
+}
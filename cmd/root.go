@@ -1,9 +1,36 @@
 package cmd
 
 import (
+	"context"
+	nos "os"
+	"os/signal"
+	"stkey/pkg/logger"
+	"stkey/pkg/script"
+	"syscall"
+	"time"
+
 	"github.com/spf13/cobra"
 )
 
+// 收到中断信号后等待正在执行的命令退出的时间
+const interruptGrace = 10 * time.Second
+
+// Ctrl-C或SIGTERM时终止所有正在执行的外部命令及其子进程后退出
+func handleInterrupt() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	script.SetDefaultContext(ctx)
+	sigs := make(chan nos.Signal, 1)
+	signal.Notify(sigs, nos.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		logger.Sugar.Warnf("收到信号%s，终止正在执行的命令", sig)
+		cancel()
+		script.WaitCommands(interruptGrace)
+		logger.Exit(130)
+	}()
+	return ctx
+}
+
 func Execute() {
 
 	var rootCmd = &cobra.Command{
@@ -11,13 +38,40 @@ func Execute() {
 		Use:     "ops",
 		Short:   "A command-line tool helps with something operation and maintenance work",
 		Long:    `ops是用于进行相关运维工作的CLI工具`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			s, _ := cmd.Flags().GetString("escalation")
+			e, err := script.ParseEscalation(s)
+			if err != nil {
+				logger.Sugar.Fatal(err)
+			}
+			script.SetEscalation(e)
+			if suffix, _ := cmd.Flags().GetString("backup-suffix"); suffix != "" {
+				script.SetBackup(script.BackupSuffix(suffix))
+			}
+			if file, _ := cmd.Flags().GetString("log-file"); file != "" {
+				if err := logger.OpenFile(file); err != nil {
+					logger.Sugar.Fatal("打开日志文件失败:", err)
+				}
+				// 外部命令的每行输出写入日志文件，终端输出不变
+				script.SetLineHandler(script.LogLines(logger.File))
+			}
+		},
 	}
+	rootCmd.PersistentFlags().String("escalation", string(script.EscalationAuto), "需要root权限的命令的提权方式: auto(非root用户使用sudo)|none|sudo")
+	rootCmd.PersistentFlags().String("backup-suffix", "", "修改文件前备份为<文件名><后缀>，如.ops.bak，每个文件只备份首次修改前的内容，为空则不备份")
+	rootCmd.PersistentFlags().String("log-file", "", "以JSON格式追加写入日志的文件，包括外部命令的每行输出(字段step、command、stream)")
 
 	rootCmd.AddCommand(buildInitCmd())
+	rootCmd.AddCommand(buildManifestCmd())
+	rootCmd.AddCommand(buildBundleCmd())
+	rootCmd.AddCommand(buildRepoCmd())
+	rootCmd.AddCommand(buildInfoCmd())
+	rootCmd.AddCommand(buildFactsCmd())
+	rootCmd.AddCommand(buildAuditCmd())
 	//rootCmd.AddCommand(buildSecCmd())
 	//buildSecCmd.AddCommand(buildSecDetect)
 
-	err := rootCmd.Execute()
+	err := rootCmd.ExecuteContext(handleInterrupt())
 	if err != nil {
 		panic(err)
 	}
@@ -9,9 +9,11 @@ import (
 	"github.com/spf13/cobra"
 	"os/user"
 	"runtime"
+	"stkey/pkg/facts"
 	"stkey/pkg/logger"
 	"stkey/pkg/script"
 	"stkey/utils"
+	"strconv"
 	"strings"
 )
 
@@ -115,11 +117,11 @@ func (*Detect) getNet(kind string, pid int32) []net.ConnectionStat {
 }
 
 func (d *Detect) Kill() (string, error) {
-	return script.Exec("kill -9 " + fmt.Sprintf("%d", d.Pid)).String()
+	return script.Command("kill", "-9", strconv.Itoa(int(d.Pid))).String()
 }
 
 func IsThreat(pid, ppid int32) string {
-	data, err := script.Exec("ls -al /proc/" + fmt.Sprintf("%d", pid) + "/fd/").String()
+	data, err := script.Command("ls", "-al", fmt.Sprintf("/proc/%d/fd/", pid)).String()
 	if err != nil || data == "" {
 		return ""
 	}
@@ -128,7 +130,7 @@ func IsThreat(pid, ppid int32) string {
 		return data
 	}
 	if utils.ContainsI(data, "pipe") {
-		data, err := script.Exec("ls -al /proc/" + fmt.Sprintf("%d", ppid) + "/fd/").String()
+		data, err := script.Command("ls", "-al", fmt.Sprintf("/proc/%d/fd/", ppid)).String()
 		if err != nil || data == "" {
 			return ""
 		}
@@ -197,7 +199,7 @@ func (d *Detect) Listener() []*Detect {
 }
 
 func (d *Detect) getStd(id int32, n string) (string, error) {
-	s, err := script.Exec("ls -al  /proc/" + fmt.Sprintf("%d", id) + "/fd/" + n).String()
+	s, err := script.Command("ls", "-al", fmt.Sprintf("/proc/%d/fd/%s", id, n)).String()
 	if s == "" || err != nil {
 		return "", err
 	}
@@ -205,7 +207,7 @@ func (d *Detect) getStd(id int32, n string) (string, error) {
 }
 
 func (d *Detect) getStdout() (string, error) {
-	s, err := script.Exec("ls -al  /proc/" + fmt.Sprintf("%d", d.Pid) + "/fd/1").String()
+	s, err := script.Command("ls", "-al", fmt.Sprintf("/proc/%d/fd/1", d.Pid)).String()
 	if s == "" || err != nil {
 		return "", err
 	}
@@ -213,7 +215,7 @@ func (d *Detect) getStdout() (string, error) {
 }
 
 func (d *Detect) getStderr() (string, error) {
-	s, err := script.Exec("ls -al  /proc/" + fmt.Sprintf("%d", d.Pid) + "/fd/2").String()
+	s, err := script.Command("ls", "-al", fmt.Sprintf("/proc/%d/fd/2", d.Pid)).String()
 	if s == "" || err != nil {
 		return "", err
 	}
@@ -226,25 +228,15 @@ func (d *Detect) getUid(username string) (string, error) {
 }
 
 func (d *Detect) getHostName() (string, error) {
-	h, err := script.Exec("hostname").String()
-	if err != nil || h == "" {
-		return "", err
-	}
-	h = strings.Split(h, "\n")[0]
-	return h, nil
+	return facts.Hostname()
 }
 
 func (d *Detect) getHostIP() (string, error) {
-	h, err := script.Exec("hostname -I").String()
-	if err != nil || h == "" {
-		return "", err
-	}
-	h = strings.Split(h, " ")[0]
-	return h, nil
+	return facts.PrimaryIP(), nil
 }
 
 func (d *Detect) getExecMd5(cmd string) (string, error) {
-	return script.Exec("md5sum " + cmd).String()
+	return script.Command("md5sum", "--", cmd).String()
 }
 
 func (d *Detect) getType(cmdline string) string {
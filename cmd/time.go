@@ -0,0 +1,323 @@
+package cmd
+
+import (
+	"path/filepath"
+	"regexp"
+	"stkey/internal/content"
+	"stkey/pkg/chrony"
+	"stkey/pkg/logger"
+	"stkey/pkg/os"
+	"stkey/pkg/script"
+	"stkey/utils"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/slices"
+)
+
+const zoneInfoDir = "/usr/share/zoneinfo"
+
+// chronyd无响应时chronyc会一直重试，限制单次查询时间
+const chronycTimeout = 10 * time.Second
+
+// 与chrony争抢时钟的时间同步服务
+var competingTimeDaemons = []string{"systemd-timesyncd", "ntpd", "ntp", "ntpsec", "openntpd"}
+
+var (
+	defaultFedoraNtpServers = []string{"ntp.aliyun.com", "ntp.tencent.com", "time.windows.com", "time.cloudflare.com"}
+	defaultDebianNtpPools   = []string{
+		"ntp.aliyun.com iburst maxsources 4",
+		"ntp.tencent.com iburst maxsources 1",
+		"time.windows.com iburst maxsources 1",
+		"time.cloudflare.com iburst maxsources 2",
+	}
+	// cloudNtpServers 云厂商内网的NTP服务，优先于迁移的及默认的NTP服务器
+	cloudNtpServers = map[string][]string{
+		os.CloudAliyun:  {"ntp.cloud.aliyuncs.com", "ntp7.cloud.aliyuncs.com", "ntp8.cloud.aliyuncs.com"},
+		os.CloudTencent: {"time1.tencentyun.com", "time2.tencentyun.com", "time3.tencentyun.com"},
+		os.CloudHuawei:  {"ntp.myhuaweicloud.com"},
+		os.CloudAWS:     {"169.254.169.123 prefer iburst minpoll 4 maxpoll 4"},
+		os.CloudGCE:     {"metadata.google.internal prefer iburst"},
+	}
+	// cloudRefClocks 通过虚拟化PTP时钟同步的云厂商
+	cloudRefClocks = map[string][]string{
+		os.CloudAzure: {"PHC /dev/ptp_hyperv poll 3 dpoll -2 offset 0 stratum 2"},
+	}
+)
+
+// timeOptions init time的相关参数
+type timeOptions struct {
+	Timezone     string
+	Servers      []string
+	Pools        []string
+	Allow        []string
+	Deny         []string
+	LocalStratum int
+	SyncTimeout  time.Duration
+}
+
+func addTimeFlags(cmd *cobra.Command) {
+	cmd.Flags().String("timezone", "Asia/Shanghai", "设置时区")
+	cmd.Flags().StringSlice("ntp-server", []string{}, "chrony server列表，未指定server和pool时使用内置公网NTP服务器")
+	cmd.Flags().StringSlice("ntp-pool", []string{}, "chrony pool列表")
+	cmd.Flags().StringSlice("ntp-allow", []string{}, "允许作为NTP客户端访问本机的网段，设置后本机作为内网NTP服务器")
+	cmd.Flags().StringSlice("ntp-deny", []string{}, "禁止访问本机NTP服务的网段")
+	cmd.Flags().Int("ntp-local-stratum", 10, "作为NTP服务器时上游不可达仍以该stratum提供服务，0为不启用")
+	cmd.Flags().Duration("sync-timeout", 60*time.Second, "等待chrony完成同步的超时时间，0为不检查")
+}
+
+func getTimeOptions(cmd *cobra.Command) *timeOptions {
+	opts := &timeOptions{}
+	opts.Timezone, _ = cmd.Flags().GetString("timezone")
+	opts.Servers, _ = cmd.Flags().GetStringSlice("ntp-server")
+	opts.Pools, _ = cmd.Flags().GetStringSlice("ntp-pool")
+	opts.Allow, _ = cmd.Flags().GetStringSlice("ntp-allow")
+	opts.Deny, _ = cmd.Flags().GetStringSlice("ntp-deny")
+	opts.LocalStratum, _ = cmd.Flags().GetInt("ntp-local-stratum")
+	opts.SyncTimeout, _ = cmd.Flags().GetDuration("sync-timeout")
+	return opts
+}
+
+// 生成chrony配置,未指定server和pool时优先沿用ntp.conf/timesyncd.conf中的服务器,
+// 否则使用各发行版的默认配置
+func chronyConfig(osInfo *os.Data, opts *timeOptions) *chrony.Config {
+	conf := &chrony.Config{
+		Servers:      opts.Servers,
+		Pools:        opts.Pools,
+		Allow:        opts.Allow,
+		Deny:         opts.Deny,
+		LocalStratum: opts.LocalStratum,
+	}
+	if len(conf.Servers) == 0 && len(conf.Pools) == 0 && osInfo.IsCloud() {
+		conf.Servers = cloudNtpServers[osInfo.Cloud]
+		conf.RefClocks = cloudRefClocks[osInfo.Cloud]
+		if len(conf.Servers) > 0 || len(conf.RefClocks) > 0 {
+			logger.Sugar.Infof("检测到云厂商%s，使用其提供的时间同步服务", osInfo.Cloud)
+		}
+	}
+	if len(conf.Servers) == 0 && len(conf.Pools) == 0 && len(conf.RefClocks) == 0 {
+		conf.Servers, conf.Pools = migrateNtpServers()
+	}
+	// 仅有PTP参考时钟的云主机(Azure)不追加公网NTP服务器
+	noServers := len(conf.Servers) == 0 && len(conf.Pools) == 0 && len(conf.RefClocks) == 0
+	if osInfo.IsLikeFedora() {
+		conf.Base = content.FedoraChronyBase
+		if noServers {
+			conf.Servers = defaultFedoraNtpServers
+		}
+	} else {
+		conf.Base = content.DebianChronyBase
+		if noServers {
+			conf.Pools = defaultDebianNtpPools
+		}
+	}
+	return conf
+}
+
+// 安装设置Chrony时间同步
+func syncTime(osInfo *os.Data, opts *timeOptions) {
+	logger.Sugar.Infoln("安装配置chrony时间同步")
+	if !utils.PathExists(filepath.Join(zoneInfoDir, opts.Timezone)) {
+		logger.Sugar.Fatalf("时区%s不存在，请检查", opts.Timezone)
+	}
+
+	ntpConf := "/etc/chrony/chrony.conf"
+	service := "chrony"
+	if osInfo.IsLikeFedora() {
+		ntpConf = "/etc/chrony.conf"
+		service = "chronyd"
+	}
+
+	if !utils.TryCommand("chronyd") {
+		logger.Sugar.Infoln("检测到chrony服务不存在,开始安装chrony")
+		_, err := pkgInstall(osInfo, "chrony").Stdout()
+		if err != nil {
+			logger.Sugar.Fatal(err)
+		}
+	} else {
+		logger.Sugar.Infoln("检测到chrony服务已存在，开始设置chrony服务")
+	}
+	if !utils.PathExists(ntpConf) {
+		logger.Sugar.Fatalf("配置文件%s不存在，请检查chrony服务", ntpConf)
+	}
+	if _, err := script.Echo(chronyConfig(osInfo, opts).Render()).WriteFile(ntpConf); err != nil {
+		logger.Sugar.Fatalf("写入配置文件%s失败:%s", ntpConf, err)
+	}
+	disableTimeDaemons(osInfo)
+
+	if osInfo.IsCentOS6() {
+		_, err := script.ExecAsRoot("/etc/init.d/chronyd restart").Stdout()
+		if err != nil {
+			logger.Sugar.Fatal(err)
+		}
+		_, err = script.ExecAsRoot("chkconfig chronyd on").Stdout()
+		if err != nil {
+			logger.Sugar.Fatal(err)
+		}
+		_, err = script.CommandAsRoot("ln", "-sf", filepath.Join(zoneInfoDir, opts.Timezone), "/etc/localtime").Stdout()
+		if err != nil {
+			logger.Sugar.Infoln("时区设置失败")
+		}
+	} else {
+		_, _ = script.CommandAsRoot("systemctl", "restart", service).Stdout()
+		_, err := script.CommandAsRoot("systemctl", "enable", service, "--now").Stdout()
+		if err != nil {
+			logger.Sugar.Fatal(err)
+		}
+		_, err = script.CommandAsRoot("timedatectl", "set-timezone", opts.Timezone).Stdout()
+		if err != nil {
+			logger.Sugar.Infoln("时区设置失败")
+		}
+	}
+
+	logger.Sugar.Infof("chrony配置文件:%s", ntpConf)
+	script.File(ntpConf).Stdout()
+	reportClockOwner(osInfo, service)
+	if opts.SyncTimeout > 0 {
+		verifyTimeSync(opts.SyncTimeout)
+	}
+	logger.Sugar.Infoln("chrony设置成功")
+}
+
+// 等待chrony完成同步，超时则退出
+func verifyTimeSync(timeout time.Duration) {
+	logger.Sugar.Infof("等待chrony完成同步,超时时间:%s", timeout)
+	deadline := time.Now().Add(timeout)
+	for {
+		out, _ := script.NewPipe().WithEnv("LC_ALL=C").WithTimeout(chronycTimeout).Exec("chronyc tracking").String()
+		tracking, err := chrony.ParseTracking(out)
+		if err == nil && tracking.Synced() {
+			logger.Sugar.Infof("chrony已同步: reference=%s(%s) stratum=%d offset=%s root_delay=%s leap=%s",
+				tracking.ReferenceID, tracking.ReferenceName, tracking.Stratum,
+				tracking.SystemOffset, tracking.RootDelay, tracking.LeapStatus)
+			break
+		}
+		if time.Now().After(deadline) {
+			logChronySources()
+			logger.Sugar.Fatalf("chrony在%s内未完成同步,请检查NTP服务器是否可达", timeout)
+		}
+		time.Sleep(2 * time.Second)
+	}
+	logChronySources()
+}
+
+func logChronySources() {
+	out, _ := script.NewPipe().WithEnv("LC_ALL=C").WithTimeout(chronycTimeout).Exec("chronyc sources").String()
+	sources, err := chrony.ParseSources(out)
+	if err != nil {
+		logger.Sugar.Errorln("解析chronyc sources失败:", err)
+		return
+	}
+	logger.Sugar.Infoln("chrony同步状态:")
+	for _, s := range sources {
+		logger.Sugar.Infof("%s%s %-28s stratum=%-2d poll=%-2d reach=%03o last_rx=%-5s %s",
+			s.Mode, s.State, s.Name, s.Stratum, s.Poll, s.Reach, s.LastRx, s.Sample)
+	}
+}
+
+// 从ntp.conf和timesyncd.conf中读取已有的NTP服务器
+func migrateNtpServers() (servers, pools []string) {
+	for _, path := range []string{"/etc/ntp.conf", "/etc/ntpsec/ntp.conf"} {
+		lines, err := script.File(path).Slice()
+		if err != nil {
+			continue
+		}
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) < 2 || strings.HasPrefix(fields[1], "127.127.") {
+				continue
+			}
+			switch fields[0] {
+			case "server", "peer":
+				servers = appendUnique(servers, fields[1])
+			case "pool":
+				pools = appendUnique(pools, fields[1])
+			}
+		}
+	}
+	lines, _ := script.File("/etc/systemd/timesyncd.conf").MatchRegexp(ntpKeyRegexp).Slice()
+	for _, line := range lines {
+		_, value, _ := strings.Cut(line, "=")
+		for _, s := range strings.Fields(value) {
+			servers = appendUnique(servers, s)
+		}
+	}
+	if len(servers) > 0 || len(pools) > 0 {
+		logger.Sugar.Infof("沿用已有NTP配置中的服务器: server=%v pool=%v", servers, pools)
+	}
+	return
+}
+
+var ntpKeyRegexp = regexp.MustCompile(`^\s*(NTP|FallbackNTP)=`)
+
+func appendUnique(list []string, s string) []string {
+	if slices.Contains(list, s) {
+		return list
+	}
+	return append(list, s)
+}
+
+// 检查服务是否正在运行, CentOS6使用init.d脚本
+func isServiceActive(osInfo *os.Data, name string) bool {
+	var p *script.Pipe
+	if osInfo.IsCentOS6() {
+		if !utils.PathExists("/etc/init.d/" + name) {
+			return false
+		}
+		p = script.Command("/etc/init.d/"+name, "status")
+	} else {
+		p = script.Command("systemctl", "is-active", "--quiet", name)
+	}
+	p.Wait()
+	return p.Error() == nil
+}
+
+// 检查服务是否开机启动
+func isServiceEnabled(osInfo *os.Data, name string) bool {
+	if osInfo.IsCentOS6() {
+		out, _ := script.Command("chkconfig", "--list", name).String()
+		return strings.Contains(out, ":on")
+	}
+	p := script.Command("systemctl", "is-enabled", "--quiet", name)
+	p.Wait()
+	return p.Error() == nil
+}
+
+// 停止并禁用与chrony冲突的时间同步服务
+func disableTimeDaemons(osInfo *os.Data) {
+	for _, name := range competingTimeDaemons {
+		if !isServiceActive(osInfo, name) && !isServiceEnabled(osInfo, name) {
+			continue
+		}
+		logger.Sugar.Infof("检测到时间同步服务%s，停止并禁用", name)
+		if osInfo.IsCentOS6() {
+			_, _ = script.CommandAsRoot("/etc/init.d/"+name, "stop").Stdout()
+			_, _ = script.CommandAsRoot("chkconfig", name, "off").Stdout()
+			continue
+		}
+		if name == "systemd-timesyncd" {
+			_, _ = script.ExecAsRoot("timedatectl set-ntp false").Stdout()
+		}
+		_, _ = script.CommandAsRoot("systemctl", "disable", "--now", name).Stdout()
+		_, _ = script.CommandAsRoot("systemctl", "mask", name).Stdout()
+	}
+}
+
+// 输出最终管理系统时钟的服务
+func reportClockOwner(osInfo *os.Data, service string) {
+	owners := []string{}
+	for _, name := range append([]string{service}, competingTimeDaemons...) {
+		if isServiceActive(osInfo, name) {
+			owners = append(owners, name)
+		}
+	}
+	switch {
+	case len(owners) == 1 && owners[0] == service:
+		logger.Sugar.Infof("系统时钟由%s唯一管理", service)
+	case len(owners) == 0:
+		logger.Sugar.Errorln("没有正在运行的时间同步服务")
+	default:
+		logger.Sugar.Errorf("存在多个时间同步服务同时运行: %v", owners)
+	}
+}
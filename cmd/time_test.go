@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"stkey/pkg/os"
+	"stkey/pkg/script"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+const syncedTracking = `Reference ID    : CA760182 (ntp.aliyun.com)
+Stratum         : 2
+System time     : 0.000001234 seconds slow of NTP time
+Last offset     : +0.000000512 seconds
+Root delay      : 0.021572331 seconds
+Root dispersion : 0.000520937 seconds
+Leap status     : Normal
+`
+
+// chronyFake 应答chrony已安装、已同步，除extra中的服务外没有其他时间同步服务
+func chronyFake(extra ...[3]string) *script.Fake {
+	f := script.NewFake()
+	for _, r := range extra {
+		f.On(r[0], r[1], map[string]int{"ok": 0, "fail": 1}[r[2]])
+	}
+	return f.
+		On(`command -v chronyd`, "/usr/sbin/chronyd\n", 0).
+		On(`^systemctl is-active --quiet chronyd?$`, "", 0).
+		On(`^/etc/init.d/chronyd `, "", 0).
+		On(`^(systemctl (restart|enable|disable|mask)|timedatectl|chkconfig|ln|/etc/init.d/\S+ stop)`, "", 0).
+		On(`^chronyc tracking$`, syncedTracking, 0).
+		On(`^chronyc sources$`, "MS Name/IP address         Stratum Poll Reach LastRx Last sample\n"+
+			"===============================================================================\n"+
+			"^* ntp.aliyun.com                2   6   377    37   +12us[  +15us] +/-  505us\n", 0)
+}
+
+func TestSyncTime(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		fake  *script.Fake
+		opts  timeOptions
+		// conf chrony配置文件及其应包含的行
+		conf  string
+		lines []string
+		// commands 应执行的命令
+		commands []string
+	}{
+		{
+			name:     "centos6",
+			files:    withFiles(centos6Files, map[string]string{"/etc/chrony.conf": "", "/etc/init.d/chronyd": ""}),
+			fake:     chronyFake(),
+			conf:     "/etc/chrony.conf",
+			lines:    []string{"server ntp.aliyun.com iburst", "server time.cloudflare.com iburst"},
+			commands: []string{"/etc/init.d/chronyd restart", "chkconfig chronyd on", "ln -sf /usr/share/zoneinfo/Asia/Shanghai /etc/localtime"},
+		},
+		{
+			name: "centos6 with ntpd",
+			files: withFiles(centos6Files, map[string]string{
+				"/etc/chrony.conf": "", "/etc/init.d/chronyd": "", "/etc/init.d/ntpd": "",
+				"/etc/ntp.conf": "server 10.0.0.1 iburst\nserver 127.127.1.0\n",
+			}),
+			fake:     chronyFake([3]string{`^chkconfig --list ntpd$`, "ntpd 0:off 1:off 2:on 3:on 4:on 5:on 6:off\n", "ok"}),
+			conf:     "/etc/chrony.conf",
+			lines:    []string{"server 10.0.0.1 iburst"},
+			commands: []string{"/etc/init.d/ntpd stop", "chkconfig ntpd off", "/etc/init.d/chronyd restart"},
+		},
+		{
+			name:     "centos7",
+			files:    withFiles(centos7Files, map[string]string{"/etc/chrony.conf": "server 0.centos.pool.ntp.org iburst\n"}),
+			fake:     chronyFake(),
+			conf:     "/etc/chrony.conf",
+			lines:    []string{"server ntp.aliyun.com iburst", "driftfile /var/lib/chrony/drift"},
+			commands: []string{"systemctl restart chronyd", "systemctl enable chronyd --now", "timedatectl set-timezone Asia/Shanghai"},
+		},
+		{
+			name:  "centos7 with servers",
+			files: withFiles(centos7Files, map[string]string{"/etc/chrony.conf": ""}),
+			fake:  chronyFake(),
+			opts: timeOptions{
+				Servers: []string{"10.0.0.1", "10.0.0.2 prefer"},
+				Allow:   []string{"10.0.0.0/8"}, LocalStratum: 10,
+			},
+			conf:     "/etc/chrony.conf",
+			lines:    []string{"server 10.0.0.1 iburst", "server 10.0.0.2 prefer", "allow 10.0.0.0/8", "local stratum 10"},
+			commands: []string{"systemctl restart chronyd"},
+		},
+		{
+			name:  "ubuntu22 with timesyncd",
+			files: withFiles(ubuntu22Files, map[string]string{"/etc/chrony/chrony.conf": ""}),
+			fake: chronyFake(
+				[3]string{`^systemctl is-active --quiet systemd-timesyncd$`, "", "ok"},
+				[3]string{`^systemctl is-active --quiet chrony$`, "", "ok"},
+			),
+			conf:  "/etc/chrony/chrony.conf",
+			lines: []string{"pool ntp.aliyun.com iburst maxsources 4", "keyfile /etc/chrony/chrony.keys"},
+			commands: []string{"timedatectl set-ntp false", "systemctl disable --now systemd-timesyncd",
+				"systemctl mask systemd-timesyncd", "systemctl restart chrony", "systemctl enable chrony --now"},
+		},
+		{
+			name:  "ubuntu22 without chrony",
+			files: withFiles(ubuntu22Files, map[string]string{"/etc/chrony/chrony.conf": ""}),
+			fake: chronyFake(
+				[3]string{`command -v chronyd`, "", "fail"},
+				[3]string{`command -v apt-get`, "/usr/bin/apt-get\n", "ok"},
+				[3]string{`^apt-get -y install chrony$`, "", "ok"},
+			),
+			conf:     "/etc/chrony/chrony.conf",
+			lines:    []string{"pool ntp.aliyun.com iburst maxsources 4"},
+			commands: []string{"apt-get -y install chrony", "systemctl restart chrony"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHost(t, tt.files, tt.fake)
+			opts := tt.opts
+			opts.Timezone = "Asia/Shanghai"
+			opts.SyncTimeout = time.Second
+			syncTime(h.info, &opts)
+
+			conf := h.read(t, tt.conf)
+			for _, line := range tt.lines {
+				if !slices.Contains(strings.Split(conf, "\n"), line) {
+					t.Errorf("%s does not contain %q:\n%s", tt.conf, line, conf)
+				}
+			}
+			cmds := h.commands()
+			for _, c := range tt.commands {
+				if !slices.Contains(cmds, c) {
+					t.Errorf("command %q not run, commands: %q", c, cmds)
+				}
+			}
+		})
+	}
+}
+
+func TestChronyConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		osInfo  *os.Data
+		opts    timeOptions
+		servers []string
+		pools   []string
+		clocks  []string
+	}{
+		{
+			name:    "aliyun",
+			osInfo:  &os.Data{ID: "centos", VersionID: "7", Cloud: os.CloudAliyun},
+			servers: cloudNtpServers[os.CloudAliyun],
+		},
+		{
+			name:   "azure refclock only",
+			osInfo: &os.Data{ID: "ubuntu", VersionID: "22.04", Cloud: os.CloudAzure},
+			clocks: cloudRefClocks[os.CloudAzure],
+		},
+		{
+			name:    "servers override the cloud",
+			osInfo:  &os.Data{ID: "ubuntu", VersionID: "22.04", Cloud: os.CloudAzure},
+			opts:    timeOptions{Servers: []string{"10.0.0.1"}},
+			servers: []string{"10.0.0.1"},
+		},
+		{
+			name:   "no cloud",
+			osInfo: &os.Data{ID: "ubuntu", VersionID: "22.04"},
+			pools:  defaultDebianNtpPools,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestHost(t, ubuntu22Files, script.NewFake())
+			conf := chronyConfig(tt.osInfo, &tt.opts)
+			if !slices.Equal(conf.Servers, tt.servers) || !slices.Equal(conf.Pools, tt.pools) || !slices.Equal(conf.RefClocks, tt.clocks) {
+				t.Errorf("chronyConfig() servers %q pools %q refclocks %q, want %q %q %q",
+					conf.Servers, conf.Pools, conf.RefClocks, tt.servers, tt.pools, tt.clocks)
+			}
+		})
+	}
+}
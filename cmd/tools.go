@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	nos "os"
+	"os/user"
+	"path/filepath"
+	"stkey/pkg/logger"
+	"stkey/pkg/manifest"
+	"stkey/pkg/os"
+	"stkey/pkg/script"
+	"stkey/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultManifestURL = "https://s3.load.cool:8000/software/linux-software.json"
+
+// toolsOptions init tools的相关参数
+type toolsOptions struct {
+	ManifestURL string
+	PublicKey   string
+	Parallel    int
+	Timeout     time.Duration
+	Retries     int
+}
+
+func addToolsFlags(cmd *cobra.Command) {
+	cmd.Flags().String("manifest", defaultManifestURL, "工具清单地址，签名地址为<manifest>.sig")
+	cmd.Flags().String("manifest-key", "", "校验工具清单签名的ed25519公钥(base64)，默认使用编译时内置的公钥")
+	cmd.Flags().Int("parallel", 4, "同时下载的工具数量")
+	cmd.Flags().Duration("download-timeout", 10*time.Minute, "单次下载请求的超时时间")
+	cmd.Flags().Int("download-retries", 3, "下载失败后的重试次数")
+}
+
+func getToolsOptions(cmd *cobra.Command) *toolsOptions {
+	opts := &toolsOptions{}
+	opts.ManifestURL, _ = cmd.Flags().GetString("manifest")
+	opts.PublicKey, _ = cmd.Flags().GetString("manifest-key")
+	opts.Parallel, _ = cmd.Flags().GetInt("parallel")
+	opts.Timeout, _ = cmd.Flags().GetDuration("download-timeout")
+	opts.Retries, _ = cmd.Flags().GetInt("download-retries")
+	if opts.PublicKey == "" {
+		opts.PublicKey = manifest.PublicKey
+	}
+	return opts
+}
+
+// 获取并校验工具清单签名，manifestURL可以是本地文件
+func fetchManifest(opts *toolsOptions) ([]byte, []byte, *manifest.Manifest, error) {
+	if opts.PublicKey == "" {
+		return nil, nil, nil, fmt.Errorf("未配置工具清单公钥,请使用--manifest-key指定")
+	}
+	key, err := manifest.ParsePublicKey(opts.PublicKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	read := script.File
+	if strings.HasPrefix(opts.ManifestURL, "http://") || strings.HasPrefix(opts.ManifestURL, "https://") {
+		read = script.Get
+	}
+	data, err := read(opts.ManifestURL).String()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("获取工具清单%s失败: %w", opts.ManifestURL, err)
+	}
+	sig, err := read(opts.ManifestURL + ".sig").String()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("获取工具清单签名失败: %w", err)
+	}
+	if err := manifest.Verify([]byte(data), sig, key); err != nil {
+		return nil, nil, nil, err
+	}
+	m, err := manifest.Parse([]byte(data))
+	return []byte(data), []byte(sig), m, err
+}
+
+func newToolsDownloader(opts *toolsOptions) *utils.Downloader {
+	d := utils.NewDownloader()
+	if offline != nil {
+		// 离线包中的工具通过file://读取
+		t := &http.Transport{}
+		t.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+		d.Client = &http.Client{Transport: t}
+	}
+	d.Timeout = opts.Timeout
+	d.Retries = opts.Retries
+	d.Progress = func(url string, done, total int64) {
+		if total > 0 {
+			logger.Sugar.Infof("下载进度 %s: %d%% (%d/%d)", url, done*100/total, done, total)
+		} else {
+			logger.Sugar.Infof("下载进度 %s: %d bytes", url, done)
+		}
+	}
+	return d
+}
+
+// 下载更新s3存储上的相关工具，清单需经过ed25519签名，每个文件校验SHA-256，
+// 按CPU架构及发行版选择对应的版本，最多同时下载opts.Parallel个工具
+func downloadTools(osInfo *os.Data, opts *toolsOptions) {
+	logger.Sugar.Infoln("检查安装os相关command")
+	if offline != nil {
+		opts.ManifestURL = offline.manifestPath()
+	}
+	_, _, m, err := fetchManifest(opts)
+	if err != nil {
+		logger.Sugar.Errorln("工具清单校验失败:", err)
+		return
+	}
+	d := newToolsDownloader(opts)
+	if opts.Parallel < 1 {
+		opts.Parallel = 1
+	}
+	sem := make(chan struct{}, opts.Parallel)
+	var wg sync.WaitGroup
+
+	platform := hostPlatform(osInfo)
+	for i := range m.Tools {
+		tool := &m.Tools[i]
+		artifact := tool.Select(platform)
+		if artifact == nil {
+			logger.Sugar.Infof("%s没有适用于%s的版本，跳过", tool.Name, platform)
+			continue
+		}
+		if offline != nil {
+			artifact.URL = offline.toolURL(artifact.SHA256)
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			archive := &toolArchive{d: d, tool: tool, artifact: artifact}
+			defer archive.cleanup()
+			for _, _path := range tool.Paths {
+				if err := installTool(d, archive, _path); err != nil {
+					logger.Sugar.Errorf("安装%s到%s失败: %s", tool.Name, _path, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// toolArchive 工具的压缩包，下载及解压到仅当前用户可访问的临时目录，
+// 避免其他用户预先在/tmp放置同名文件或符号链接；安装到多个路径时只下载一次
+type toolArchive struct {
+	d        *utils.Downloader
+	tool     *manifest.Tool
+	artifact *manifest.Artifact
+	dir      string
+	member   string
+	err      error
+}
+
+// 下载压缩包并解压出artifact.Member，返回校验通过的解压文件
+func (a *toolArchive) extract() (string, error) {
+	if a.member != "" || a.err != nil {
+		return a.member, a.err
+	}
+	a.member, a.err = a.fetch()
+	return a.member, a.err
+}
+
+func (a *toolArchive) fetch() (string, error) {
+	// 与下载及解压一样在script.SetRoot设置的根目录下创建
+	base := nos.TempDir()
+	dir, err := nos.MkdirTemp(script.Path(base), "ops-"+a.tool.Name+"-")
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(base, filepath.Base(dir))
+	a.dir = dir
+	archive := filepath.Join(dir, a.tool.Name+"."+a.artifact.Archive)
+	if err := a.d.Download(archive, a.artifact.URL, a.artifact.SHA256); err != nil {
+		return "", err
+	}
+	member := filepath.Join(dir, "member")
+	if err := utils.ExtractFile(archive, a.artifact.Archive, a.artifact.Member, member); err != nil {
+		return "", err
+	}
+	if a.artifact.MemberSHA256 != "" {
+		current, err := utils.SHA256File(member)
+		if err != nil {
+			return "", err
+		}
+		if !strings.EqualFold(current, a.artifact.MemberSHA256) {
+			return "", fmt.Errorf("sha256 mismatch for %s in %s: got %s, want %s", a.artifact.Member, a.artifact.URL, current, a.artifact.MemberSHA256)
+		}
+	}
+	return member, nil
+}
+
+// 删除临时目录
+func (a *toolArchive) cleanup() {
+	if a.dir != "" {
+		_ = nos.RemoveAll(script.Path(a.dir))
+	}
+}
+
+func installTool(d *utils.Downloader, archive *toolArchive, _path string) error {
+	tool, artifact := archive.tool, archive.artifact
+	// 压缩包只能通过解压后文件的SHA-256判断是否已安装
+	sum := artifact.SHA256
+	if artifact.Archive != "" {
+		sum = artifact.MemberSHA256
+	}
+	if utils.PathExists(_path) {
+		current, err := utils.SHA256File(_path)
+		if err == nil && sum != "" && strings.EqualFold(current, sum) {
+			logger.Sugar.Infoln("文件已存在並且SHA-256相符，跳过：" + _path)
+			return setToolPermission(tool, _path)
+		}
+		logger.Sugar.Infoln("SHA-256不匹配，开始下载：" + artifact.URL + " --->" + _path)
+	} else {
+		logger.Sugar.Infoln("文件不存在开始下载：" + artifact.URL + " --->" + _path)
+	}
+	if err := nos.MkdirAll(script.Path(filepath.Dir(_path)), 0755); err != nil {
+		return err
+	}
+	if artifact.Archive == "" {
+		if err := d.Download(_path, artifact.URL, artifact.SHA256); err != nil {
+			return err
+		}
+		return setToolPermission(tool, _path)
+	}
+
+	member, err := archive.extract()
+	if err != nil {
+		return err
+	}
+	// 原子替换，避免覆盖正在运行的程序或留下不完整的文件
+	if _, err := script.File(member).WriteFile(_path); err != nil {
+		return err
+	}
+	return setToolPermission(tool, _path)
+}
+
+func setToolPermission(tool *manifest.Tool, _path string) error {
+	owner, group := tool.OwnerGroup()
+	u, err := user.Lookup(owner)
+	if err != nil {
+		return err
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return err
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+	gid, _ := strconv.Atoi(g.Gid)
+	if err := nos.Chown(script.Path(_path), uid, gid); err != nil {
+		return err
+	}
+	return nos.Chmod(script.Path(_path), tool.FileMode())
+}
+
+func buildManifestCmd() *cobra.Command {
+	manifestCmd := &cobra.Command{
+		Use:   "manifest",
+		Short: "管理init tools使用的工具清单",
+	}
+
+	manifestCmd.AddCommand(&cobra.Command{
+		Use:   "keygen",
+		Short: "生成ed25519签名密钥对",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			pub, priv, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				logger.Sugar.Fatal(err)
+			}
+			fmt.Println("public key: ", base64.StdEncoding.EncodeToString(pub))
+			fmt.Println("private key:", base64.StdEncoding.EncodeToString(priv))
+		},
+	})
+
+	signCmd := &cobra.Command{
+		Use:   "sign <manifest.json>",
+		Short: "校验工具清单格式并生成<manifest.json>.sig签名文件",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			keyFile, _ := cmd.Flags().GetString("key")
+			keyData, err := nos.ReadFile(keyFile)
+			if err != nil {
+				logger.Sugar.Fatal(err)
+			}
+			key, err := manifest.ParsePrivateKey(string(keyData))
+			if err != nil {
+				logger.Sugar.Fatal(err)
+			}
+			data, err := nos.ReadFile(args[0])
+			if err != nil {
+				logger.Sugar.Fatal(err)
+			}
+			if _, err := manifest.Parse(data); err != nil {
+				logger.Sugar.Fatal(err)
+			}
+			if err := nos.WriteFile(args[0]+".sig", []byte(manifest.Sign(data, key)+"\n"), 0644); err != nil {
+				logger.Sugar.Fatal(err)
+			}
+			logger.Sugar.Infof("签名已写入%s.sig", args[0])
+		},
+	}
+	signCmd.Flags().StringP("key", "k", "", "保存base64私钥的文件")
+	_ = signCmd.MarkFlagRequired("key")
+	manifestCmd.AddCommand(signCmd)
+
+	return manifestCmd
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	nos "os"
+	"os/user"
+	"path/filepath"
+	"stkey/pkg/manifest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func tarGz(t *testing.T, name string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestInstallToolArchive(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho jq\n")
+	archive := tarGz(t, "jq-1.7/jq", binary)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write(archive)
+	}))
+	defer srv.Close()
+
+	// 临时目录应在安装后删除
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	u, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := user.LookupGroupId(u.Gid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir()
+	tool := &manifest.Tool{
+		Name:  "jq",
+		Mode:  "0750",
+		Owner: u.Username + ":" + g.Name,
+		Paths: []string{filepath.Join(dst, "bin", "jq"), filepath.Join(dst, "sbin", "jq")},
+	}
+	artifact := &manifest.Artifact{
+		URL:          srv.URL + "/jq.tar.gz",
+		SHA256:       sha256Hex(archive),
+		Archive:      "tar.gz",
+		Member:       "jq-1.7/jq",
+		MemberSHA256: sha256Hex(binary),
+	}
+	d := newToolsDownloader(&toolsOptions{Timeout: 10 * time.Second})
+	a := &toolArchive{d: d, tool: tool, artifact: artifact}
+	for _, path := range tool.Paths {
+		if err := installTool(d, a, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a.cleanup()
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("archive downloaded %d times, want once", n)
+	}
+	for _, path := range tool.Paths {
+		b, err := nos.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, binary) {
+			t.Errorf("%s = %q, want %q", path, b, binary)
+		}
+		fi, err := nos.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != 0750 {
+			t.Errorf("%s mode = %o, want 750", path, fi.Mode().Perm())
+		}
+	}
+	if left, _ := nos.ReadDir(tmp); len(left) != 0 {
+		t.Errorf("temporary files left in %s: %v", tmp, left)
+	}
+
+	// 已安装且SHA-256相符时不再下载
+	a = &toolArchive{d: d, tool: tool, artifact: artifact}
+	if err := installTool(d, a, tool.Paths[0]); err != nil {
+		t.Fatal(err)
+	}
+	a.cleanup()
+	if n := requests.Load(); n != 1 {
+		t.Errorf("archive downloaded again for an installed tool, %d requests", n)
+	}
+}
+
+func TestInstallToolMemberMismatch(t *testing.T) {
+	archive := tarGz(t, "jq", []byte("tampered"))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(archive)
+	}))
+	defer srv.Close()
+
+	tool := &manifest.Tool{Name: "jq"}
+	artifact := &manifest.Artifact{
+		URL:          srv.URL + "/jq.tar.gz",
+		Archive:      "tar.gz",
+		Member:       "jq",
+		MemberSHA256: sha256Hex([]byte("original")),
+	}
+	d := newToolsDownloader(&toolsOptions{Timeout: 10 * time.Second})
+	a := &toolArchive{d: d, tool: tool, artifact: artifact}
+	defer a.cleanup()
+	path := filepath.Join(t.TempDir(), "jq")
+	if err := installTool(d, a, path); err == nil {
+		t.Fatal("installTool succeeded with a tampered member")
+	}
+	if _, err := nos.Stat(path); !nos.IsNotExist(err) {
+		t.Errorf("%s installed despite the mismatch", path)
+	}
+}
@@ -167,33 +167,23 @@ ubuntu hard nproc 102400
 ubuntu soft nofile 102400
 ubuntu hard nofile 102400
 `
-	BashrcConf = `# .bashrc
-# User specific aliases and functions
-alias rm='rm -i'
+	// BashrcConf root用户的alias，以受管块写入/root/.bashrc
+	BashrcConf = `alias rm='rm -i'
 alias cp='cp -i'
 alias mv='mv -i'
 alias ll='ls -l --color=auto'
 alias ls='ls --color=auto'
-#alias dir='dir --color=auto'
-#alias vdir='vdir --color=auto'
 alias grep='grep --color=auto'
 alias fgrep='fgrep --color=auto'
 alias egrep='egrep --color=auto'
-
-# Source global definitions
-if [ -f /etc/bashrc ]; then
-        . /etc/bashrc
-fi
-
-export PS1='\n\e[1;37m[\e[m\e[1;35m\u\e[m\e[1;36m@\e[m\e[1;37m\H\e[m \e[1;33m\A\e[m \w\e[m\e[1;37m]\e[m\e[1;36m\e[m\n\$ '
-export LANG=en_US.UTF-8
-export LC_ALL=en_US.UTF-8
 `
+	// TerminalConf 所有用户的提示符及语言，写入/etc/profile.d/ops-terminal.sh
 	TerminalConf = `export PS1='\n\e[1;37m[\e[m\e[1;35m\u\e[m\e[1;36m@\e[m\e[1;37m\H\e[m \e[1;33m\A\e[m \w\e[m\e[1;37m]\e[m\e[1;36m\e[m\n\$ '
 export LANG=en_US.UTF-8
 export LC_ALL=en_US.UTF-8
 `
-	HistoryLog = `cmd_log="/var/log/.hist/command.log"
+	// LegacyHistoryLog 旧版本以PROMPT_COMMAND记录命令时写入全局bashrc的内容，仅用于清理，已由auditd替代
+	LegacyHistoryLog = `cmd_log="/var/log/.hist/command.log"
 if [ ! -f ${cmd_log} ];then
     sudo mkdir -p /var/log/.hist
     sudo touch ${cmd_log}
@@ -204,105 +194,119 @@ if [ ! -w ${cmd_log} ];then
 fi
 export HISTTIMEFORMAT="{\"TIME\":\"%F %T\",\"HOSTNAME\":\"$(hostname)\",\"LI\":\"$(who -u am i 2>/dev/null| awk '{print $NF}'|sed -e 's/[()]//g')\",\"LU\":\"$(who am i|awk '{print $1}')\",\"NU\":\"${USER}\",\"CMD\":\""
 export PROMPT_COMMAND='history 1|tail -1|sed "s/^[ ]\+[0-9]\+  //"|sed "s/$/\"}/">> /var/log/.hist/command.log'
-export PS1='\n\e[1;37m[\e[m\e[1;35m\u\e[m\e[1;36m@\e[m\e[1;37m\H\e[m \e[1;33m\A\e[m \w\e[m\e[1;37m]\e[m\e[1;36m\e[m\n\$ '
-export LANG=en_US.UTF-8
-export LC_ALL=en_US.UTF-8
-`
-	LogrotateHistory = `/var/log/.hist/command.log {
-  rotate 240
-  monthly
-  compress
-  missingok
-  notifempty
-  nocopytruncate
-  dateext
-}
 `
-	FedoraChronyConf = `server ntp.aliyun.com iburst
-server ntp.tencent.com iburst
-server time.windows.com iburst
-server time.cloudflare.com iburst
-driftfile /var/lib/chrony/drift
+	// FedoraChronyBase chrony.conf除server/pool/allow/deny外的配置
+	FedoraChronyBase = `driftfile /var/lib/chrony/drift
 makestep 1.0 3
 rtcsync
 logdir /var/log/chrony
 `
-	DebianChronyConf = `pool ntp.aliyun.com iburst maxsources 4
-pool ntp.tencent.com iburst maxsources 1
-pool time.windows.com iburst maxsources 1
-pool time.cloudflare.com iburst maxsources 2
-keyfile /etc/chrony/chrony.keys
+	DebianChronyBase = `keyfile /etc/chrony/chrony.keys
 driftfile /var/lib/chrony/chrony.drift
 logdir /var/log/chrony
 maxupdateskew 100.0
 rtcsync
 makestep 1 3
 `
-	AptSourceConf = `deb https://mirrors.cloud.tencent.com/ubuntu/ lsb_release main restricted universe multiverse
-deb-src https://mirrors.cloud.tencent.com/ubuntu/ lsb_release main restricted universe multiverse
-deb https://mirrors.cloud.tencent.com/ubuntu/ lsb_release-security main restricted universe multiverse
-deb-src https://mirrors.cloud.tencent.com/ubuntu/ lsb_release-security main restricted universe multiverse
-deb https://mirrors.cloud.tencent.com/ubuntu/ lsb_release-updates main restricted universe multiverse
-deb-src https://mirrors.cloud.tencent.com/ubuntu/ lsb_release-updates main restricted universe multiverse
-deb https://mirrors.cloud.tencent.com/ubuntu/ lsb_release-backports main restricted universe multiverse
-deb-src https://mirrors.cloud.tencent.com/ubuntu/ lsb_release-backports main restricted universe multiverse
-deb https://mirrors.cloud.tencent.com/ubuntu/ lsb_release-proposed main restricted universe multiverse
-deb-src https://mirrors.cloud.tencent.com/ubuntu/ lsb_release-proposed main restricted universe multiverse
+	// 以下软件源为text/template模板，由所选镜像站渲染，见cmd/repo.go repoData
+	AptSourceConf = `deb {{.Ubuntu}}/ {{.Codename}} main restricted universe multiverse
+deb-src {{.Ubuntu}}/ {{.Codename}} main restricted universe multiverse
+deb {{.Ubuntu}}/ {{.Codename}}-security main restricted universe multiverse
+deb-src {{.Ubuntu}}/ {{.Codename}}-security main restricted universe multiverse
+deb {{.Ubuntu}}/ {{.Codename}}-updates main restricted universe multiverse
+deb-src {{.Ubuntu}}/ {{.Codename}}-updates main restricted universe multiverse
+deb {{.Ubuntu}}/ {{.Codename}}-backports main restricted universe multiverse
+deb-src {{.Ubuntu}}/ {{.Codename}}-backports main restricted universe multiverse
+deb {{.Ubuntu}}/ {{.Codename}}-proposed main restricted universe multiverse
+deb-src {{.Ubuntu}}/ {{.Codename}}-proposed main restricted universe multiverse
+`
+	CentosBaseRepo = `[base]
+name=CentOS-$releasever - Base
+baseurl={{.CentOS}}/{{.Release}}/os/$basearch/
+gpgcheck=1
+gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-CentOS-{{.Major}}
+
+[updates]
+name=CentOS-$releasever - Updates
+baseurl={{.CentOS}}/{{.Release}}/updates/$basearch/
+gpgcheck=1
+gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-CentOS-{{.Major}}
+
+[extras]
+name=CentOS-$releasever - Extras
+baseurl={{.CentOS}}/{{.Release}}/extras/$basearch/
+gpgcheck=1
+gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-CentOS-{{.Major}}
+
+[centosplus]
+name=CentOS-$releasever - Plus
+baseurl={{.CentOS}}/{{.Release}}/centosplus/$basearch/
+gpgcheck=1
+enabled=0
+gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-CentOS-{{.Major}}
+`
+	EpelRepo = `[epel]
+name=Extra Packages for Enterprise Linux {{.Major}} - $basearch
+baseurl={{.EPEL}}/{{.EPELRelease}}/$basearch
+failovermethod=priority
+enabled=1
+gpgcheck=1
+gpgkey={{.EPELKey}}
 `
 	Centos8EpelRepo = `[epel]
 name=EPEL for redhat/centos $releasever - $basearch
-baseurl=http://mirrors.cloud.tencent.com/epel/$releasever/Everything/$basearch
+baseurl={{.EPEL}}/{{.EPELRelease}}/Everything/$basearch
 failovermethod=priority
 enabled=1
 gpgcheck=1
 gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-EPEL-8`
 	Centos8AppStreamRepo = `[appstream]
 name=CentOS Linux $releasever - AppStream
-baseurl=http://mirrors.cloud.tencent.com/$contentdir/$releasever/AppStream/$basearch/os/
+baseurl={{.CentOS}}/{{.Release}}/AppStream/$basearch/os/
 gpgcheck=1
 enabled=1
 gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-centosofficial`
 	Centos8BaseRepo = `[BaseOS]
-name=Qcloud centos OS - $basearch
-baseurl=http://mirrors.cloud.tencent.com/centos/$releasever/BaseOS/$basearch/os/
+name=CentOS-$releasever - BaseOS - $basearch
+baseurl={{.CentOS}}/{{.Release}}/BaseOS/$basearch/os/
 enabled=1
 gpgcheck=1
-gpgkey=http://mirrors.cloud.tencent.com/centos/RPM-GPG-KEY-CentOS-Official
+gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-centosofficial
 
 [centosplus]
-name=Qcloud centosplus - $basearch
-baseurl=http://mirrors.cloud.tencent.com/centos/$releasever/centosplus/$basearch/os/
+name=CentOS-$releasever - centosplus - $basearch
+baseurl={{.CentOS}}/{{.Release}}/centosplus/$basearch/os/
 enabled=0
 gpgcheck=1
-gpgkey=http://mirrors.cloud.tencent.com/centos/RPM-GPG-KEY-CentOS-Official
+gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-centosofficial
 
 [extras]
-name=Qcloud centos extras - $basearch
-baseurl=http://mirrors.cloud.tencent.com/centos/$releasever/extras/$basearch/os/
+name=CentOS-$releasever - extras - $basearch
+baseurl={{.CentOS}}/{{.Release}}/extras/$basearch/os/
 enabled=1
 gpgcheck=1
-gpgkey=http://mirrors.cloud.tencent.com/centos/RPM-GPG-KEY-CentOS-Official
+gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-centosofficial
 
 [fasttrack]
-name=Qcloud centos fasttrack - $basearch
-baseurl=http://mirrors.cloud.tencent.com/centos/$releasever/fasttrack/$basearch/os/
+name=CentOS-$releasever - fasttrack - $basearch
+baseurl={{.CentOS}}/{{.Release}}/fasttrack/$basearch/os/
 enabled=0
 gpgcheck=1
-gpgkey=http://mirrors.cloud.tencent.com/centos/RPM-GPG-KEY-CentOS-Official
+gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-centosofficial
 
 [AppStream]
-name=Qcloud centos AppStream - $basearch
-baseurl=http://mirrors.cloud.tencent.com/centos/$releasever/AppStream/$basearch/os/
+name=CentOS-$releasever - AppStream - $basearch
+baseurl={{.CentOS}}/{{.Release}}/AppStream/$basearch/os/
 enabled=0
 gpgcheck=1
-gpgkey=http://mirrors.cloud.tencent.com/centos/RPM-GPG-KEY-CentOS-Official
+gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-centosofficial
 
 [PowerTools]
-name=Qcloud centos PowerTools - $basearch
-baseurl=http://mirrors.cloud.tencent.com/centos/$releasever/PowerTools/$basearch/os/
+name=CentOS-$releasever - PowerTools - $basearch
+baseurl={{.CentOS}}/{{.Release}}/PowerTools/$basearch/os/
 enabled=0
 gpgcheck=1
-gpgkey=http://mirrors.cloud.tencent.com/centos/RPM-GPG-KEY-CentOS-Official`
+gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-centosofficial`
 	Centos8EpelKey = `-----BEGIN PGP PUBLIC KEY BLOCK-----
 
 mQINBFz3zvsBEADJOIIWllGudxnpvJnkxQz2CtoWI7godVnoclrdl83kVjqSQp+2
@@ -0,0 +1,324 @@
+// Package audit logs the commands run in login sessions with the Linux
+// audit system, and reads them back from the auditd log.
+package audit
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"bitbucket.org/creachadair/shell"
+)
+
+const (
+	// Key tags the execve events of the rules, see [Rules].
+	Key = "ops_exec"
+	// ConfigKey tags changes to the audit configuration.
+	ConfigKey = "ops_audit_config"
+	// DefaultLog is where auditd writes its log.
+	DefaultLog = "/var/log/audit/audit.log"
+	// TimeFormat is the format of [Command.Time].
+	TimeFormat = "2006-01-02 15:04:05"
+	// unset is the auid of processes outside login sessions, e.g. daemons.
+	unset = "4294967295"
+)
+
+// Rules returns the audit rules recording every program executed in a
+// login session, whatever the user switched to with su or sudo, and the
+// changes to the audit configuration itself. goarch selects the syscall
+// tables, e.g. "amd64". With immutable, the rules cannot be changed until
+// the next reboot.
+func Rules(goarch string, immutable bool) string {
+	var arches []string
+	switch goarch {
+	case "amd64", "ppc64", "ppc64le", "s390x":
+		arches = []string{"b64", "b32"}
+	case "386", "arm", "mips", "mipsle":
+		arches = []string{"b32"}
+	default:
+		arches = []string{"b64"}
+	}
+	var b strings.Builder
+	for _, arch := range arches {
+		fmt.Fprintf(&b, "-a always,exit -F arch=%s -S execve -F auid!=%s -k %s\n", arch, unset, Key)
+	}
+	fmt.Fprintf(&b, "-w /etc/audit/ -p wa -k %s\n", ConfigKey)
+	fmt.Fprintf(&b, "-w /sbin/auditctl -p x -k %s\n", ConfigKey)
+	if immutable {
+		b.WriteString("-e 2\n")
+	}
+	return b.String()
+}
+
+// Command is a command run in a login session, with the JSON fields of the
+// command log formerly written by the shell.
+type Command struct {
+	Time     string `json:"TIME"`
+	Hostname string `json:"HOSTNAME"`
+	// LoginIP is the address the session was opened from.
+	LoginIP string `json:"LI"`
+	// LoginUser is the user who logged in, User the one running the
+	// command, e.g. root after sudo.
+	LoginUser string `json:"LU"`
+	User      string `json:"NU"`
+	Cmd       string `json:"CMD"`
+
+	At time.Time `json:"-"`
+}
+
+// record is a line of the auditd log.
+type record struct {
+	typ    string
+	at     time.Time
+	serial string
+	fields map[string]string
+}
+
+// field returns the value of key without its quotes.
+func (r *record) field(key string) string {
+	return unquote(r.fields[key])
+}
+
+// Parser assembles the commands of the auditd log from its records.
+type Parser struct {
+	// Hostname is used for logs written without node names.
+	Hostname string
+
+	sessions map[string]string
+	events   map[string][]*record
+	users    map[string]string
+	out      []Command
+}
+
+// NewParser returns a parser for the logs of the host hostname.
+func NewParser(hostname string) *Parser {
+	return &Parser{
+		Hostname: hostname,
+		sessions: map[string]string{},
+		events:   map[string][]*record{},
+		users:    map[string]string{},
+	}
+}
+
+// Parse reads an auditd log, raw or enriched. Logs must be parsed oldest
+// first, so that the sessions of commands are known.
+func (p *Parser) Parse(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		rec, ok := parseRecord(sc.Text())
+		if !ok {
+			continue
+		}
+		switch rec.typ {
+		case "USER_LOGIN", "USER_START", "LOGIN":
+			if addr := rec.field("addr"); addr != "" && addr != "?" {
+				if ses := rec.field("ses"); ses != "" && ses != unset {
+					p.sessions[ses] = addr
+				}
+			}
+		case "EOE":
+			p.flush(rec.serial)
+		case "SYSCALL", "EXECVE":
+			p.events[rec.serial] = append(p.events[rec.serial], rec)
+		}
+	}
+	return sc.Err()
+}
+
+// Commands returns the commands found so far, in time order.
+func (p *Parser) Commands() []Command {
+	for serial := range p.events {
+		p.flush(serial)
+	}
+	sort.SliceStable(p.out, func(i, j int) bool { return p.out[i].At.Before(p.out[j].At) })
+	return p.out
+}
+
+// flush turns the records of the event serial into a command.
+func (p *Parser) flush(serial string) {
+	recs := p.events[serial]
+	delete(p.events, serial)
+	var sys, execve *record
+	for _, r := range recs {
+		switch r.typ {
+		case "SYSCALL":
+			sys = r
+		case "EXECVE":
+			execve = r
+		}
+	}
+	if sys == nil || execve == nil || sys.field("key") != Key {
+		return
+	}
+	c := Command{
+		At:        sys.at,
+		Time:      sys.at.Format(TimeFormat),
+		Hostname:  p.Hostname,
+		LoginIP:   p.sessions[sys.field("ses")],
+		LoginUser: p.user(sys, "auid"),
+		User:      p.user(sys, "uid"),
+		Cmd:       shell.Join(execveArgs(execve)),
+	}
+	if node := sys.field("node"); node != "" {
+		c.Hostname = node
+	}
+	p.out = append(p.out, c)
+}
+
+// user returns the name of the user id in the field key, as resolved by
+// an enriched log or else by the local user database.
+func (p *Parser) user(r *record, key string) string {
+	if name := r.field(strings.ToUpper(key)); name != "" {
+		return name
+	}
+	id := r.field(key)
+	if id == unset {
+		return "unset"
+	}
+	if name, ok := p.users[id]; ok {
+		return name
+	}
+	name := id
+	if u, err := user.LookupId(id); err == nil {
+		name = u.Username
+	}
+	p.users[id] = name
+	return name
+}
+
+// execveArgs returns the arguments of an EXECVE record. Arguments are
+// quoted, or hex encoded when they contain spaces or special characters,
+// and long ones are split into a<n>[<i>] chunks.
+func execveArgs(r *record) []string {
+	argc, _ := strconv.Atoi(r.field("argc"))
+	args := make([]string, 0, argc)
+	for i := 0; i < argc; i++ {
+		key := "a" + strconv.Itoa(i)
+		if v, ok := r.fields[key]; ok {
+			args = append(args, decodeArg(v))
+			continue
+		}
+		var b strings.Builder
+		for j := 0; ; j++ {
+			v, ok := r.fields[fmt.Sprintf("%s[%d]", key, j)]
+			if !ok {
+				break
+			}
+			b.WriteString(decodeArg(v))
+		}
+		args = append(args, b.String())
+	}
+	return args
+}
+
+func decodeArg(v string) string {
+	if strings.HasPrefix(v, `"`) {
+		return unquote(v)
+	}
+	if b, err := hex.DecodeString(v); err == nil {
+		return string(b)
+	}
+	return v
+}
+
+func unquote(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// parseRecord parses a line such as
+//
+//	node=web1 type=SYSCALL msg=audit(1697000000.123:456): arch=c000003e ... key="ops_exec"
+//
+// The fields of a nested msg='...' are merged into the record, and the
+// resolved fields that enriched logs append after a 0x1d separator, e.g.
+// AUID="alice", are kept under their upper case names.
+func parseRecord(line string) (*record, bool) {
+	rec := &record{fields: map[string]string{}}
+	rec.parse(line)
+	return rec, rec.typ != "" && rec.serial != ""
+}
+
+func (rec *record) parse(line string) {
+	for _, kv := range splitFields(strings.ReplaceAll(line, "\x1d", " ")) {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		switch {
+		case k == "type" && rec.typ == "":
+			rec.typ = v
+		case k == "msg" && strings.HasPrefix(v, "audit("):
+			rec.parseStamp(strings.TrimRight(strings.TrimPrefix(v, "audit("), "):"))
+		case k == "msg" && strings.HasPrefix(v, "'"):
+			inner := &record{fields: map[string]string{}}
+			inner.parse(unquote(v))
+			for ik, iv := range inner.fields {
+				if _, ok := rec.fields[ik]; !ok {
+					rec.fields[ik] = iv
+				}
+			}
+		default:
+			rec.fields[k] = v
+		}
+	}
+}
+
+// parseStamp parses the "1697000000.123:456" time and serial of a record.
+func (rec *record) parseStamp(stamp string) {
+	ts, serial, ok := strings.Cut(stamp, ":")
+	if !ok {
+		return
+	}
+	sec, frac, _ := strings.Cut(ts, ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return
+	}
+	ms, _ := strconv.Atoi(frac)
+	rec.at = time.Unix(s, int64(ms)*int64(time.Millisecond))
+	rec.serial = serial
+}
+
+// splitFields splits line at spaces outside of quotes.
+func splitFields(line string) []string {
+	var fields []string
+	var quote byte
+	start := -1
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			if start < 0 {
+				start = i
+			}
+		case c == ' ':
+			if start >= 0 {
+				fields = append(fields, line[start:i])
+				start = -1
+			}
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	if start >= 0 {
+		fields = append(fields, line[start:])
+	}
+	return fields
+}
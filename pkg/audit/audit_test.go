@@ -0,0 +1,138 @@
+package audit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func at(sec int64, ms int) string {
+	return time.Unix(sec, int64(ms)*int64(time.Millisecond)).Format(TimeFormat)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+		want []Command
+	}{
+		{
+			name: "raw log with session address",
+			log: `type=USER_START msg=audit(1697000000.000:100): pid=1 uid=0 auid=0 ses=5 msg='op=PAM:session_open acct="root" exe="/usr/sbin/sshd" hostname=10.0.0.9 addr=10.0.0.9 terminal=ssh res=success'
+type=SYSCALL msg=audit(1697000001.250:101): arch=c000003e syscall=59 success=yes exit=0 ppid=2 pid=3 auid=0 uid=0 gid=0 ses=5 comm="ls" exe="/usr/bin/ls" key="ops_exec"
+type=EXECVE msg=audit(1697000001.250:101): argc=2 a0="ls" a1="-l"
+type=CWD msg=audit(1697000001.250:101): cwd="/root"
+type=EOE msg=audit(1697000001.250:101):
+`,
+			want: []Command{{Time: at(1697000001, 250), Hostname: "host", LoginIP: "10.0.0.9", LoginUser: "root", User: "root", Cmd: "ls -l"}},
+		},
+		{
+			name: "interleaved events are grouped by serial",
+			log: `type=SYSCALL msg=audit(1697000002.000:201): auid=0 uid=0 ses=7 key="ops_exec"
+type=SYSCALL msg=audit(1697000002.100:202): auid=0 uid=0 ses=7 key="ops_exec"
+type=EXECVE msg=audit(1697000002.100:202): argc=1 a0="pwd"
+type=EXECVE msg=audit(1697000002.000:201): argc=2 a0="cat" a1="/etc/hosts"
+type=EOE msg=audit(1697000002.100:202):
+type=EOE msg=audit(1697000002.000:201):
+`,
+			want: []Command{
+				{Time: at(1697000002, 0), Hostname: "host", LoginUser: "root", User: "root", Cmd: "cat /etc/hosts"},
+				{Time: at(1697000002, 100), Hostname: "host", LoginUser: "root", User: "root", Cmd: "pwd"},
+			},
+		},
+		{
+			name: "hex encoded and chunked arguments",
+			log: `type=SYSCALL msg=audit(1697000003.000:301): auid=0 uid=0 ses=8 key="ops_exec"
+type=EXECVE msg=audit(1697000003.000:301): argc=4 a0="echo" a1=68656C6C6F20776F726C64 a2_len=10 a2[0]=3031323334 a2[1]=3536373839 a3=69742773
+`,
+			want: []Command{{Time: at(1697000003, 0), Hostname: "host", LoginUser: "root", User: "root", Cmd: `echo 'hello world' 0123456789 it\'s`}},
+		},
+		{
+			name: "enriched log with node names",
+			log: "node=web1 type=SYSCALL msg=audit(1697000004.000:401): auid=1000 uid=0 ses=9 key=\"ops_exec\"\x1dARCH=x86_64 SYSCALL=execve AUID=\"alice\" UID=\"root\"\n" +
+				"node=web1 type=EXECVE msg=audit(1697000004.000:401): argc=2 a0=\"systemctl\" a1=\"restart\"\n" +
+				"node=web1 type=EOE msg=audit(1697000004.000:401): \n",
+			want: []Command{{Time: at(1697000004, 0), Hostname: "web1", LoginUser: "alice", User: "root", Cmd: "systemctl restart"}},
+		},
+		{
+			name: "other keys and incomplete events are skipped",
+			log: `type=SYSCALL msg=audit(1697000005.000:501): auid=0 uid=0 ses=9 key="ops_audit_config"
+type=EXECVE msg=audit(1697000005.000:501): argc=1 a0="auditctl"
+type=EOE msg=audit(1697000005.000:501):
+type=SYSCALL msg=audit(1697000005.100:502): auid=0 uid=0 ses=9 key="ops_exec"
+type=EOE msg=audit(1697000005.100:502):
+not an audit record
+type=SYSCALL msg=audit(1697000005.200:503): auid=4294967295 uid=0 ses=4294967295 key="ops_exec"
+type=EXECVE msg=audit(1697000005.200:503): argc=1 a0="cron"
+`,
+			want: []Command{{Time: at(1697000005, 200), Hostname: "host", LoginUser: "unset", User: "root", Cmd: "cron"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewParser("host")
+			if err := p.Parse(strings.NewReader(tt.log)); err != nil {
+				t.Fatal(err)
+			}
+			got := p.Commands()
+			for i := range got {
+				got[i].At = time.Time{}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Commands() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAcrossFiles(t *testing.T) {
+	// 会话在已轮转的旧日志中打开
+	p := NewParser("host")
+	old := `type=USER_LOGIN msg=audit(1697000000.000:1): pid=1 uid=0 auid=0 ses=3 msg='op=login acct="root" addr=192.168.1.2 terminal=ssh res=success'` + "\n"
+	current := `type=SYSCALL msg=audit(1697000010.000:2): auid=0 uid=0 ses=3 key="ops_exec"
+type=EXECVE msg=audit(1697000010.000:2): argc=1 a0="id"
+type=EOE msg=audit(1697000010.000:2):
+`
+	for _, log := range []string{old, current} {
+		if err := p.Parse(strings.NewReader(log)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmds := p.Commands()
+	if len(cmds) != 1 || cmds[0].LoginIP != "192.168.1.2" {
+		t.Errorf("Commands() = %+v, want id from 192.168.1.2", cmds)
+	}
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		goarch    string
+		immutable bool
+		want      []string
+	}{
+		{goarch: "amd64", want: []string{
+			"-a always,exit -F arch=b64 -S execve -F auid!=4294967295 -k ops_exec",
+			"-a always,exit -F arch=b32 -S execve -F auid!=4294967295 -k ops_exec",
+			"-w /etc/audit/ -p wa -k ops_audit_config",
+			"-w /sbin/auditctl -p x -k ops_audit_config",
+		}},
+		{goarch: "arm64", immutable: true, want: []string{
+			"-a always,exit -F arch=b64 -S execve -F auid!=4294967295 -k ops_exec",
+			"-w /etc/audit/ -p wa -k ops_audit_config",
+			"-w /sbin/auditctl -p x -k ops_audit_config",
+			"-e 2",
+		}},
+		{goarch: "386", want: []string{
+			"-a always,exit -F arch=b32 -S execve -F auid!=4294967295 -k ops_exec",
+			"-w /etc/audit/ -p wa -k ops_audit_config",
+			"-w /sbin/auditctl -p x -k ops_audit_config",
+		}},
+	}
+	for _, tt := range tests {
+		got := strings.Split(strings.TrimSuffix(Rules(tt.goarch, tt.immutable), "\n"), "\n")
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Rules(%q, %v) =\n%s\nwant\n%s", tt.goarch, tt.immutable, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
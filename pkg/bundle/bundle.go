@@ -0,0 +1,198 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// MetadataFile describes the bundle, at the root of the archive.
+	MetadataFile = "bundle.json"
+	// PackagesDir holds the RPM/DEB packages together with the repository
+	// metadata (repodata/ or Packages.gz).
+	PackagesDir = "packages"
+	// ReposDir holds the repo files of the build host, for reference.
+	ReposDir = "repos"
+	// KeysDir holds the GPG keys of the build host.
+	KeysDir = "keys"
+	// RepoKeyFile is the public key in KeysDir that signs the InRelease of
+	// the apt repository in PackagesDir. It is generated for each build.
+	RepoKeyFile = "ops-bundle.gpg"
+	// ToolsDir holds the signed tool manifest and the tool artifacts, named
+	// after their SHA-256.
+	ToolsDir = "tools"
+	// ManifestFile is the signed tool manifest inside ToolsDir.
+	ManifestFile = "manifest.json"
+)
+
+// Target is the platform a bundle was built for.
+type Target struct {
+	ID        string `json:"id"`
+	VersionID string `json:"version_id"`
+	Arch      string `json:"arch"`
+}
+
+func (t Target) String() string {
+	return fmt.Sprintf("%s-%s/%s", t.ID, t.VersionID, t.Arch)
+}
+
+// Metadata is the content of bundle.json.
+type Metadata struct {
+	Target   Target    `json:"target"`
+	Created  time.Time `json:"created"`
+	Packages []string  `json:"packages"`
+	Tools    []string  `json:"tools,omitempty"`
+}
+
+// ReadMetadata reads bundle.json from the unpacked bundle dir.
+func ReadMetadata(dir string) (*Metadata, error) {
+	data, err := os.ReadFile(filepath.Join(dir, MetadataFile))
+	if err != nil {
+		return nil, err
+	}
+	m := new(Metadata)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", MetadataFile, err)
+	}
+	return m, nil
+}
+
+// WriteMetadata writes m as bundle.json into dir.
+func WriteMetadata(dir string, m *Metadata) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, MetadataFile), data, 0644)
+}
+
+func isGzip(path string) bool {
+	return strings.HasSuffix(path, ".gz") || strings.HasSuffix(path, ".tgz")
+}
+
+// Pack writes the content of dir to the tar archive out, gzip compressed if
+// out ends with .gz or .tgz. The archive is flushed and closed before Pack
+// returns, so an error writing the end of it is reported too.
+func Pack(dir, out string) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = f
+	var gz *gzip.Writer
+	if isGzip(out) {
+		gz = gzip.NewWriter(f)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+		h, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		h.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		_, err = io.Copy(tw, in)
+		return err
+	})
+	// close the tar writer, then the gzip stream, then the file, keeping
+	// the first error
+	if cerr := tw.Close(); err == nil {
+		err = cerr
+	}
+	if gz != nil {
+		if cerr := gz.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Unpack extracts the tar archive file into dir. Entries escaping dir and
+// anything but regular files and directories are rejected.
+func Unpack(file, dir string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if isGzip(file) {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(h.Name))
+		if target == filepath.Clean(dir) {
+			continue
+		}
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path %q in bundle", h.Name)
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(h.Mode)&0755)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			out.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported entry %q in bundle", h.Name)
+		}
+	}
+}
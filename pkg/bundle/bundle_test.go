@@ -0,0 +1,60 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestPackUnpack(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, PackagesDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, PackagesDir, "Packages"), []byte("Package: jq\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	meta := &Metadata{Target: Target{ID: "ubuntu", VersionID: "22.04", Arch: "amd64"}, Created: time.Unix(0, 0).UTC(), Packages: []string{"jq"}}
+	if err := WriteMetadata(src, meta); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"bundle.tar", "bundle.tar.gz"} {
+		out := filepath.Join(t.TempDir(), name)
+		if err := Pack(src, out); err != nil {
+			t.Fatal(err)
+		}
+		dst := t.TempDir()
+		if err := Unpack(out, dst); err != nil {
+			t.Fatalf("Unpack(%s): %v", name, err)
+		}
+		got, err := ReadMetadata(dst)
+		if err != nil || got.Target != meta.Target {
+			t.Errorf("%s: ReadMetadata() = %+v, %v", name, got, err)
+		}
+		if b, _ := os.ReadFile(filepath.Join(dst, PackagesDir, "Packages")); string(b) != "Package: jq\n" {
+			t.Errorf("%s: Packages = %q", name, b)
+		}
+	}
+}
+
+func TestPackReportsWriteErrors(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs /dev/full")
+	}
+	src := t.TempDir()
+	if err := WriteMetadata(src, &Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+	// every write to /dev/full fails with ENOSPC, like a full disk
+	for _, name := range []string{"bundle.tar", "bundle.tar.gz"} {
+		out := filepath.Join(t.TempDir(), name)
+		if err := os.Symlink("/dev/full", out); err != nil {
+			t.Fatal(err)
+		}
+		if err := Pack(src, out); err == nil {
+			t.Errorf("Pack() to a full disk as %s succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package chrony
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config describes the parts of chrony.conf that ops manages.
+type Config struct {
+	// Servers and Pools are written as "server <s>"/"pool <s>". An entry
+	// without options gets "iburst" appended.
+	Servers []string
+	Pools   []string
+	// RefClocks are written as "refclock <s>", e.g. the PTP clock of a
+	// hypervisor.
+	RefClocks []string
+	// Allow and Deny turn the host into an NTP server for the given subnets.
+	Allow []string
+	Deny  []string
+	// LocalStratum keeps serving time to clients when all upstreams are
+	// unreachable; only written when Allow is not empty.
+	LocalStratum int
+	// Base holds the distro specific directives (driftfile, logdir, ...).
+	Base string
+}
+
+// Render returns the chrony.conf content for c.
+func (c *Config) Render() string {
+	var b strings.Builder
+	for _, s := range c.Servers {
+		fmt.Fprintf(&b, "server %s\n", withDefaultOptions(s))
+	}
+	for _, s := range c.Pools {
+		fmt.Fprintf(&b, "pool %s\n", withDefaultOptions(s))
+	}
+	for _, s := range c.RefClocks {
+		fmt.Fprintf(&b, "refclock %s\n", s)
+	}
+	for _, s := range c.Allow {
+		fmt.Fprintf(&b, "allow %s\n", s)
+	}
+	for _, s := range c.Deny {
+		fmt.Fprintf(&b, "deny %s\n", s)
+	}
+	if len(c.Allow) > 0 && c.LocalStratum > 0 {
+		fmt.Fprintf(&b, "local stratum %d\n", c.LocalStratum)
+	}
+	b.WriteString(c.Base)
+	return b.String()
+}
+
+func withDefaultOptions(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.ContainsAny(s, " \t") {
+		return s
+	}
+	return s + " iburst"
+}
+
+// Tracking is the parsed output of `chronyc tracking`.
+type Tracking struct {
+	ReferenceID    string
+	ReferenceName  string
+	Stratum        int
+	SystemOffset   time.Duration // positive when the system clock is ahead
+	LastOffset     time.Duration
+	RootDelay      time.Duration
+	RootDispersion time.Duration
+	LeapStatus     string
+}
+
+// LocalReferenceID is the reference ID chronyd reports when it serves its
+// own clock with the local directive, i.e. no upstream source is reachable.
+const LocalReferenceID = "7F7F0101"
+
+// Synced will return true if chronyd has selected an upstream or hardware
+// reference and the leap status is normal. The local clock does not count.
+func (t *Tracking) Synced() bool {
+	return t.LeapStatus == "Normal" && t.ReferenceID != "" && t.ReferenceID != "00000000" &&
+		t.ReferenceID != LocalReferenceID && t.Stratum > 0 && t.Stratum < 16
+}
+
+// ParseTracking parses the output of `chronyc tracking`, e.g.
+//
+//	Reference ID    : A9FEA9FE (169.254.169.254)
+//	Stratum         : 3
+//	System time     : 0.000001234 seconds slow of NTP time
+//	Last offset     : +0.000000512 seconds
+//	Leap status     : Normal
+func ParseTracking(out string) (*Tracking, error) {
+	t := new(Tracking)
+	found := false
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		found = true
+		switch key {
+		case "Reference ID":
+			fields := strings.Fields(value)
+			if len(fields) > 0 {
+				t.ReferenceID = fields[0]
+			}
+			if len(fields) > 1 {
+				t.ReferenceName = strings.Trim(fields[1], "()")
+			}
+		case "Stratum":
+			t.Stratum, _ = strconv.Atoi(value)
+		case "System time":
+			// "<n> seconds slow|fast of NTP time"
+			fields := strings.Fields(value)
+			if len(fields) >= 3 {
+				t.SystemOffset = parseSeconds(fields[0])
+				if fields[2] == "slow" {
+					t.SystemOffset = -t.SystemOffset
+				}
+			}
+		case "Last offset":
+			t.LastOffset = parseSeconds(firstField(value))
+		case "Root delay":
+			t.RootDelay = parseSeconds(firstField(value))
+		case "Root dispersion":
+			t.RootDispersion = parseSeconds(firstField(value))
+		case "Leap status":
+			t.LeapStatus = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("unexpected chronyc tracking output: %q", out)
+	}
+	return t, nil
+}
+
+// Source is one line of `chronyc sources`.
+type Source struct {
+	Mode    string // ^ server, = peer, # local reference clock
+	State   string // * selected, + combined, - not combined, ? unreachable, x falseticker, ~ too variable
+	Name    string
+	Stratum int
+	Poll    int
+	Reach   int // octal reachability register
+	LastRx  string
+	Sample  string
+}
+
+// Selected will return true for the source chronyd is synchronised to.
+func (s *Source) Selected() bool {
+	return s.State == "*"
+}
+
+// ParseSources parses the output of `chronyc sources`, e.g.
+//
+//	MS Name/IP address         Stratum Poll Reach LastRx Last sample
+//	===============================================================================
+//	^* 169.254.169.254               2   6   377    37   +12us[  +15us] +/-  505us
+func ParseSources(out string) ([]Source, error) {
+	var sources []Source
+	header := true
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if header {
+			header = !strings.HasPrefix(line, "===")
+			continue
+		}
+		if len(line) < 3 {
+			continue
+		}
+		fields := strings.Fields(line[2:])
+		if len(fields) < 5 {
+			continue
+		}
+		s := Source{
+			Mode:   line[0:1],
+			State:  line[1:2],
+			Name:   fields[0],
+			LastRx: fields[4],
+			Sample: strings.Join(fields[5:], " "),
+		}
+		s.Stratum, _ = strconv.Atoi(fields[1])
+		s.Poll, _ = strconv.Atoi(fields[2])
+		reach, _ := strconv.ParseInt(fields[3], 8, 32)
+		s.Reach = int(reach)
+		sources = append(sources, s)
+	}
+	if header {
+		return nil, fmt.Errorf("unexpected chronyc sources output: %q", out)
+	}
+	return sources, scanner.Err()
+}
+
+func firstField(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+func parseSeconds(s string) time.Duration {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(f * float64(time.Second))
+}
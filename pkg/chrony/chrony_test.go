@@ -0,0 +1,145 @@
+package chrony
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTracking(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		want    *Tracking
+		synced  bool
+		wantErr bool
+	}{
+		{
+			name: "synced",
+			out: `Reference ID    : A9FEA9FE (169.254.169.254)
+Stratum         : 3
+Ref time (UTC)  : Thu Oct 12 08:00:00 2023
+System time     : 0.000001500 seconds slow of NTP time
+Last offset     : +0.000000512 seconds
+RMS offset      : 0.000012000 seconds
+Frequency       : 1.234 ppm fast
+Root delay      : 0.021500000 seconds
+Root dispersion : 0.000500000 seconds
+Update interval : 64.2 seconds
+Leap status     : Normal
+`,
+			want: &Tracking{
+				ReferenceID: "A9FEA9FE", ReferenceName: "169.254.169.254", Stratum: 3,
+				SystemOffset: -1500 * time.Nanosecond, LastOffset: 512 * time.Nanosecond,
+				RootDelay: 21500 * time.Microsecond, RootDispersion: 500 * time.Microsecond,
+				LeapStatus: "Normal",
+			},
+			synced: true,
+		},
+		{
+			name: "ahead of ntp time",
+			out: `Reference ID    : CA760182 (ntp.aliyun.com)
+Stratum         : 2
+System time     : 0.250000000 seconds fast of NTP time
+Last offset     : -0.001000000 seconds
+Leap status     : Normal
+`,
+			want: &Tracking{
+				ReferenceID: "CA760182", ReferenceName: "ntp.aliyun.com", Stratum: 2,
+				SystemOffset: 250 * time.Millisecond, LastOffset: -time.Millisecond, LeapStatus: "Normal",
+			},
+			synced: true,
+		},
+		{
+			name: "not synchronised",
+			out: `Reference ID    : 00000000 ()
+Stratum         : 0
+Ref time (UTC)  : Thu Jan 01 00:00:00 1970
+System time     : 0.000000000 seconds fast of NTP time
+Leap status     : Not synchronised
+`,
+			want: &Tracking{ReferenceID: "00000000", LeapStatus: "Not synchronised"},
+		},
+		{
+			name: "local clock only",
+			out: `Reference ID    : 7F7F0101 ()
+Stratum         : 10
+Leap status     : Normal
+`,
+			want: &Tracking{ReferenceID: "7F7F0101", Stratum: 10, LeapStatus: "Normal"},
+		},
+		{
+			name: "hardware reference clock",
+			out: `Reference ID    : 50484330 (PHC0)
+Stratum         : 1
+Leap status     : Normal
+`,
+			want:   &Tracking{ReferenceID: "50484330", ReferenceName: "PHC0", Stratum: 1, LeapStatus: "Normal"},
+			synced: true,
+		},
+		{name: "daemon not running", out: "506 Cannot talk to daemon\n", wantErr: true},
+		{name: "empty", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTracking(tt.out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTracking() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTracking() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+			if got.Synced() != tt.synced {
+				t.Errorf("Synced() = %v, want %v", got.Synced(), tt.synced)
+			}
+		})
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	const header = "MS Name/IP address         Stratum Poll Reach LastRx Last sample\n" +
+		"===============================================================================\n"
+	tests := []struct {
+		name    string
+		out     string
+		want    []Source
+		wantErr bool
+	}{
+		{
+			name: "servers",
+			out: header +
+				"^* 169.254.169.254               2   6   377    37   +12us[  +15us] +/-  505us\n" +
+				"^+ time.cloudflare.com           3   7   177   100  -1234us[-1234us] +/-   12ms\n" +
+				"^? 10.0.0.1                      0   6     0     -     +0ns[   +0ns] +/-    0ns\n",
+			want: []Source{
+				{Mode: "^", State: "*", Name: "169.254.169.254", Stratum: 2, Poll: 6, Reach: 0377, LastRx: "37", Sample: "+12us[ +15us] +/- 505us"},
+				{Mode: "^", State: "+", Name: "time.cloudflare.com", Stratum: 3, Poll: 7, Reach: 0177, LastRx: "100", Sample: "-1234us[-1234us] +/- 12ms"},
+				{Mode: "^", State: "?", Name: "10.0.0.1", Poll: 6, LastRx: "-", Sample: "+0ns[ +0ns] +/- 0ns"},
+			},
+		},
+		{
+			name: "refclock with negative poll",
+			out: "210 Number of sources = 1\n" + header +
+				"#* PHC0                          0  -2   377     1    -25ns[  -31ns] +/-  180ns\n",
+			want: []Source{
+				{Mode: "#", State: "*", Name: "PHC0", Poll: -2, Reach: 0377, LastRx: "1", Sample: "-25ns[ -31ns] +/- 180ns"},
+			},
+		},
+		{name: "no sources", out: header},
+		{name: "daemon not running", out: "506 Cannot talk to daemon\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSources(tt.out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSources() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package conf
+
+import "regexp"
+
+// AptConf is an apt.conf file of flat statements such as
+//
+//	APT::Periodic::Unattended-Upgrade "1";
+//
+// Settings inside nested "APT { ... };" blocks are not recognised; a flat
+// statement set after them overrides them.
+type AptConf struct {
+	*File
+}
+
+// LoadAptConf loads the apt.conf file path, see [Load].
+func LoadAptConf(path string) (*AptConf, error) {
+	f, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return &AptConf{File: f}, nil
+}
+
+var aptStatement = regexp.MustCompile(`^\s*([A-Za-z0-9_:.\-]+)\s+"([^"]*)"\s*;\s*$`)
+
+var aptSyntax = syntax{
+	parse: func(line string) (string, string, bool) {
+		m := aptStatement.FindStringSubmatch(line)
+		if m == nil {
+			return "", "", false
+		}
+		return m[1], m[2], true
+	},
+	render: func(key, value string) string {
+		return key + " \"" + value + "\";"
+	},
+	comments: []string{"//", "#"},
+}
+
+// Get returns the value of key, without quotes.
+func (a *AptConf) Get(key string) (string, bool) {
+	return aptSyntax.get(a.Lines, 0, len(a.Lines), key)
+}
+
+// Set sets key to value and reports whether the file changed.
+func (a *AptConf) Set(key, value string) bool {
+	var changed bool
+	a.Lines, changed = aptSyntax.set(a.Lines, 0, len(a.Lines), key, value)
+	return changed
+}
+
+// Unset removes the statements setting key and reports whether there were
+// any.
+func (a *AptConf) Unset(key string) bool {
+	var changed bool
+	a.Lines, changed = aptSyntax.unset(a.Lines, 0, len(a.Lines), key)
+	return changed
+}
@@ -0,0 +1,103 @@
+package conf
+
+import (
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Markers around a managed block, followed by its name.
+const (
+	BlockBegin = "# BEGIN ops "
+	BlockEnd   = "# END ops "
+)
+
+// block returns the range of the lines of the block name, markers
+// included, or -1 if it is missing or has no end marker.
+func (f *File) block(name string) (begin, end int) {
+	begin = -1
+	for i, line := range f.Lines {
+		switch strings.TrimSpace(line) {
+		case BlockBegin + name:
+			// a begin marker without end is not part of the block
+			begin = i
+		case BlockEnd + name:
+			if begin >= 0 {
+				return begin, i + 1
+			}
+		}
+	}
+	return -1, -1
+}
+
+// blockEnd returns the index after the end marker of the managed block
+// starting at line i, or -1 if line i does not begin a complete block.
+func (f *File) blockEnd(i int) int {
+	name, ok := strings.CutPrefix(strings.TrimSpace(f.Lines[i]), BlockBegin)
+	if !ok {
+		return -1
+	}
+	for j := i + 1; j < len(f.Lines); j++ {
+		switch strings.TrimSpace(f.Lines[j]) {
+		case BlockBegin + name:
+			return -1
+		case BlockEnd + name:
+			return j + 1
+		}
+	}
+	return -1
+}
+
+// Block returns the content of the block name, without its markers.
+func (f *File) Block(name string) (string, bool) {
+	begin, end := f.block(name)
+	if begin < 0 {
+		return "", false
+	}
+	var b strings.Builder
+	for _, line := range f.Lines[begin+1 : end-1] {
+		b.WriteString(line + "\n")
+	}
+	return b.String(), true
+}
+
+// SetBlock puts text between "# BEGIN ops name" and "# END ops name"
+// lines, replacing the previous content of the block in place or appending
+// it, and leaves the rest of the file alone. It reports whether the file
+// changed.
+func (f *File) SetBlock(name, text string) bool {
+	lines := []string{BlockBegin + name}
+	if text = strings.TrimSuffix(text, "\n"); text != "" {
+		lines = append(lines, strings.Split(text, "\n")...)
+	}
+	lines = append(lines, BlockEnd+name)
+
+	begin, end := f.block(name)
+	if begin < 0 {
+		if n := len(f.Lines); n > 0 && strings.TrimSpace(f.Lines[n-1]) != "" {
+			f.Lines = append(f.Lines, "")
+		}
+		f.Lines = append(f.Lines, lines...)
+		return true
+	}
+	if slices.Equal(f.Lines[begin:end], lines) {
+		return false
+	}
+	f.Lines = append(f.Lines[:begin], append(lines, f.Lines[end:]...)...)
+	return true
+}
+
+// RemoveBlock removes the block name, markers included, and reports whether
+// it was present.
+func (f *File) RemoveBlock(name string) bool {
+	begin, end := f.block(name)
+	if begin < 0 {
+		return false
+	}
+	// drop the blank line SetBlock added before an appended block
+	if end == len(f.Lines) && begin > 0 && strings.TrimSpace(f.Lines[begin-1]) == "" {
+		begin--
+	}
+	f.Lines = append(f.Lines[:begin], f.Lines[end:]...)
+	return true
+}
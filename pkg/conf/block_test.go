@@ -0,0 +1,175 @@
+package conf
+
+import (
+	"strings"
+	"testing"
+)
+
+func parse(s string) *File {
+	f := &File{orig: s, exists: true}
+	if s != "" {
+		f.Lines = strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	}
+	return f
+}
+
+func TestSetBlock(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		text    string
+		want    string
+		changed bool
+	}{
+		{
+			name:    "append to empty file",
+			text:    "alias ll='ls -l'\n",
+			want:    "# BEGIN ops aliases\nalias ll='ls -l'\n# END ops aliases\n",
+			changed: true,
+		},
+		{
+			name:    "append after a blank line",
+			data:    "# .bashrc\nexport EDITOR=vi\n",
+			text:    "alias ll='ls -l'",
+			want:    "# .bashrc\nexport EDITOR=vi\n\n# BEGIN ops aliases\nalias ll='ls -l'\n# END ops aliases\n",
+			changed: true,
+		},
+		{
+			name:    "replace in place",
+			data:    "a\n# BEGIN ops aliases\nalias l=ls\n# END ops aliases\nb\n",
+			text:    "alias ll='ls -l'\nalias la='ls -a'\n",
+			want:    "a\n# BEGIN ops aliases\nalias ll='ls -l'\nalias la='ls -a'\n# END ops aliases\nb\n",
+			changed: true,
+		},
+		{
+			name: "unchanged",
+			data: "a\n# BEGIN ops aliases\nalias ll='ls -l'\n# END ops aliases\n",
+			text: "alias ll='ls -l'\n",
+			want: "a\n# BEGIN ops aliases\nalias ll='ls -l'\n# END ops aliases\n",
+		},
+		{
+			name:    "empty block",
+			data:    "# BEGIN ops aliases\nalias l=ls\n# END ops aliases\n",
+			want:    "# BEGIN ops aliases\n# END ops aliases\n",
+			changed: true,
+		},
+		{
+			name:    "other blocks are kept",
+			data:    "# BEGIN ops terminal\nexport LANG=C\n# END ops terminal\n",
+			text:    "alias l=ls",
+			want:    "# BEGIN ops terminal\nexport LANG=C\n# END ops terminal\n\n# BEGIN ops aliases\nalias l=ls\n# END ops aliases\n",
+			changed: true,
+		},
+		{
+			// 缺少结束标记时不视为受管块，追加新块
+			name:    "begin marker without end",
+			data:    "# BEGIN ops aliases\nalias l=ls\n",
+			text:    "alias l=ls",
+			want:    "# BEGIN ops aliases\nalias l=ls\n\n# BEGIN ops aliases\nalias l=ls\n# END ops aliases\n",
+			changed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := "aliases"
+			f := parse(tt.data)
+			if changed := f.SetBlock(name, tt.text); changed != tt.changed {
+				t.Errorf("SetBlock() = %v, want %v", changed, tt.changed)
+			}
+			if got := f.String(); got != tt.want {
+				t.Errorf("content =\n%s\nwant\n%s", got, tt.want)
+			}
+			if f.SetBlock(name, tt.text) {
+				t.Error("second SetBlock() changed the file")
+			}
+			if got, ok := f.Block(name); !ok || strings.TrimSuffix(got, "\n") != strings.TrimSuffix(tt.text, "\n") {
+				t.Errorf("Block() = %q, %v, want %q", got, ok, tt.text)
+			}
+		})
+	}
+}
+
+func TestRemoveBlock(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		removed bool
+	}{
+		{
+			name:    "appended block and its blank line",
+			data:    "export EDITOR=vi\n\n# BEGIN ops aliases\nalias l=ls\n# END ops aliases\n",
+			want:    "export EDITOR=vi\n",
+			removed: true,
+		},
+		{
+			name:    "block in the middle",
+			data:    "a\n\n# BEGIN ops aliases\nalias l=ls\n# END ops aliases\nb\n",
+			want:    "a\n\nb\n",
+			removed: true,
+		},
+		{name: "missing", data: "a\n", want: "a\n"},
+		{name: "without end marker", data: "# BEGIN ops aliases\na\n", want: "# BEGIN ops aliases\na\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := parse(tt.data)
+			if removed := f.RemoveBlock("aliases"); removed != tt.removed {
+				t.Errorf("RemoveBlock() = %v, want %v", removed, tt.removed)
+			}
+			if got := f.String(); got != tt.want {
+				t.Errorf("content =\n%s\nwant\n%s", got, tt.want)
+			}
+			if _, ok := f.Block("aliases"); ok {
+				t.Error("Block() found after RemoveBlock()")
+			}
+		})
+	}
+}
+
+func TestRemoveText(t *testing.T) {
+	text := "export LANG=en_US.UTF-8\nexport LC_ALL=en_US.UTF-8\n"
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		removed bool
+	}{
+		{
+			name:    "every run",
+			data:    "a\nexport LANG=en_US.UTF-8\nexport LC_ALL=en_US.UTF-8\nb\n  export LANG=en_US.UTF-8\nexport LC_ALL=en_US.UTF-8  \n",
+			want:    "a\nb\n",
+			removed: true,
+		},
+		{
+			// 只匹配部分行的用户配置保留
+			name: "partial run is kept",
+			data: "export LANG=en_US.UTF-8\nexport LC_ALL=C\nexport LANG=en_US.UTF-8\n",
+			want: "export LANG=en_US.UTF-8\nexport LC_ALL=C\nexport LANG=en_US.UTF-8\n",
+		},
+		{name: "empty file", data: "", want: ""},
+		{
+			name:    "managed blocks are kept",
+			data:    "# BEGIN ops terminal\nexport LANG=en_US.UTF-8\nexport LC_ALL=en_US.UTF-8\n# END ops terminal\nexport LANG=en_US.UTF-8\nexport LC_ALL=en_US.UTF-8\n",
+			want:    "# BEGIN ops terminal\nexport LANG=en_US.UTF-8\nexport LC_ALL=en_US.UTF-8\n# END ops terminal\n",
+			removed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := parse(tt.data)
+			if removed := f.RemoveText(text); removed != tt.removed {
+				t.Errorf("RemoveText() = %v, want %v", removed, tt.removed)
+			}
+			if got := f.String(); got != tt.want {
+				t.Errorf("content =\n%s\nwant\n%s", got, tt.want)
+			}
+			if f.Changed() != tt.removed {
+				t.Errorf("Changed() = %v, want %v", f.Changed(), tt.removed)
+			}
+		})
+	}
+	if parse("a\n").RemoveText("") {
+		t.Error("RemoveText(\"\") removed lines")
+	}
+}
@@ -0,0 +1,267 @@
+// Package conf edits configuration files in place: it changes the lines
+// holding a setting and keeps everything else, comments included, as is.
+// Every edit is idempotent and reports whether it changed anything, and
+// [File.Save] only writes files that changed.
+package conf
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"stkey/pkg/script"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// File is the content of a configuration file as lines, without their
+// newlines. A missing file loads empty and is only created if edited.
+type File struct {
+	Path  string
+	Lines []string
+
+	orig   string
+	exists bool
+}
+
+// Load reads the file path, resolved under the root set by
+// [script.SetRoot].
+func Load(path string) (*File, error) {
+	b, err := os.ReadFile(script.Path(path))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	f := &File{Path: path, orig: string(b), exists: err == nil}
+	if len(b) > 0 {
+		f.Lines = strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	}
+	return f, nil
+}
+
+// String returns the content of f, each line ending with a newline.
+func (f *File) String() string {
+	if len(f.Lines) == 0 {
+		return ""
+	}
+	return strings.Join(f.Lines, "\n") + "\n"
+}
+
+// Exists reports whether the file existed when loaded or has been saved.
+func (f *File) Exists() bool {
+	return f.exists
+}
+
+// Changed reports whether f differs from the file on disk.
+func (f *File) Changed() bool {
+	return f.String() != f.orig
+}
+
+// Save writes f back atomically if it changed, see [script.Pipe.WriteFile],
+// creating its directory if needed, and reports whether it wrote it.
+func (f *File) Save() (bool, error) {
+	if !f.Changed() {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(script.Path(f.Path)), 0755); err != nil {
+		return false, err
+	}
+	if _, err := script.Echo(f.String()).WriteFile(f.Path); err != nil {
+		return false, err
+	}
+	f.orig, f.exists = f.String(), true
+	return true, nil
+}
+
+// EnsureLine appends line unless a line equal to it, ignoring surrounding
+// spaces, is present, and reports whether it appended it.
+func (f *File) EnsureLine(line string) bool {
+	for _, l := range f.Lines {
+		if strings.TrimSpace(l) == strings.TrimSpace(line) {
+			return false
+		}
+	}
+	f.Lines = append(f.Lines, line)
+	return true
+}
+
+// RemoveLine removes the lines equal to line, ignoring surrounding spaces,
+// and reports whether there were any.
+func (f *File) RemoveLine(line string) bool {
+	kept := f.Lines[:0]
+	for _, l := range f.Lines {
+		if strings.TrimSpace(l) != strings.TrimSpace(line) {
+			kept = append(kept, l)
+		}
+	}
+	removed := len(kept) != len(f.Lines)
+	f.Lines = kept
+	return removed
+}
+
+// RemoveText removes every run of consecutive lines equal to the lines of
+// text, ignoring surrounding spaces, e.g. a snippet appended by an older
+// version, and reports whether there was any. Lines matching only part of
+// text and the content of managed blocks, see [File.SetBlock], are kept.
+func (f *File) RemoveText(text string) bool {
+	if text == "" {
+		return false
+	}
+	want := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	kept := make([]string, 0, len(f.Lines))
+	removed := false
+	for i := 0; i < len(f.Lines); i++ {
+		if end := f.blockEnd(i); end > i {
+			kept = append(kept, f.Lines[i:end]...)
+			i = end - 1
+			continue
+		}
+		if i+len(want) <= len(f.Lines) && equalLines(f.Lines[i:i+len(want)], want) {
+			i += len(want) - 1
+			removed = true
+			continue
+		}
+		kept = append(kept, f.Lines[i])
+	}
+	f.Lines = kept
+	return removed
+}
+
+func equalLines(a, b []string) bool {
+	for i := range a {
+		if strings.TrimSpace(a[i]) != strings.TrimSpace(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// syntax describes how settings are written in a file format.
+type syntax struct {
+	// parse returns the key and value of a setting line; ok is false for
+	// comments, blank lines and other statements.
+	parse func(line string) (key, value string, ok bool)
+	// render returns the line setting key to value.
+	render func(key, value string) string
+	// comments are the prefixes of comment lines.
+	comments []string
+}
+
+// uncomment returns line without its comment prefix, and whether it was a
+// comment.
+func (s syntax) uncomment(line string) (string, bool) {
+	t := strings.TrimSpace(line)
+	for _, c := range s.comments {
+		if strings.HasPrefix(t, c) {
+			return strings.TrimSpace(strings.TrimPrefix(t, c)), true
+		}
+	}
+	return t, false
+}
+
+// setting parses line as an active setting.
+func (s syntax) setting(line string) (key, value string, ok bool) {
+	if _, comment := s.uncomment(line); comment {
+		return "", "", false
+	}
+	return s.parse(line)
+}
+
+// get returns the value of the last setting of key in lines[start:end], as
+// the last one wins in every supported format.
+func (s syntax) get(lines []string, start, end int, key string) (value string, ok bool) {
+	for _, line := range lines[start:end] {
+		if k, v, isSet := s.setting(line); isSet && k == key {
+			value, ok = v, true
+		}
+	}
+	return value, ok
+}
+
+// set makes lines[start:end] set key to value once. The first setting of
+// key is updated and later ones removed; otherwise the setting goes after
+// the last commented-out setting of key, e.g. "#DefaultLimitNOFILE=", or at
+// end. It returns the new lines and whether they changed.
+func (s syntax) set(lines []string, start, end int, key, value string) ([]string, bool) {
+	first, commented := -1, -1
+	changed := false
+	out := append([]string{}, lines[:start]...)
+	for i := start; i < end; i++ {
+		line := lines[i]
+		if k, v, ok := s.setting(line); ok && k == key {
+			if first >= 0 {
+				changed = true
+				continue
+			}
+			first = len(out)
+			if v != value {
+				line = s.render(key, value)
+				changed = true
+			}
+		} else if t, comment := s.uncomment(line); comment {
+			if k, _, ok := s.parse(t); ok && k == key {
+				commented = len(out)
+			}
+		}
+		out = append(out, line)
+	}
+	if first < 0 {
+		at := len(out)
+		if commented >= 0 {
+			at = commented + 1
+		}
+		out = append(out[:at], append([]string{s.render(key, value)}, out[at:]...)...)
+		changed = true
+	}
+	return append(out, lines[end:]...), changed
+}
+
+// setAll makes lines[start:end] set key once per value, in order, for keys
+// that may be set several times. The settings replace the previous ones of
+// key at the place of the first, or go where set would add a setting. It
+// returns the new lines and whether they changed.
+func (s syntax) setAll(lines []string, start, end int, key string, values []string) ([]string, bool) {
+	at, commented := -1, -1
+	out := append([]string{}, lines[:start]...)
+	for i := start; i < end; i++ {
+		line := lines[i]
+		if k, _, ok := s.setting(line); ok && k == key {
+			if at < 0 {
+				at = len(out)
+			}
+			continue
+		}
+		if t, comment := s.uncomment(line); comment {
+			if k, _, ok := s.parse(t); ok && k == key {
+				commented = len(out)
+			}
+		}
+		out = append(out, line)
+	}
+	if at < 0 {
+		at = len(out)
+		if commented >= 0 {
+			at = commented + 1
+		}
+	}
+	settings := make([]string, len(values))
+	for i, v := range values {
+		settings[i] = s.render(key, v)
+	}
+	out = append(out[:at], append(settings, out[at:]...)...)
+	out = append(out, lines[end:]...)
+	return out, !slices.Equal(out, lines)
+}
+
+// unset removes the settings of key from lines[start:end].
+func (s syntax) unset(lines []string, start, end int, key string) ([]string, bool) {
+	out := append([]string{}, lines[:start]...)
+	for _, line := range lines[start:end] {
+		if k, _, ok := s.setting(line); ok && k == key {
+			continue
+		}
+		out = append(out, line)
+	}
+	changed := len(out) != end
+	return append(out, lines[end:]...), changed
+}
@@ -0,0 +1,243 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"stkey/pkg/script"
+	"testing"
+)
+
+func TestKeyValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		sep     string
+		key     string
+		value   string
+		want    string
+		changed bool
+	}{
+		{
+			name: "update in place", data: "# comment\nSELINUX=enforcing\nSELINUXTYPE=targeted\n", sep: "=",
+			key: "SELINUX", value: "disabled",
+			want: "# comment\nSELINUX=disabled\nSELINUXTYPE=targeted\n", changed: true,
+		},
+		{
+			name: "unchanged", data: "SELINUX = disabled\n", sep: "=",
+			key: "SELINUX", value: "disabled",
+			want: "SELINUX = disabled\n",
+		},
+		{
+			name: "later duplicates removed", data: "vm.swappiness=60\nnet.ipv4.ip_forward=1\nvm.swappiness=10\n", sep: "=",
+			key: "vm.swappiness", value: "0",
+			want: "vm.swappiness=0\nnet.ipv4.ip_forward=1\n", changed: true,
+		},
+		{
+			name: "after the commented-out setting", data: "#log_file = /var/log/audit/audit.log\nflush = INCREMENTAL\n", sep: " = ",
+			key: "log_file", value: "/data/audit/audit.log",
+			want: "#log_file = /var/log/audit/audit.log\nlog_file = /data/audit/audit.log\nflush = INCREMENTAL\n", changed: true,
+		},
+		{
+			name: "appended", data: "a=1\n", sep: "=",
+			key: "b", value: "2",
+			want: "a=1\nb=2\n", changed: true,
+		},
+		{
+			name: "space separated", data: "server 10.0.0.1\nmakestep 1.0 3\n", sep: " ",
+			key: "makestep", value: "1 -1",
+			want: "server 10.0.0.1\nmakestep 1 -1\n", changed: true,
+		},
+		{
+			name: "quotes are kept verbatim", data: "GRUB_CMDLINE_LINUX=\"quiet\"\n", sep: "=",
+			key: "GRUB_CMDLINE_LINUX", value: "\"quiet splash\"",
+			want: "GRUB_CMDLINE_LINUX=\"quiet splash\"\n", changed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kv := &KeyValue{File: parse(tt.data), Sep: tt.sep}
+			if changed := kv.Set(tt.key, tt.value); changed != tt.changed {
+				t.Errorf("Set() = %v, want %v", changed, tt.changed)
+			}
+			if got := kv.String(); got != tt.want {
+				t.Errorf("content =\n%s\nwant\n%s", got, tt.want)
+			}
+			if kv.Changed() != tt.changed {
+				t.Errorf("Changed() = %v, want %v", kv.Changed(), tt.changed)
+			}
+			if kv.Set(tt.key, tt.value) {
+				t.Error("second Set() changed the file")
+			}
+			if v, ok := kv.Get(tt.key); !ok || v != tt.value {
+				t.Errorf("Get() = %q, %v, want %q", v, ok, tt.value)
+			}
+		})
+	}
+}
+
+func TestKeyValueUnset(t *testing.T) {
+	kv := &KeyValue{File: parse("a=1\n#a=0\nb=2\na=3\n"), Sep: "="}
+	if !kv.Unset("a") {
+		t.Error("Unset() = false, want true")
+	}
+	if got, want := kv.String(), "#a=0\nb=2\n"; got != want {
+		t.Errorf("content = %q, want %q", got, want)
+	}
+	if kv.Unset("a") {
+		t.Error("second Unset() changed the file")
+	}
+	if _, ok := kv.Get("a"); ok {
+		t.Error("Get() found an unset key")
+	}
+}
+
+const dockerDropIn = `[Unit]
+Description=override
+
+[Service]
+ExecStart=
+ExecStart=/usr/bin/dockerd -H fd://
+Environment=HTTP_PROXY=http://proxy:3128
+# comment
+Environment=NO_PROXY=localhost
+
+[Install]
+WantedBy=multi-user.target
+`
+
+func TestINI(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		edit    func(f *INI) bool
+		want    string
+		changed bool
+	}{
+		{
+			name: "set keeps the section separator",
+			data: "[Manager]\n#DefaultLimitNOFILE=\nDefaultTasksMax=15%\n\n[Other]\n",
+			edit: func(f *INI) bool { return f.Set("Manager", "DefaultLimitNOFILE", "102400") },
+			want: "[Manager]\n#DefaultLimitNOFILE=\nDefaultLimitNOFILE=102400\nDefaultTasksMax=15%\n\n[Other]\n", changed: true,
+		},
+		{
+			name: "set adds a missing section",
+			data: "[Unit]\nDescription=x\n",
+			edit: func(f *INI) bool { return f.Set("Service", "LimitNOFILE", "1048576") },
+			want: "[Unit]\nDescription=x\n\n[Service]\nLimitNOFILE=1048576\n", changed: true,
+		},
+		{
+			name: "set only touches its section",
+			data: "[A]\nk=1\n[B]\nk=1\n",
+			edit: func(f *INI) bool { return f.Set("B", "k", "2") },
+			want: "[A]\nk=1\n[B]\nk=2\n", changed: true,
+		},
+		{
+			name: "add keeps the other values",
+			data: dockerDropIn,
+			edit: func(f *INI) bool { return f.Add("Service", "Environment", "HTTPS_PROXY=http://proxy:3128") },
+			want: "[Unit]\nDescription=override\n\n[Service]\nExecStart=\nExecStart=/usr/bin/dockerd -H fd://\n" +
+				"Environment=HTTP_PROXY=http://proxy:3128\nEnvironment=NO_PROXY=localhost\nEnvironment=HTTPS_PROXY=http://proxy:3128\n# comment\n" +
+				"\n[Install]\nWantedBy=multi-user.target\n",
+			changed: true,
+		},
+		{
+			name: "add present value",
+			data: dockerDropIn,
+			edit: func(f *INI) bool { return f.Add("Service", "Environment", "NO_PROXY=localhost") },
+			want: dockerDropIn,
+		},
+		{
+			name: "set list keeps the reset",
+			data: dockerDropIn,
+			edit: func(f *INI) bool {
+				return f.SetList("Service", "ExecStart", "/usr/bin/dockerd -H fd:// --containerd=/run/containerd/containerd.sock")
+			},
+			want: "[Unit]\nDescription=override\n\n[Service]\nExecStart=\nExecStart=/usr/bin/dockerd -H fd:// --containerd=/run/containerd/containerd.sock\n" +
+				"Environment=HTTP_PROXY=http://proxy:3128\n# comment\nEnvironment=NO_PROXY=localhost\n\n[Install]\nWantedBy=multi-user.target\n",
+			changed: true,
+		},
+		{
+			name: "set list unchanged",
+			data: dockerDropIn,
+			edit: func(f *INI) bool { return f.SetList("Service", "ExecStart", "/usr/bin/dockerd -H fd://") },
+			want: dockerDropIn,
+		},
+		{
+			name: "set list in a new file",
+			edit: func(f *INI) bool { return f.SetList("Service", "ExecStart", "/usr/bin/dockerd") },
+			want: "[Service]\nExecStart=\nExecStart=/usr/bin/dockerd\n", changed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &INI{File: parse(tt.data)}
+			if changed := tt.edit(f); changed != tt.changed {
+				t.Errorf("edit = %v, want %v", changed, tt.changed)
+			}
+			if got := f.String(); got != tt.want {
+				t.Errorf("content =\n%s\nwant\n%s", got, tt.want)
+			}
+			if tt.edit(f) {
+				t.Error("second edit changed the file")
+			}
+		})
+	}
+}
+
+func TestINIValues(t *testing.T) {
+	f := &INI{File: parse(dockerDropIn)}
+	if got, want := f.Values("Service", "ExecStart"), []string{"", "/usr/bin/dockerd -H fd://"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Values() = %q, want %q", got, want)
+	}
+	if got := f.Values("Missing", "ExecStart"); got != nil {
+		t.Errorf("Values() of a missing section = %q", got)
+	}
+	if v, ok := f.Get("Service", "Environment"); !ok || v != "NO_PROXY=localhost" {
+		t.Errorf("Get() = %q, %v, want the last value", v, ok)
+	}
+}
+
+func TestAptConf(t *testing.T) {
+	a := &AptConf{File: parse("// managed by ops\nAPT::Periodic::Update-Package-Lists \"1\";\nAPT::Periodic::Unattended-Upgrade \"1\";\n")}
+	if !a.Set("APT::Periodic::Unattended-Upgrade", "0") || a.Set("APT::Periodic::Unattended-Upgrade", "0") {
+		t.Error("Set() is not idempotent")
+	}
+	if got, want := a.String(), "// managed by ops\nAPT::Periodic::Update-Package-Lists \"1\";\nAPT::Periodic::Unattended-Upgrade \"0\";\n"; got != want {
+		t.Errorf("content =\n%s\nwant\n%s", got, want)
+	}
+	if v, ok := a.Get("APT::Periodic::Update-Package-Lists"); !ok || v != "1" {
+		t.Errorf("Get() = %q, %v, want 1", v, ok)
+	}
+}
+
+func TestSave(t *testing.T) {
+	root := t.TempDir()
+	script.SetRoot(root)
+	t.Cleanup(func() { script.SetRoot("") })
+
+	f, err := Load("/etc/sysctl.d/ops.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Exists() {
+		t.Error("missing file exists")
+	}
+	if saved, err := f.Save(); saved || err != nil {
+		t.Errorf("Save() of an unchanged missing file = %v, %v", saved, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "/etc/sysctl.d")); !os.IsNotExist(err) {
+		t.Error("directory created for an unchanged file")
+	}
+	f.EnsureLine("vm.swappiness = 0")
+	if saved, err := f.Save(); !saved || err != nil {
+		t.Fatalf("Save() = %v, %v, want saved", saved, err)
+	}
+	if saved, _ := f.Save(); saved {
+		t.Error("second Save() wrote the file")
+	}
+	f, _ = Load("/etc/sysctl.d/ops.conf")
+	if !f.Exists() || f.EnsureLine("  vm.swappiness = 0") || f.String() != "vm.swappiness = 0\n" {
+		t.Errorf("reloaded %q, exists %v", f.String(), f.Exists())
+	}
+}
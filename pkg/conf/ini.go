@@ -0,0 +1,166 @@
+package conf
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// SystemdDir is where local systemd units and drop-ins are written.
+const SystemdDir = "/etc/systemd/system"
+
+// INI is a file of "[section]" headers followed by "key=value" lines, e.g.
+// a systemd unit, drop-in or /etc/systemd/system.conf.
+type INI struct {
+	*File
+}
+
+// LoadINI loads the INI file path, see [Load].
+func LoadINI(path string) (*INI, error) {
+	f, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return &INI{File: f}, nil
+}
+
+// DropIn returns the path of the drop-in name of the systemd unit, e.g.
+// DropIn("docker.service", "ops-limits") for
+// /etc/systemd/system/docker.service.d/ops-limits.conf. Run systemctl
+// daemon-reload after saving it.
+func DropIn(unit, name string) string {
+	return filepath.Join(SystemdDir, unit+".d", name+".conf")
+}
+
+var iniSyntax = syntax{
+	parse: func(line string) (string, string, bool) {
+		k, v, ok := strings.Cut(line, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" || strings.ContainsAny(k, " \t[") {
+			return "", "", false
+		}
+		return k, strings.TrimSpace(v), true
+	},
+	render: func(key, value string) string {
+		return key + "=" + value
+	},
+	comments: []string{"#", ";"},
+}
+
+// section returns the range of the lines of section, after its header, or
+// -1 if it is missing. Lines before the first header are section "".
+func (f *INI) section(name string) (start, end int) {
+	start = -1
+	if name == "" {
+		start = 0
+	}
+	for i, line := range f.Lines {
+		t := strings.TrimSpace(line)
+		if !strings.HasPrefix(t, "[") || !strings.HasSuffix(t, "]") {
+			continue
+		}
+		if start >= 0 {
+			return start, i
+		}
+		if t[1:len(t)-1] == name {
+			start = i + 1
+		}
+	}
+	return start, len(f.Lines)
+}
+
+// Get returns the value of key in section.
+func (f *INI) Get(section, key string) (string, bool) {
+	start, end := f.section(section)
+	if start < 0 {
+		return "", false
+	}
+	return iniSyntax.get(f.Lines, start, end, key)
+}
+
+// Values returns the values of every setting of key in section, in order,
+// including the empty values resetting a list, e.g. "ExecStart=".
+func (f *INI) Values(section, key string) []string {
+	start, end := f.section(section)
+	if start < 0 {
+		return nil
+	}
+	var values []string
+	for _, line := range f.Lines[start:end] {
+		if k, v, ok := iniSyntax.setting(line); ok && k == key {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Set sets key to value in section, adding the section at the end if it is
+// missing, and reports whether the file changed. Later settings of key are
+// removed, use [INI.Add] or [INI.SetList] for keys that may be set several
+// times.
+func (f *INI) Set(section, key, value string) bool {
+	return f.edit(section, key, []string{value}, func(lines []string, start, end int) ([]string, bool) {
+		return iniSyntax.set(lines, start, end, key, value)
+	})
+}
+
+// Add adds the setting key=value to section unless it is present, for keys
+// such as Environment= of a systemd unit that may be set several times, and
+// reports whether the file changed.
+func (f *INI) Add(section, key, value string) bool {
+	values := f.Values(section, key)
+	if slices.Contains(values, value) {
+		return false
+	}
+	values = append(values, value)
+	return f.edit(section, key, values, func(lines []string, start, end int) ([]string, bool) {
+		return iniSyntax.setAll(lines, start, end, key, values)
+	})
+}
+
+// SetList makes section set the list key to exactly values: a "key=" line
+// resetting what earlier files set, e.g. the ExecStart= of the unit a
+// drop-in overrides, followed by a line per value. It reports whether the
+// file changed.
+func (f *INI) SetList(section, key string, values ...string) bool {
+	values = append([]string{""}, values...)
+	return f.edit(section, key, values, func(lines []string, start, end int) ([]string, bool) {
+		return iniSyntax.setAll(lines, start, end, key, values)
+	})
+}
+
+// edit applies set to the lines of section, or adds the section with key
+// set to values at the end if it is missing.
+func (f *INI) edit(section, key string, values []string, set func(lines []string, start, end int) ([]string, bool)) bool {
+	start, end := f.section(section)
+	if start < 0 {
+		if n := len(f.Lines); n > 0 && strings.TrimSpace(f.Lines[n-1]) != "" {
+			f.Lines = append(f.Lines, "")
+		}
+		f.Lines = append(f.Lines, "["+section+"]")
+		for _, v := range values {
+			f.Lines = append(f.Lines, iniSyntax.render(key, v))
+		}
+		return true
+	}
+	// keep the blank lines separating the section from the next one
+	for end > start && strings.TrimSpace(f.Lines[end-1]) == "" {
+		end--
+	}
+	var changed bool
+	f.Lines, changed = set(f.Lines, start, end)
+	return changed
+}
+
+// Unset removes the settings of key in section and reports whether there
+// were any.
+func (f *INI) Unset(section, key string) bool {
+	start, end := f.section(section)
+	if start < 0 {
+		return false
+	}
+	var changed bool
+	f.Lines, changed = iniSyntax.unset(f.Lines, start, end, key)
+	return changed
+}
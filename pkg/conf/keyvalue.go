@@ -0,0 +1,64 @@
+package conf
+
+import "strings"
+
+// KeyValue is a file of "key=value" lines, e.g. sysctl.conf,
+// /etc/selinux/config or the shell variables of /etc/default and
+// /etc/sysconfig. Values are kept verbatim, quotes included.
+type KeyValue struct {
+	*File
+	// Sep is written between keys and values, e.g. "=" or " = ". Lines
+	// are parsed at the first "=", or at the first space if Sep is blank.
+	Sep string
+}
+
+// LoadKeyValue loads the key=value file path, see [Load].
+func LoadKeyValue(path, sep string) (*KeyValue, error) {
+	f, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyValue{File: f, Sep: sep}, nil
+}
+
+func (kv *KeyValue) syntax() syntax {
+	return syntax{
+		parse: func(line string) (string, string, bool) {
+			var k, v string
+			var ok bool
+			if strings.TrimSpace(kv.Sep) == "" {
+				k, v, ok = strings.Cut(strings.TrimSpace(line), " ")
+			} else {
+				k, v, ok = strings.Cut(line, strings.TrimSpace(kv.Sep))
+			}
+			k = strings.TrimSpace(k)
+			if !ok || k == "" || strings.ContainsAny(k, " \t") {
+				return "", "", false
+			}
+			return k, strings.TrimSpace(v), true
+		},
+		render: func(key, value string) string {
+			return key + kv.Sep + value
+		},
+		comments: []string{"#", ";"},
+	}
+}
+
+// Get returns the value of key.
+func (kv *KeyValue) Get(key string) (string, bool) {
+	return kv.syntax().get(kv.Lines, 0, len(kv.Lines), key)
+}
+
+// Set sets key to value and reports whether the file changed.
+func (kv *KeyValue) Set(key, value string) bool {
+	var changed bool
+	kv.Lines, changed = kv.syntax().set(kv.Lines, 0, len(kv.Lines), key, value)
+	return changed
+}
+
+// Unset removes the settings of key and reports whether there were any.
+func (kv *KeyValue) Unset(key string) bool {
+	var changed bool
+	kv.Lines, changed = kv.syntax().unset(kv.Lines, 0, len(kv.Lines), key)
+	return changed
+}
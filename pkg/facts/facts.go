@@ -0,0 +1,232 @@
+// Package facts gathers identification facts of the host and pushes them to
+// an HTTP endpoint when they change.
+package facts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"stkey/pkg/network"
+	osinfo "stkey/pkg/os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is incremented on incompatible changes of [Facts]. Fields
+// may be added without a version change, never renamed or removed.
+const SchemaVersion = 1
+
+const (
+	ProcUptime = "/proc/uptime"
+	ProcStat   = "/proc/stat"
+	// DMIDir holds the SMBIOS identification of the machine.
+	DMIDir = "/sys/class/dmi/id"
+)
+
+// MachineIDFiles are searched in order for the machine id.
+var MachineIDFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// Facts is the document pushed to the facts endpoint.
+type Facts struct {
+	SchemaVersion int    `json:"schema_version"`
+	Hostname      string `json:"hostname"`
+	// PrimaryIP is the first IPv4 address of the default route interface.
+	PrimaryIP   string   `json:"primary_ip"`
+	IPs         []string `json:"ips"`
+	MachineID   string   `json:"machine_id"`
+	Serial      string   `json:"serial"`
+	ProductUUID string   `json:"product_uuid"`
+	Vendor      string   `json:"vendor"`
+	Product     string   `json:"product"`
+	OS          OS       `json:"os"`
+	// BootTime is the Unix time the host booted.
+	BootTime int64 `json:"boot_time"`
+	// UptimeSeconds and CollectedAt change on every run and are left out of
+	// the [Facts.Fingerprint].
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	CollectedAt   time.Time `json:"collected_at"`
+}
+
+// OS holds the distro facts of [osinfo.Data].
+type OS struct {
+	ID             string `json:"id"`
+	IDLike         string `json:"id_like"`
+	Name           string `json:"name"`
+	PrettyName     string `json:"pretty_name"`
+	VersionID      string `json:"version_id"`
+	Codename       string `json:"codename"`
+	Kernel         string `json:"kernel"`
+	Arch           string `json:"arch"`
+	Virtualization string `json:"virtualization"`
+	Cloud          string `json:"cloud"`
+	Container      string `json:"container"`
+}
+
+// Gather collects the facts of the running host. Facts that cannot be read,
+// e.g. the serial number as an unprivileged user, are left empty.
+func Gather(d *osinfo.Data) (*Facts, error) {
+	f := &Facts{
+		SchemaVersion: SchemaVersion,
+		MachineID:     MachineID(),
+		Serial:        readDMI("product_serial"),
+		ProductUUID:   strings.ToLower(readDMI("product_uuid")),
+		Vendor:        readDMI("sys_vendor"),
+		Product:       readDMI("product_name"),
+		CollectedAt:   time.Now().UTC().Truncate(time.Second),
+	}
+	if f.Serial == "" {
+		// arm boards without SMBIOS
+		f.Serial = strings.Trim(readFile("/proc/device-tree/serial-number"), "\x00")
+	}
+	if d != nil {
+		f.OS = OS{
+			ID:             d.ID,
+			IDLike:         d.IDLike,
+			Name:           d.Name,
+			PrettyName:     d.PrettyName,
+			VersionID:      d.VersionID,
+			Codename:       d.Codename,
+			Kernel:         d.Kernel,
+			Arch:           d.Arch,
+			Virtualization: d.Virtualization,
+			Cloud:          d.Cloud,
+			Container:      d.Container,
+		}
+	}
+
+	var err error
+	if f.Hostname, err = Hostname(); err != nil {
+		return nil, err
+	}
+	if f.IPs, err = IPs(); err != nil {
+		return nil, err
+	}
+	f.PrimaryIP = PrimaryIP()
+	if up, err := Uptime(); err == nil {
+		f.UptimeSeconds = int64(up.Seconds())
+	}
+	f.BootTime = BootTime()
+	return f, nil
+}
+
+// Fingerprint returns a hash of the facts that identify the state of the
+// host, ignoring the ones changing on every run.
+func (f *Facts) Fingerprint() string {
+	c := *f
+	c.UptimeSeconds = 0
+	c.CollectedAt = time.Time{}
+	b, _ := json.Marshal(c)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Hostname returns the kernel host name.
+func Hostname() (string, error) {
+	return os.Hostname()
+}
+
+// IPs returns the global unicast addresses of all interfaces that are up,
+// IPv4 first, like `hostname -I`.
+func IPs() ([]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var v4, v6 []string
+	for _, i := range ifaces {
+		if i.Flags&net.FlagUp == 0 || i.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := i.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ip, _, err := net.ParseCIDR(a.String())
+			if err != nil || !ip.IsGlobalUnicast() {
+				continue
+			}
+			if ip.To4() != nil {
+				v4 = append(v4, ip.String())
+			} else {
+				v6 = append(v6, ip.String())
+			}
+		}
+	}
+	return append(append([]string{}, v4...), v6...), nil
+}
+
+// PrimaryIP returns the first IPv4 address of the interface holding the
+// default route, falling back to the first address of [IPs].
+func PrimaryIP() string {
+	if iface, err := network.DefaultInterface(); err == nil {
+		for _, a := range iface.Addrs {
+			ip, _, err := net.ParseCIDR(a)
+			if err == nil && ip.To4() != nil && ip.IsGlobalUnicast() {
+				return ip.String()
+			}
+		}
+	}
+	if ips, err := IPs(); err == nil && len(ips) > 0 {
+		return ips[0]
+	}
+	return ""
+}
+
+// MachineID returns the systemd/dbus machine id, "" when not set.
+func MachineID() string {
+	for _, name := range MachineIDFiles {
+		if id := readFile(name); id != "" && id != "uninitialized" {
+			return id
+		}
+	}
+	return ""
+}
+
+// Uptime returns the time since boot.
+func Uptime() (time.Duration, error) {
+	fields := strings.Fields(readFile(ProcUptime))
+	if len(fields) == 0 {
+		return 0, errors.New("unable to read " + ProcUptime)
+	}
+	s, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(s * float64(time.Second)), nil
+}
+
+// BootTime returns the Unix time the host booted, read from the btime line
+// of /proc/stat, which unlike now - uptime does not drift between runs.
+func BootTime() int64 {
+	for _, line := range strings.Split(readFile(ProcStat), "\n") {
+		if v, ok := strings.CutPrefix(line, "btime "); ok {
+			t, _ := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			return t
+		}
+	}
+	return 0
+}
+
+// readDMI returns a DMI attribute, ignoring the placeholders of vendors that
+// leave the fields unset.
+func readDMI(attr string) string {
+	v := readFile(DMIDir + "/" + attr)
+	switch strings.ToLower(v) {
+	case "", "none", "not specified", "not applicable", "to be filled by o.e.m.", "default string", "0":
+		return ""
+	}
+	return v
+}
+
+func readFile(name string) string {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,137 @@
+package facts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultStatePath records the fingerprint of the last pushed facts.
+const DefaultStatePath = "/var/lib/ops/facts.json"
+
+// FingerprintHeader carries [Facts.Fingerprint] in push requests.
+const FingerprintHeader = "X-Ops-Facts-Fingerprint"
+
+// ErrStateNotSaved is wrapped by the error [Pusher.Push] returns when the
+// facts were sent but the state could not be written.
+var ErrStateNotSaved = errors.New("facts pushed but state not saved")
+
+// State is the record of the last successful push.
+type State struct {
+	Endpoint    string    `json:"endpoint"`
+	Fingerprint string    `json:"fingerprint"`
+	PushedAt    time.Time `json:"pushed_at"`
+	Facts       *Facts    `json:"facts"`
+}
+
+// Pusher sends facts to an HTTP endpoint as a JSON POST request.
+type Pusher struct {
+	Endpoint string
+	// Token is sent as a bearer token when set.
+	Token  string
+	Client *http.Client
+	// StatePath is where the last pushed fingerprint is kept, facts are
+	// pushed on every call when empty.
+	StatePath string
+}
+
+// NewPusher returns a pusher with a 30s timeout using [DefaultStatePath].
+func NewPusher(endpoint string) *Pusher {
+	return &Pusher{
+		Endpoint:  endpoint,
+		Client:    &http.Client{Timeout: 30 * time.Second},
+		StatePath: DefaultStatePath,
+	}
+}
+
+// Changed reports whether f differs from the facts last pushed to the
+// endpoint.
+func (p *Pusher) Changed(f *Facts) bool {
+	s, err := p.readState()
+	if err != nil {
+		return true
+	}
+	return s.Endpoint != p.Endpoint || s.Fingerprint != f.Fingerprint()
+}
+
+// Push sends f to the endpoint unless it is unchanged since the last push,
+// or force is set. It reports whether the facts were sent, also when the
+// error wraps [ErrStateNotSaved].
+func (p *Pusher) Push(f *Facts, force bool) (bool, error) {
+	if !force && !p.Changed(f) {
+		return false, nil
+	}
+	body, err := json.Marshal(f)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest(http.MethodPost, p.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(FingerprintHeader, f.Fingerprint())
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		err := fmt.Errorf("push facts to %s: %s", p.Endpoint, resp.Status)
+		if msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512)); len(bytes.TrimSpace(msg)) > 0 {
+			err = fmt.Errorf("%w: %s", err, bytes.TrimSpace(msg))
+		}
+		return false, err
+	}
+	if err := p.writeState(f); err != nil {
+		return true, fmt.Errorf("%w: %w", ErrStateNotSaved, err)
+	}
+	return true, nil
+}
+
+func (p *Pusher) readState() (*State, error) {
+	if p.StatePath == "" {
+		return nil, os.ErrNotExist
+	}
+	b, err := os.ReadFile(p.StatePath)
+	if err != nil {
+		return nil, err
+	}
+	s := new(State)
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (p *Pusher) writeState(f *Facts) error {
+	if p.StatePath == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(&State{
+		Endpoint:    p.Endpoint,
+		Fingerprint: f.Fingerprint(),
+		PushedAt:    time.Now().UTC().Truncate(time.Second),
+		Facts:       f,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.StatePath), 0755); err != nil {
+		return err
+	}
+	tmp := p.StatePath + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.StatePath)
+}
@@ -0,0 +1,162 @@
+package facts
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// endpoint 记录收到的推送，以status应答
+type endpoint struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []*Facts
+	status   int
+	body     string
+}
+
+func newEndpoint(t *testing.T, status int, body string) *endpoint {
+	e := &endpoint{status: status, body: body}
+	e.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f := new(Facts)
+		if err := json.NewDecoder(r.Body).Decode(f); err != nil {
+			t.Errorf("decode pushed facts: %v", err)
+		}
+		e.mu.Lock()
+		e.requests = append(e.requests, r)
+		e.bodies = append(e.bodies, f)
+		e.mu.Unlock()
+		w.WriteHeader(e.status)
+		_, _ = io.WriteString(w, e.body)
+	}))
+	t.Cleanup(e.Close)
+	return e
+}
+
+func testFacts() *Facts {
+	return &Facts{
+		SchemaVersion: SchemaVersion,
+		Hostname:      "web1",
+		PrimaryIP:     "10.0.0.5",
+		IPs:           []string{"10.0.0.5"},
+		MachineID:     "0123456789abcdef0123456789abcdef",
+		OS:            OS{ID: "centos", VersionID: "7"},
+		BootTime:      1697000000,
+		UptimeSeconds: 100,
+		CollectedAt:   time.Unix(1697000100, 0).UTC(),
+	}
+}
+
+func testPusher(e *endpoint, dir string) *Pusher {
+	p := NewPusher(e.URL)
+	p.StatePath = filepath.Join(dir, "facts.json")
+	return p
+}
+
+func TestPush(t *testing.T) {
+	e := newEndpoint(t, http.StatusNoContent, "")
+	p := testPusher(e, t.TempDir())
+	p.Token = "secret"
+	f := testFacts()
+
+	pushed, err := p.Push(f, false)
+	if err != nil || !pushed {
+		t.Fatalf("Push() = %v, %v, want pushed", pushed, err)
+	}
+	r := e.requests[0]
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("request %s with Content-Type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+	}
+	if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Authorization = %q, want the bearer token", got)
+	}
+	if got := r.Header.Get(FingerprintHeader); got != f.Fingerprint() {
+		t.Errorf("%s = %q, want %q", FingerprintHeader, got, f.Fingerprint())
+	}
+	if e.bodies[0].Hostname != "web1" {
+		t.Errorf("pushed %+v", e.bodies[0])
+	}
+
+	// 只有uptime变化时不推送
+	f.UptimeSeconds += 60
+	f.CollectedAt = f.CollectedAt.Add(time.Minute)
+	if pushed, err := p.Push(f, false); err != nil || pushed {
+		t.Errorf("Push() of unchanged facts = %v, %v, want skipped", pushed, err)
+	}
+	if pushed, err := p.Push(f, true); err != nil || !pushed {
+		t.Errorf("Push(force) = %v, %v, want pushed", pushed, err)
+	}
+	f.PrimaryIP = "10.0.0.6"
+	if pushed, err := p.Push(f, false); err != nil || !pushed {
+		t.Errorf("Push() of changed facts = %v, %v, want pushed", pushed, err)
+	}
+	if len(e.requests) != 3 {
+		t.Errorf("%d requests, want 3", len(e.requests))
+	}
+
+	// 推送到其他endpoint时不使用原状态
+	other := newEndpoint(t, http.StatusOK, "")
+	p.Endpoint = other.URL
+	if pushed, err := p.Push(f, false); err != nil || !pushed {
+		t.Errorf("Push() to a new endpoint = %v, %v, want pushed", pushed, err)
+	}
+}
+
+func TestPushWithoutToken(t *testing.T) {
+	e := newEndpoint(t, http.StatusOK, "")
+	p := testPusher(e, t.TempDir())
+	if _, err := p.Push(testFacts(), false); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := e.requests[0].Header["Authorization"]; ok {
+		t.Errorf("Authorization = %q sent without a token", got)
+	}
+}
+
+func TestPushError(t *testing.T) {
+	e := newEndpoint(t, http.StatusBadRequest, "  invalid schema_version\n")
+	dir := t.TempDir()
+	p := testPusher(e, dir)
+	pushed, err := p.Push(testFacts(), false)
+	if err == nil || pushed {
+		t.Fatalf("Push() = %v, %v, want an error", pushed, err)
+	}
+	if !strings.Contains(err.Error(), "400 Bad Request: invalid schema_version") {
+		t.Errorf("error %q does not contain the status and body", err)
+	}
+	if errors.Is(err, ErrStateNotSaved) {
+		t.Errorf("error %q reported as a state error", err)
+	}
+	if _, err := os.Stat(p.StatePath); !os.IsNotExist(err) {
+		t.Errorf("state saved after a failed push: %v", err)
+	}
+	// 失败后再次运行时重新推送
+	e.status = http.StatusOK
+	if pushed, err := p.Push(testFacts(), false); err != nil || !pushed {
+		t.Errorf("Push() after a failure = %v, %v, want pushed", pushed, err)
+	}
+}
+
+func TestPushStateNotSaved(t *testing.T) {
+	e := newEndpoint(t, http.StatusOK, "")
+	dir := t.TempDir()
+	// 状态文件的父目录是普通文件，无法写入
+	if err := os.WriteFile(filepath.Join(dir, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := NewPusher(e.URL)
+	p.StatePath = filepath.Join(dir, "file", "facts.json")
+	pushed, err := p.Push(testFacts(), false)
+	if !pushed || !errors.Is(err, ErrStateNotSaved) {
+		t.Errorf("Push() = %v, %v, want pushed with ErrStateNotSaved", pushed, err)
+	}
+}
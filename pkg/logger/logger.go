@@ -4,6 +4,7 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -14,14 +15,62 @@ const (
 var (
 	Logger *zap.Logger
 	Sugar  *zap.SugaredLogger
+	// File 只写入日志文件的logger，用于记录外部命令的输出，未调用OpenFile时为nil
+	File *zap.Logger
+
+	console zapcore.Core
+
+	exitMu    sync.Mutex
+	exitFuncs []func()
 )
 
+// AtExit 注册Fatal或Exit退出前执行的清理函数，按注册的逆序执行
+func AtExit(f func()) {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	exitFuncs = append(exitFuncs, f)
+}
+
+// Exit 执行AtExit注册的清理函数后以code退出
+func Exit(code int) {
+	exitMu.Lock()
+	funcs := exitFuncs
+	exitFuncs = nil
+	exitMu.Unlock()
+	for i := len(funcs) - 1; i >= 0; i-- {
+		funcs[i]()
+	}
+	os.Exit(code)
+}
+
+// exitHook Fatal日志写入后执行清理函数再退出
+type exitHook struct{}
+
+func (exitHook) OnWrite(*zapcore.CheckedEntry, []zapcore.Field) {
+	Exit(1)
+}
+
 func Init() {
 	writeSyncer := zapcore.NewMultiWriteSyncer(zapcore.AddSync(os.Stdout))
 	encoder := getEncoder()
-	core := zapcore.NewCore(encoder, writeSyncer, zapcore.DebugLevel)
-	Logger = zap.New(core, zap.AddCaller())
+	console = zapcore.NewCore(encoder, writeSyncer, zapcore.DebugLevel)
+	Logger = zap.New(console, zap.AddCaller(), zap.WithFatalHook(exitHook{}))
+	Sugar = Logger.Sugar()
+}
+
+// OpenFile 以JSON格式将日志追加写入文件path，终端输出不变
+func OpenFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	file := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), zapcore.AddSync(f), zapcore.DebugLevel)
+	File = zap.New(file)
+	Logger = zap.New(zapcore.NewTee(console, file), zap.AddCaller(), zap.WithFatalHook(exitHook{}))
 	Sugar = Logger.Sugar()
+	return nil
 }
 
 func getEncoder() zapcore.Encoder {
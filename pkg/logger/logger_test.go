@@ -0,0 +1,42 @@
+package logger
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// 子进程中注册清理函数后调用Fatal
+func TestFatalRunsExitFuncs(t *testing.T) {
+	if out := os.Getenv("LOGGER_TEST_OUT"); out != "" {
+		Init()
+		for _, s := range []string{"first\n", "second\n"} {
+			s := s
+			AtExit(func() {
+				f, _ := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+				_, _ = f.WriteString(s)
+				_ = f.Close()
+			})
+		}
+		Sugar.Fatal("fatal")
+		return
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFatalRunsExitFuncs$")
+	cmd.Env = append(os.Environ(), "LOGGER_TEST_OUT="+out)
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("Fatal exited with %v, want exit status 1", err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "second\nfirst\n" {
+		t.Errorf("exit funcs wrote %q, want them run in reverse order", b)
+	}
+}
@@ -0,0 +1,276 @@
+package manifest
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	osinfo "stkey/pkg/os"
+	"strconv"
+	"strings"
+)
+
+// Version is the manifest format version understood by this build.
+const Version = 1
+
+// PublicKey is the base64 encoded ed25519 key used to verify manifests,
+// embedded at build time:
+//
+//	go build -ldflags "-X stkey/pkg/manifest.PublicKey=<base64 key>"
+var PublicKey string
+
+// Manifest lists the tools installed by `ops init tools`.
+type Manifest struct {
+	Version int    `json:"version"`
+	Tools   []Tool `json:"tools"`
+}
+
+// Tool is a single file to be installed on one or more paths. A tool either
+// carries a single artifact inline, or a list of artifacts of which the first
+// one matching the host [Platform] is installed.
+type Tool struct {
+	Name  string   `json:"name"`
+	Mode  string   `json:"mode,omitempty"`  // octal, default 0755
+	Owner string   `json:"owner,omitempty"` // user[:group], default root:root
+	Paths []string `json:"paths"`
+	Artifact
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+}
+
+// Artifact is a downloadable build of a tool for some platforms.
+type Artifact struct {
+	URL     string   `json:"url,omitempty"`
+	SHA256  string   `json:"sha256,omitempty"`
+	Arch    string   `json:"arch,omitempty"`    // GOARCH, empty for any
+	Distro  []string `json:"distro,omitempty"`  // os ID or ID_LIKE, empty for any
+	Version string   `json:"version,omitempty"` // e.g. ">=20.04,<24.04", empty for any
+	// Archive is the format of the download (tar.gz, tgz, tar or zip), Member
+	// the file to extract from it. MemberSHA256 is the hash of the extracted
+	// file, used to skip already installed tools.
+	Archive      string `json:"archive,omitempty"`
+	Member       string `json:"member,omitempty"`
+	MemberSHA256 string `json:"member_sha256,omitempty"`
+}
+
+// Platform identifies the host a tool is installed on.
+type Platform struct {
+	Arch      string
+	ID        string
+	IDLike    string
+	VersionID string
+}
+
+func (p Platform) String() string {
+	return fmt.Sprintf("linux/%s %s %s", p.Arch, p.ID, p.VersionID)
+}
+
+// FileMode returns the parsed Mode of t.
+func (t *Tool) FileMode() os.FileMode {
+	m, err := strconv.ParseUint(t.Mode, 8, 32)
+	if t.Mode == "" || err != nil {
+		return 0755
+	}
+	return os.FileMode(m)
+}
+
+// OwnerGroup returns the user and group names of t.
+func (t *Tool) OwnerGroup() (string, string) {
+	if t.Owner == "" {
+		return "root", "root"
+	}
+	u, g, ok := strings.Cut(t.Owner, ":")
+	if !ok {
+		return u, u
+	}
+	return u, g
+}
+
+// Candidates returns the artifacts of t in order of preference.
+func (t *Tool) Candidates() []Artifact {
+	if len(t.Artifacts) > 0 {
+		return t.Artifacts
+	}
+	return []Artifact{t.Artifact}
+}
+
+// Select returns the first artifact of t matching p, or nil if the tool is
+// not available for this platform.
+func (t *Tool) Select(p Platform) *Artifact {
+	for _, a := range t.Candidates() {
+		if a.Match(p) {
+			a := a
+			return &a
+		}
+	}
+	return nil
+}
+
+// Match will return true if a can be installed on p.
+func (a *Artifact) Match(p Platform) bool {
+	if a.Arch != "" && NormalizeArch(a.Arch) != NormalizeArch(p.Arch) {
+		return false
+	}
+	if len(a.Distro) > 0 {
+		ok := false
+		for _, d := range a.Distro {
+			if strings.EqualFold(d, p.ID) || containsWord(p.IDLike, d) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if a.Version == "" {
+		return true
+	}
+	ok, err := osinfo.MatchVersion(p.VersionID, a.Version)
+	return err == nil && ok
+}
+
+// NormalizeArch maps uname style architecture names to GOARCH.
+func NormalizeArch(arch string) string {
+	switch strings.ToLower(arch) {
+	case "x86_64", "x64":
+		return "amd64"
+	case "aarch64", "armv8":
+		return "arm64"
+	case "i386", "i686", "x86":
+		return "386"
+	}
+	return strings.ToLower(arch)
+}
+
+func containsWord(list, word string) bool {
+	for _, w := range strings.Fields(list) {
+		if strings.EqualFold(w, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse decodes and validates a manifest.
+func Parse(data []byte) (*Manifest, error) {
+	m := new(Manifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if m.Version != Version {
+		return nil, fmt.Errorf("unsupported manifest version %d, want %d", m.Version, Version)
+	}
+	for i, t := range m.Tools {
+		if t.Name == "" {
+			return nil, fmt.Errorf("tool #%d: missing name", i)
+		}
+		if err := t.validate(); err != nil {
+			return nil, fmt.Errorf("tool %s: %w", t.Name, err)
+		}
+	}
+	return m, nil
+}
+
+func (t *Tool) validate() error {
+	if t.Mode != "" {
+		if _, err := strconv.ParseUint(t.Mode, 8, 32); err != nil {
+			return fmt.Errorf("invalid mode %q", t.Mode)
+		}
+	}
+	if len(t.Paths) == 0 {
+		return fmt.Errorf("missing paths")
+	}
+	for _, p := range t.Paths {
+		if !filepath.IsAbs(p) || filepath.Clean(p) != p {
+			return fmt.Errorf("path %q must be absolute and clean", p)
+		}
+	}
+	if len(t.Artifacts) > 0 && t.Artifact.URL != "" {
+		return fmt.Errorf("url and artifacts are mutually exclusive")
+	}
+	for _, a := range t.Candidates() {
+		if err := a.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Artifact) validate() error {
+	if a.URL == "" {
+		return fmt.Errorf("missing url")
+	}
+	if !isSHA256(a.SHA256) {
+		return fmt.Errorf("invalid sha256 %q", a.SHA256)
+	}
+	if a.Version != "" {
+		if _, err := osinfo.MatchVersion("0", a.Version); err != nil {
+			return err
+		}
+	}
+	switch a.Archive {
+	case "":
+		if a.Member != "" {
+			return fmt.Errorf("member %q set without archive", a.Member)
+		}
+	case "tar.gz", "tgz", "tar", "zip":
+		if a.Member == "" {
+			return fmt.Errorf("archive %s requires a member", a.URL)
+		}
+	default:
+		return fmt.Errorf("unsupported archive format %q", a.Archive)
+	}
+	if a.MemberSHA256 != "" && !isSHA256(a.MemberSHA256) {
+		return fmt.Errorf("invalid member_sha256 %q", a.MemberSHA256)
+	}
+	return nil
+}
+
+func isSHA256(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == 32
+}
+
+// ParsePublicKey decodes a base64 encoded ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key size %d", len(b))
+	}
+	return b, nil
+}
+
+// ParsePrivateKey decodes a base64 encoded ed25519 private key.
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	if len(b) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid private key size %d", len(b))
+	}
+	return b, nil
+}
+
+// Sign returns the base64 encoded detached signature of data.
+func Sign(data []byte, key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+}
+
+// Verify checks the base64 encoded detached signature sig of data.
+func Verify(data []byte, sig string, key ed25519.PublicKey) error {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(sig))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	if !ed25519.Verify(key, data, b) {
+		return fmt.Errorf("manifest signature verification failed")
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package mirror
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Official is the name of the upstream project repositories.
+	Official = "official"
+	// Auto selects the fastest mirror by probing.
+	Auto = "auto"
+)
+
+// Repository names, also the default path of the repository on a mirror.
+const (
+	CentOS      = "centos"
+	CentOSVault = "centos-vault"
+	EPEL        = "epel"
+	EPELArchive = "epel-archive"
+	Ubuntu      = "ubuntu"
+	// UbuntuPorts serves Ubuntu for architectures other than amd64 and i386.
+	UbuntuPorts = "ubuntu-ports"
+	Debian      = "debian"
+	DockerCE    = "docker-ce"
+)
+
+// Mirror is a site serving copies of the distro repositories.
+type Mirror struct {
+	Name string
+	URL  string
+	// Repos overrides the URL of a repository, the default is URL/<repo>.
+	Repos map[string]string
+	// Cloud is set for mirrors only reachable from the internal network of
+	// a cloud provider, see os.Data.Cloud.
+	Cloud string
+}
+
+// Registry lists the well-known mirrors.
+var Registry = []*Mirror{
+	{Name: "tencent", URL: "https://mirrors.cloud.tencent.com"},
+	{Name: "aliyun", URL: "https://mirrors.aliyun.com"},
+	{Name: "huawei", URL: "https://repo.huaweicloud.com"},
+	{Name: "tsinghua", URL: "https://mirrors.tuna.tsinghua.edu.cn"},
+	{Name: "tencent-internal", URL: "http://mirrors.tencentyun.com", Cloud: "tencent"},
+	{Name: "aliyun-internal", URL: "http://mirrors.cloud.aliyuncs.com", Cloud: "aliyun"},
+	{Name: "huawei-internal", URL: "https://repo.myhuaweicloud.com", Cloud: "huaweicloud"},
+	{Name: Official, Repos: map[string]string{
+		CentOS:      "http://mirror.centos.org/centos",
+		CentOSVault: "https://vault.centos.org",
+		EPEL:        "https://dl.fedoraproject.org/pub/epel",
+		EPELArchive: "https://archives.fedoraproject.org/pub/archive/epel",
+		Ubuntu:      "http://archive.ubuntu.com/ubuntu",
+		UbuntuPorts: "http://ports.ubuntu.com/ubuntu-ports",
+		Debian:      "http://deb.debian.org/debian",
+		DockerCE:    "https://download.docker.com",
+	}},
+}
+
+// RepoURL returns the base URL of repo on m, without trailing slash.
+func (m *Mirror) RepoURL(repo string) string {
+	if u, ok := m.Repos[repo]; ok {
+		return u
+	}
+	return strings.TrimRight(m.URL, "/") + "/" + repo
+}
+
+// Get returns the mirror named name from the [Registry], or a custom mirror
+// if name is an http(s) URL.
+func Get(name string) (*Mirror, error) {
+	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		if _, err := url.Parse(name); err != nil {
+			return nil, err
+		}
+		return &Mirror{Name: "custom", URL: strings.TrimRight(name, "/")}, nil
+	}
+	for _, m := range Registry {
+		if m.Name == name {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown mirror %q", name)
+}
+
+// ForCloud returns the internal mirror of the cloud provider, or nil.
+func ForCloud(cloud string) *Mirror {
+	for _, m := range Registry {
+		if cloud != "" && m.Cloud == cloud {
+			return m
+		}
+	}
+	return nil
+}
+
+// Available returns the mirrors of the [Registry] reachable from a host in
+// cloud: the public mirrors and the internal mirror of that cloud provider.
+// cloud is empty for hosts outside any cloud.
+func Available(cloud string) []*Mirror {
+	var mirrors []*Mirror
+	for _, m := range Registry {
+		if m.Cloud == "" || m.Cloud == cloud {
+			mirrors = append(mirrors, m)
+		}
+	}
+	return mirrors
+}
+
+// Result is the outcome of probing a mirror.
+type Result struct {
+	Mirror *Mirror
+	URL    string
+	// Latency is the time to the first response byte.
+	Latency time.Duration
+	// Throughput is in bytes per second.
+	Throughput float64
+	Bytes      int64
+	Err        error
+}
+
+// Prober measures mirror latency and throughput by downloading a file.
+type Prober struct {
+	Client *http.Client
+	// MaxBytes limits the amount of data read from each mirror.
+	MaxBytes int64
+}
+
+// NewProber returns a prober reading up to 4MB with a 15s timeout.
+func NewProber() *Prober {
+	return &Prober{
+		Client:   &http.Client{Timeout: 15 * time.Second},
+		MaxBytes: 4 << 20,
+	}
+}
+
+// Probe downloads repo/path from m.
+func (p *Prober) Probe(m *Mirror, repo, path string) Result {
+	r := Result{Mirror: m, URL: m.RepoURL(repo) + "/" + strings.TrimLeft(path, "/")}
+	start := time.Now()
+	resp, err := p.Client.Get(r.URL)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	defer resp.Body.Close()
+	r.Latency = time.Since(start)
+	if resp.StatusCode/100 != 2 {
+		r.Err = fmt.Errorf("unexpected HTTP response status: %s", resp.Status)
+		return r
+	}
+	body := time.Now()
+	r.Bytes, err = io.Copy(io.Discard, io.LimitReader(resp.Body, p.MaxBytes))
+	elapsed := time.Since(body)
+	if err != nil && r.Bytes == 0 {
+		r.Err = err
+		return r
+	}
+	if elapsed > 0 {
+		r.Throughput = float64(r.Bytes) / elapsed.Seconds()
+	}
+	return r
+}
+
+// ProbeAll probes every mirror concurrently, returning the results sorted
+// fastest first; failed mirrors come last.
+func (p *Prober) ProbeAll(mirrors []*Mirror, repo, path string) []Result {
+	results := make([]Result, len(mirrors))
+	done := make(chan struct{})
+	for i, m := range mirrors {
+		go func(i int, m *Mirror) {
+			results[i] = p.Probe(m, repo, path)
+			done <- struct{}{}
+		}(i, m)
+	}
+	for range mirrors {
+		<-done
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if (a.Err == nil) != (b.Err == nil) {
+			return a.Err == nil
+		}
+		if a.Throughput != b.Throughput {
+			return a.Throughput > b.Throughput
+		}
+		return a.Latency < b.Latency
+	})
+	return results
+}
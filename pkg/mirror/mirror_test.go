@@ -0,0 +1,25 @@
+package mirror
+
+import "testing"
+
+func TestAvailable(t *testing.T) {
+	for _, cloud := range []string{"", "aliyun", "azure"} {
+		for _, m := range Available(cloud) {
+			if m.Cloud != "" && m.Cloud != cloud {
+				t.Errorf("Available(%q) includes %s of %s", cloud, m.Name, m.Cloud)
+			}
+		}
+	}
+	var internal []string
+	for _, m := range Available("aliyun") {
+		if m.Cloud != "" {
+			internal = append(internal, m.Name)
+		}
+	}
+	if len(internal) != 1 || internal[0] != "aliyun-internal" {
+		t.Errorf("internal mirrors on aliyun = %q, want aliyun-internal", internal)
+	}
+	if n := len(Available("")); n != len(Registry)-3 {
+		t.Errorf("Available(\"\") has %d mirrors, want the %d public ones", n, len(Registry)-3)
+	}
+}
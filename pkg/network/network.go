@@ -0,0 +1,280 @@
+package network
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ProcRoute The path of the IPv4 kernel routing table
+	ProcRoute = "/proc/net/route"
+	// ProcIPv6Route The path of the IPv6 kernel routing table
+	ProcIPv6Route = "/proc/net/ipv6_route"
+	// SysClassNet The sysfs directory holding one entry per network interface
+	SysClassNet = "/sys/class/net"
+
+	// DefaultMTU is used when no interface MTU can be detected.
+	DefaultMTU = 1500
+
+	// route flags, see linux/route.h
+	rtfUp     = 0x0001
+	rtfReject = 0x0200
+)
+
+// Overhead is the number of bytes an encapsulation adds to every packet.
+var Overhead = map[string]int{
+	"none":      0,
+	"vxlan":     50,
+	"geneve":    50,
+	"gre":       24,
+	"ipip":      20,
+	"sit":       20,
+	"wireguard": 80,
+	"ipsec":     73,
+}
+
+// Route is a default route found in the kernel routing table.
+type Route struct {
+	Iface   string
+	Gateway string
+	Metric  int
+	IPv6    bool
+}
+
+// Interface exposes the most common parameters of a network interface.
+type Interface struct {
+	Name      string
+	Index     int
+	Kind      string
+	MTU       int
+	Speed     int // Mb/s, -1 if unknown
+	OperState string
+	Up        bool
+	MAC       string
+	Addrs     []string
+}
+
+// DefaultRoutes returns the IPv4 and IPv6 default routes, lowest metric first,
+// IPv4 before IPv6 for equal metrics.
+func DefaultRoutes() ([]Route, error) {
+	v4, err := parseRoute(ProcRoute)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	v6, err := parseIPv6Route(ProcIPv6Route)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	routes := append(v4, v6...)
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Metric == routes[j].Metric {
+			return !routes[i].IPv6 && routes[j].IPv6
+		}
+		return routes[i].Metric < routes[j].Metric
+	})
+	return routes, nil
+}
+
+// DefaultInterface returns the interface carrying the preferred default route.
+func DefaultInterface() (*Interface, error) {
+	routes, err := DefaultRoutes()
+	if err != nil {
+		return nil, err
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("no default route found in %s or %s", ProcRoute, ProcIPv6Route)
+	}
+	return GetInterface(routes[0].Iface)
+}
+
+// parseRoute parses /proc/net/route, e.g.
+//
+//	Iface  Destination  Gateway   Flags  RefCnt  Use  Metric  Mask
+//	eth0   00000000     010200C0  0003   0       0    0       00000000
+func parseRoute(path string) ([]Route, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var routes []Route
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // skip header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil || flags&rtfUp == 0 || flags&rtfReject != 0 {
+			continue
+		}
+		metric, _ := strconv.Atoi(fields[6])
+		routes = append(routes, Route{
+			Iface:   fields[0],
+			Gateway: hexToIPv4(fields[2]),
+			Metric:  metric,
+		})
+	}
+	return routes, scanner.Err()
+}
+
+// parseIPv6Route parses /proc/net/ipv6_route, e.g.
+//
+//	00000000000000000000000000000000 00 <src> 00 <next hop> 00000400 00000001 00000000 00000003 eth0
+func parseIPv6Route(path string) ([]Route, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var routes []Route
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[9] == "lo" {
+			continue
+		}
+		if strings.Trim(fields[0], "0") != "" || fields[1] != "00" {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[8], 16, 32)
+		if err != nil || flags&rtfUp == 0 || flags&rtfReject != 0 {
+			continue
+		}
+		metric, _ := strconv.ParseInt(fields[5], 16, 64)
+		routes = append(routes, Route{
+			Iface:   fields[9],
+			Gateway: hexToIPv6(fields[4]),
+			Metric:  int(metric),
+			IPv6:    true,
+		})
+	}
+	return routes, scanner.Err()
+}
+
+// hexToIPv4 converts the little-endian hex address used by /proc/net/route.
+func hexToIPv4(s string) string {
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return ""
+	}
+	return net.IPv4(byte(v), byte(v>>8), byte(v>>16), byte(v>>24)).String()
+}
+
+func hexToIPv6(s string) string {
+	if len(s) != 32 {
+		return ""
+	}
+	ip := make(net.IP, net.IPv6len)
+	for i := 0; i < net.IPv6len; i++ {
+		b, err := strconv.ParseUint(s[i*2:i*2+2], 16, 8)
+		if err != nil {
+			return ""
+		}
+		ip[i] = byte(b)
+	}
+	return ip.String()
+}
+
+// Interfaces returns all network interfaces of the host.
+func Interfaces() ([]Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Interface, 0, len(ifaces))
+	for _, i := range ifaces {
+		list = append(list, newInterface(i))
+	}
+	return list, nil
+}
+
+// GetInterface returns the network interface named name.
+func GetInterface(name string) (*Interface, error) {
+	i, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	iface := newInterface(*i)
+	return &iface, nil
+}
+
+func newInterface(i net.Interface) Interface {
+	iface := Interface{
+		Name:      i.Name,
+		Index:     i.Index,
+		Kind:      kind(i.Name),
+		MTU:       i.MTU,
+		Speed:     -1,
+		OperState: readSys(i.Name, "operstate"),
+		Up:        i.Flags&net.FlagUp != 0,
+		MAC:       i.HardwareAddr.String(),
+	}
+	if s, err := strconv.Atoi(readSys(i.Name, "speed")); err == nil && s > 0 {
+		iface.Speed = s
+	}
+	if addrs, err := i.Addrs(); err == nil {
+		for _, a := range addrs {
+			iface.Addrs = append(iface.Addrs, a.String())
+		}
+	}
+	return iface
+}
+
+// Overhead returns the encapsulation overhead of the interface itself, e.g.
+// when the default route already goes through a VXLAN or WireGuard device.
+func (i *Interface) Overhead() int {
+	return Overhead[i.Kind]
+}
+
+// IsTunnel will return true for interfaces that encapsulate traffic.
+func (i *Interface) IsTunnel() bool {
+	return i.Overhead() > 0 || i.Kind == "tun"
+}
+
+func readSys(name, attr string) string {
+	b, err := os.ReadFile(filepath.Join(SysClassNet, name, attr))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// kind detects the interface type from sysfs: DEVTYPE in uevent covers vlan,
+// vxlan, bond, bridge, wireguard, geneve; the rest is derived from the ARP
+// hardware type or well-known sysfs entries.
+func kind(name string) string {
+	for _, line := range strings.Split(readSys(name, "uevent"), "\n") {
+		if v, ok := strings.CutPrefix(line, "DEVTYPE="); ok {
+			return v
+		}
+	}
+	if _, err := os.Stat(filepath.Join(SysClassNet, name, "tun_flags")); err == nil {
+		return "tun"
+	}
+	switch readSys(name, "type") {
+	case "772":
+		return "loopback"
+	case "768":
+		return "ipip"
+	case "776":
+		return "sit"
+	case "778":
+		return "gre"
+	case "65534":
+		return "raw"
+	}
+	if _, err := os.Stat(filepath.Join(SysClassNet, name, "device")); err == nil {
+		return "ether"
+	}
+	return "virtual"
+}
@@ -0,0 +1,91 @@
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTable(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "route")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseRoute(t *testing.T) {
+	const header = "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n"
+	tests := []struct {
+		name  string
+		table string
+		want  []Route
+	}{
+		{
+			name: "default route",
+			table: header +
+				"eth0\t00000000\t0102000A\t0003\t0\t0\t100\t00000000\t0\t0\t0\n" +
+				"eth0\t0000000A\t00000000\t0001\t0\t0\t100\t00FFFFFF\t0\t0\t0\n",
+			want: []Route{{Iface: "eth0", Gateway: "10.0.2.1", Metric: 100}},
+		},
+		{
+			name: "multiple default routes",
+			table: header +
+				"wlan0\t00000000\t0101A8C0\t0003\t0\t0\t600\t00000000\t0\t0\t0\n" +
+				"eth0\t00000000\t0100A8C0\t0003\t0\t0\t100\t00000000\t0\t0\t0\n",
+			want: []Route{
+				{Iface: "wlan0", Gateway: "192.168.1.1", Metric: 600},
+				{Iface: "eth0", Gateway: "192.168.0.1", Metric: 100},
+			},
+		},
+		{
+			name:  "point to point without gateway",
+			table: header + "wg0\t00000000\t00000000\t0001\t0\t0\t0\t00000000\t0\t0\t0\n",
+			want:  []Route{{Iface: "wg0", Gateway: "0.0.0.0"}},
+		},
+		{
+			name: "down, reject and host routes are skipped",
+			table: header +
+				"eth1\t00000000\t0102000A\t0002\t0\t0\t0\t00000000\t0\t0\t0\n" +
+				"lo\t00000000\t00000000\t0201\t0\t0\t0\t00000000\t0\t0\t0\n" +
+				"eth0\t00000000\t0102000A\t0003\t0\t0\t0\tFFFFFFFF\t0\t0\t0\n" +
+				"eth0\t00000000\t0102000A\tzz\t0\t0\t0\t00000000\t0\t0\t0\n" +
+				"truncated\t00000000\n",
+		},
+		{name: "header only", table: header},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRoute(writeTable(t, tt.table))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRoute() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIPv6Route(t *testing.T) {
+	table := "00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00000003 eth0\n" +
+		"00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200 lo\n" +
+		"20010db8000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001 eth0\n" +
+		"00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 00000200 00000001 00000000 00000201 eth1\n"
+	got, err := parseIPv6Route(writeTable(t, table))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Route{{Iface: "eth0", Gateway: "fe80::1", Metric: 0x400, IPv6: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseIPv6Route() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseRouteMissing(t *testing.T) {
+	if _, err := parseRoute(filepath.Join(t.TempDir(), "route")); !os.IsNotExist(err) {
+		t.Errorf("parseRoute() of a missing file error = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,94 @@
+package os
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+)
+
+// Cloud providers, using the cloud-init cloud_name values.
+const (
+	CloudAliyun    = "aliyun"
+	CloudTencent   = "tencent"
+	CloudHuawei    = "huaweicloud"
+	CloudAWS       = "aws"
+	CloudAzure     = "azure"
+	CloudGCE       = "gce"
+	CloudOpenStack = "openstack"
+)
+
+// azureAssetTag is the DMI chassis asset tag of every Azure virtual machine.
+const azureAssetTag = "7783-7084-3265-9085-8269-3286-77"
+
+// cloudVendors maps DMI strings to cloud providers.
+var cloudVendors = []struct {
+	match string
+	cloud string
+}{
+	{"Alibaba Cloud", CloudAliyun},
+	{"Tencent Cloud", CloudTencent},
+	{"HUAWEICLOUD", CloudHuawei},
+	{"Huawei Cloud", CloudHuawei},
+	{"Amazon EC2", CloudAWS},
+	{"amazon", CloudAWS},
+	{"Google Compute Engine", CloudGCE},
+	{"Google", CloudGCE},
+	{"OpenStack", CloudOpenStack},
+}
+
+// cloudInitNames maps cloud-init cloud names to the names used here.
+var cloudInitNames = map[string]string{
+	"aliyun":      CloudAliyun,
+	"tencent":     CloudTencent,
+	"huaweicloud": CloudHuawei,
+	"aws":         CloudAWS,
+	"ec2":         CloudAWS,
+	"azure":       CloudAzure,
+	"gce":         CloudGCE,
+	"openstack":   CloudOpenStack,
+}
+
+// detectCloud returns the cloud provider from DMI, falling back to the
+// cloud-init instance data; "" when none is found.
+func detectCloud(read func(string) string) string {
+	dmi := func(f string) string {
+		return strings.TrimSpace(read(filepath.Join("/sys/class/dmi/id", f)))
+	}
+	if dmi("chassis_asset_tag") == azureAssetTag {
+		return CloudAzure
+	}
+	for _, f := range []string{"sys_vendor", "product_name", "bios_vendor", "product_version", "chassis_asset_tag"} {
+		value := dmi(f)
+		for _, v := range cloudVendors {
+			if value != "" && strings.Contains(value, v.match) {
+				return v.cloud
+			}
+		}
+	}
+	return cloudInitCloud(read)
+}
+
+// cloudInitCloud reads the cloud detected by cloud-init.
+func cloudInitCloud(read func(string) string) string {
+	var data struct {
+		V1 struct {
+			CloudName string `json:"cloud_name"`
+		} `json:"v1"`
+	}
+	name := ""
+	if content := read("/run/cloud-init/instance-data.json"); content != "" {
+		if json.Unmarshal([]byte(content), &data) == nil {
+			name = data.V1.CloudName
+		}
+	}
+	if name == "" {
+		// cloud-id-<name> symlinks to the cloud-id file holding the name
+		name = strings.TrimSpace(read("/run/cloud-init/cloud-id"))
+	}
+	return cloudInitNames[strings.ToLower(name)]
+}
+
+// IsCloud reports whether the system is a cloud instance.
+func (d *Data) IsCloud() bool {
+	return d.Cloud != ""
+}
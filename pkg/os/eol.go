@@ -0,0 +1,46 @@
+package os
+
+import (
+	"strconv"
+	"strings"
+)
+
+// EOL describes an end-of-life release whose packages were moved from the
+// live tree to an archive.
+type EOL struct {
+	// Date is the upstream end of life date.
+	Date string
+	// VaultVersion is the release directory on vault.centos.org.
+	VaultVersion string
+	// EPELVersion is the release directory on the EPEL archive, empty while
+	// EPEL for the major version is still live.
+	EPELVersion string
+}
+
+var centosEOL = map[string]EOL{
+	"6":        {Date: "2020-11-30", VaultVersion: "6.10", EPELVersion: "6"},
+	"7":        {Date: "2024-06-30", VaultVersion: "7.9.2009", EPELVersion: "7"},
+	"8":        {Date: "2021-12-31", VaultVersion: "8.5.2111"},
+	"8-stream": {Date: "2024-05-31", VaultVersion: "8-stream"},
+}
+
+// IsCentOSStream will return true for CentOS Stream.
+func (d *Data) IsCentOSStream() bool {
+	return d.IsCentOS() && strings.Contains(d.Name+d.PrettyName, "Stream")
+}
+
+// EOL returns the end of life information of the release, or nil if it is
+// still supported upstream.
+func (d *Data) EOL() *EOL {
+	if !d.IsCentOS() {
+		return nil
+	}
+	major := strconv.Itoa(d.Release.Major)
+	if d.IsCentOSStream() {
+		major += "-stream"
+	}
+	if eol, ok := centosEOL[major]; ok {
+		return &eol
+	}
+	return nil
+}
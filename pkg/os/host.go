@@ -0,0 +1,105 @@
+package os
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// machineArch returns the uname -m style name of the running architecture.
+func machineArch() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "i686"
+	case "arm64":
+		return "aarch64"
+	case "arm":
+		return "armv7l"
+	}
+	return runtime.GOARCH
+}
+
+// hypervisorVendors maps DMI vendor and product strings to the
+// virtualization names used by systemd-detect-virt.
+var hypervisorVendors = []struct {
+	match string
+	virt  string
+}{
+	{"KVM", "kvm"},
+	{"QEMU", "qemu"},
+	{"VMware", "vmware"},
+	{"VirtualBox", "oracle"},
+	{"innotek", "oracle"},
+	{"Xen", "xen"},
+	{"Microsoft Corporation", "microsoft"},
+	{"Bochs", "bochs"},
+	{"Parallels", "parallels"},
+	{"OpenStack", "kvm"},
+	{"Alibaba Cloud ECS", "kvm"},
+	{"Tencent Cloud", "kvm"},
+	{"HUAWEICLOUD", "kvm"},
+	{"Amazon EC2", "amazon"},
+	{"Google Compute Engine", "google"},
+}
+
+// detectVirtualization returns the hypervisor type, "none" on bare metal.
+func detectVirtualization(read func(string) string) string {
+	if t := strings.TrimSpace(read("/sys/hypervisor/type")); t == "xen" {
+		return "xen"
+	}
+	for _, f := range []string{"sys_vendor", "product_name", "board_vendor", "bios_vendor"} {
+		value := read(filepath.Join("/sys/class/dmi/id", f))
+		for _, v := range hypervisorVendors {
+			if strings.Contains(value, v.match) {
+				return v.virt
+			}
+		}
+	}
+	// the hypervisor CPU flag is set on any virtual machine
+	for _, line := range strings.Split(read("/proc/cpuinfo"), "\n") {
+		if strings.HasPrefix(line, "flags") && strings.Contains(line, " hypervisor") {
+			return "vm-other"
+		}
+	}
+	return "none"
+}
+
+// detectContainer returns the container runtime the process runs in, or ""
+// if it is not in a container.
+func detectContainer(root string, read func(string) string) string {
+	if _, err := os.Stat(filepath.Join(root, "/.dockerenv")); err == nil {
+		return "docker"
+	}
+	if _, err := os.Stat(filepath.Join(root, "/run/.containerenv")); err == nil {
+		return "podman"
+	}
+	// systemd-nspawn, lxc and others set $container for pid 1
+	if c := strings.TrimSpace(read("/run/systemd/container")); c != "" {
+		return c
+	}
+	for _, env := range strings.Split(read("/proc/1/environ"), "\x00") {
+		if c, ok := strings.CutPrefix(env, "container="); ok && c != "" {
+			return c
+		}
+	}
+	cgroup := read("/proc/1/cgroup")
+	for _, c := range []string{"kubepods", "docker", "containerd", "lxc"} {
+		if strings.Contains(cgroup, c) {
+			return c
+		}
+	}
+	return ""
+}
+
+// InContainer reports whether the system is a container.
+func (d *Data) InContainer() bool {
+	return d.Container != ""
+}
+
+// IsVirtual reports whether the system runs on a hypervisor.
+func (d *Data) IsVirtual() bool {
+	return d.Virtualization != "" && d.Virtualization != "none"
+}
@@ -4,17 +4,20 @@ import (
 	"bufio"
 	"bytes"
 	"github.com/pkg/errors"
-	"log"
 	"os"
-	"stkey/pkg/script"
+	"path/filepath"
 	"stkey/utils"
 	"strings"
 )
 
 const (
-	// EtcOsRelease The path of os-release file;Centos 6.x is /etc/issue
-	EtcOsRelease   = "/etc/os-release"
-	IssueOsRelease = "/etc/issue"
+	// Release files, in order of precedence. Centos 6.x has no os-release.
+	EtcOsRelease    = "/etc/os-release"
+	UsrLibOsRelease = "/usr/lib/os-release"
+	RedhatRelease   = "/etc/redhat-release"
+	LsbRelease      = "/etc/lsb-release"
+	DebianVersion   = "/etc/debian_version"
+	IssueOsRelease  = "/etc/issue"
 	// DebianID [OSName]ID is the identifier used by the OS operating system.
 	DebianID = "debian"
 	FedoraID = "fedora"
@@ -23,15 +26,8 @@ const (
 	CentosID = "centos"
 )
 
-// GetReleaseFile Check os release file
-func GetReleaseFile(etcFile, issueFile string) (s string, err error) {
-	s, err = script.File(etcFile).String()
-	if err != nil {
-		s, err = script.File(issueFile).String()
-		return s, err
-	}
-	return s, err
-}
+// ErrUnknownOS is returned when no release file could be identified.
+var ErrUnknownOS = errors.New("unable to identify the operating system")
 
 // Data exposes the most common identification parameters.
 type Data struct {
@@ -41,61 +37,167 @@ type Data struct {
 	PrettyName string
 	Version    string
 	VersionID  string
+	Codename   string
 	HostName   string
-	FileMap    map[string]string
+	// Release is the parsed VersionID.
+	Release Version
+	// Source is the release file the identification was read from.
+	Source string
+	// Kernel is the kernel release, e.g. 5.15.0-91-generic.
+	Kernel string
+	// KernelVersion is the parsed Kernel release.
+	KernelVersion Version
+	// Arch is the machine hardware name, e.g. x86_64 or aarch64.
+	Arch string
+	// Virtualization is the hypervisor type, "none" on bare metal.
+	Virtualization string
+	// Cloud is the cloud provider, "" when not on a known cloud.
+	Cloud string
+	// Container is the container runtime, "" outside of a container.
+	Container string
+	FileMap   map[string]string
 }
 
-// Parse is to parse a os release file content.
-func Parse(EtcOsRelease, IssueOsRelease string) (data *Data) {
-	content, err := GetReleaseFile(EtcOsRelease, IssueOsRelease)
-	if err != nil {
-		log.Fatal(err)
+// Parse identifies the running system from the release files under /.
+func Parse() (*Data, error) {
+	return ParseRoot("/")
+}
+
+// ParseRoot identifies the system whose root filesystem is at root, reading
+// os-release, redhat-release, lsb-release, debian_version and issue in that
+// order of precedence. Later files only fill in what earlier ones lack.
+func ParseRoot(root string) (*Data, error) {
+	data := new(Data)
+	read := func(name string) string {
+		b, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			return ""
+		}
+		return string(b)
 	}
-	lineNumber, err := script.Echo(content).CountLines()
-	if err != nil {
-		return
+
+	if content := read(EtcOsRelease); content != "" {
+		data.fromOsRelease(content, EtcOsRelease)
+	} else if content := read(UsrLibOsRelease); content != "" {
+		data.fromOsRelease(content, UsrLibOsRelease)
 	}
-	//lineNumber =strconv.Itoa(lineNmuber)
-	data = new(Data)
-	switch lineNumber {
-	case 2, 3:
-		{
-			content, err := script.Echo(content).First(1).String()
-			if err != nil {
-				return
-			}
-			content = strings.Replace(content, "\n", "", -1)
-
-			idContent, _ := script.Echo(content).Column(1).String()
-			data.ID, _ = script.Echo(idContent).Exec("tr A-Z a-z").String()
-			versionId, _ := script.Echo(content).Column(3).String()
-			data.VersionID, _ = script.Echo(versionId).First(1).String()
-			data.HostName, _ = os.Hostname()
+	if content := read(RedhatRelease); content != "" {
+		data.fromIssue(content, RedhatRelease)
+		if data.IDLike == "" && data.ID != FedoraID {
+			data.IDLike = RhelID + " " + FedoraID
 		}
-	default:
-		{
-			lines, err := parseString(content)
-			if err != nil {
-				return
-			}
-			info := make(map[string]string)
-			for _, v := range lines {
-				key, value, err := parseLine(v)
-				if err == nil {
-					info[key] = value
-				}
-			}
-			data.ID = info["ID"]
-			data.IDLike = info["ID_LIKE"]
-			data.Name = info["NAME"]
-			data.PrettyName = info["PRETTY_NAME"]
-			data.Version = info["VERSION"]
-			data.VersionID = info["VERSION_ID"]
-			data.HostName, _ = os.Hostname()
+	}
+	if content := read(LsbRelease); content != "" {
+		data.fromLsbRelease(content)
+	}
+	if content := strings.TrimSpace(read(DebianVersion)); content != "" {
+		data.fill(&data.ID, DebianID, DebianVersion)
+		// testing/unstable contain a codename like bookworm/sid
+		if content[0] >= '0' && content[0] <= '9' {
+			data.fill(&data.VersionID, content, DebianVersion)
 		}
 	}
+	if content := read(IssueOsRelease); content != "" {
+		data.fromIssue(content, IssueOsRelease)
+	}
+	if data.ID == "" {
+		return nil, ErrUnknownOS
+	}
+	if data.Name == "" {
+		data.Name = data.ID
+	}
+	if data.PrettyName == "" {
+		data.PrettyName = strings.TrimSpace(data.Name + " " + data.VersionID)
+	}
+
+	data.Release = ParseVersion(data.VersionID)
+	data.HostName, _ = os.Hostname()
+	data.Kernel = strings.TrimSpace(read("/proc/sys/kernel/osrelease"))
+	data.KernelVersion = ParseVersion(data.Kernel)
+	data.Arch = machineArch()
+	data.Virtualization = detectVirtualization(read)
+	data.Cloud = detectCloud(read)
+	data.Container = detectContainer(root, read)
 	data.FileMap = data.GetKernelFile()
-	return
+	return data, nil
+}
+
+// fill sets *field to value if it is empty, recording src as the source of
+// the identification.
+func (d *Data) fill(field *string, value, src string) {
+	if *field != "" || value == "" {
+		return
+	}
+	*field = value
+	if d.Source == "" {
+		d.Source = src
+	}
+}
+
+func (d *Data) fromOsRelease(content, src string) {
+	info := parseKeyValues(content)
+	d.fill(&d.ID, strings.ToLower(info["ID"]), src)
+	d.fill(&d.IDLike, info["ID_LIKE"], src)
+	d.fill(&d.Name, info["NAME"], src)
+	d.fill(&d.PrettyName, info["PRETTY_NAME"], src)
+	d.fill(&d.Version, info["VERSION"], src)
+	d.fill(&d.VersionID, info["VERSION_ID"], src)
+	d.fill(&d.Codename, info["VERSION_CODENAME"], src)
+	d.fill(&d.Codename, info["UBUNTU_CODENAME"], src)
+}
+
+func (d *Data) fromLsbRelease(content string) {
+	info := parseKeyValues(content)
+	d.fill(&d.ID, strings.ToLower(info["DISTRIB_ID"]), LsbRelease)
+	d.fill(&d.VersionID, info["DISTRIB_RELEASE"], LsbRelease)
+	d.fill(&d.Codename, info["DISTRIB_CODENAME"], LsbRelease)
+	d.fill(&d.PrettyName, info["DISTRIB_DESCRIPTION"], LsbRelease)
+}
+
+// fromIssue parses a one line description such as
+// "CentOS release 6.10 (Final)" or "Red Hat Enterprise Linux Server release 6.9 (Santiago)".
+func (d *Data) fromIssue(content, src string) {
+	var fields []string
+	for _, f := range strings.Fields(strings.SplitN(content, "\n", 2)[0]) {
+		// skip the getty escapes of /etc/issue such as \n and \l
+		if !strings.HasPrefix(f, "\\") {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		return
+	}
+	line := strings.Join(fields, " ")
+	id := strings.ToLower(fields[0])
+	if strings.HasPrefix(line, "Red Hat") {
+		id = RhelID
+	}
+	var version string
+	for _, f := range fields[1:] {
+		if f[0] >= '0' && f[0] <= '9' {
+			version = f
+			break
+		}
+	}
+	if version == "" {
+		return
+	}
+	d.fill(&d.ID, id, src)
+	d.fill(&d.VersionID, version, src)
+	d.fill(&d.PrettyName, line, src)
+}
+
+// parseKeyValues parses the KEY=value lines of os-release and lsb-release.
+func parseKeyValues(content string) map[string]string {
+	info := make(map[string]string)
+	lines, _ := parseString(content)
+	for _, v := range lines {
+		key, value, err := parseLine(v)
+		if err == nil {
+			info[key] = value
+		}
+	}
+	return info
 }
 
 func parseString(content string) (lines []string, err error) {
@@ -182,30 +284,30 @@ func (d *Data) IsCentOS() bool {
 }
 
 func (d *Data) IsCentOS6() bool {
-	return d.IsCentOS() && utils.ContainsI(d.VersionID, "6.")
+	return d.IsCentOS() && d.Release.Major == 6
 }
 
 func (d *Data) IsCentOS7() bool {
-	return d.IsCentOS() && d.VersionID == "7"
+	return d.IsCentOS() && d.Release.Major == 7
 }
 
 func (d *Data) IsCentOS8() bool {
-	return d.IsCentOS() && d.VersionID == "8"
+	return d.IsCentOS() && d.Release.Major == 8
 }
 
 func (d *Data) IsUbuntu18() bool {
-	return d.IsUbuntu() && utils.ContainsI(d.VersionID, "18.")
+	return d.IsUbuntu() && d.Release.Major == 18
 }
 
 func (d *Data) IsUbuntu16() bool {
-	return d.IsUbuntu() && utils.ContainsI(d.VersionID, "16.")
+	return d.IsUbuntu() && d.Release.Major == 16
 }
 func (d *Data) IsUbuntu20() bool {
-	return d.IsUbuntu() && utils.ContainsI(d.VersionID, "20.")
+	return d.IsUbuntu() && d.Release.Major == 20
 }
 
 func (d *Data) IsUbuntu22() bool {
-	return d.IsUbuntu() && utils.ContainsI(d.VersionID, "22.")
+	return d.IsUbuntu() && d.Release.Major == 22
 }
 
 func (d *Data) GetKernelFile() map[string]string {
@@ -0,0 +1,194 @@
+package os
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a dotted numeric version such as a VERSION_ID or a kernel
+// release. Parts that are not numbers end the version: 5.15.0-91-generic
+// parses as 5.15.0.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	// Parts holds every numeric part, including those after Patch such as
+	// the 2009 of CentOS 7.9.2009.
+	Parts []int
+	Raw   string
+}
+
+// ParseVersion parses the leading dotted numbers of s. An empty s, or one
+// starting with anything but a digit, has no parts.
+func ParseVersion(s string) Version {
+	v := Version{Raw: s}
+	for _, p := range strings.Split(strings.TrimSpace(s), ".") {
+		end := strings.IndexFunc(p, func(r rune) bool { return r < '0' || r > '9' })
+		if end == 0 || p == "" {
+			break
+		}
+		if end > 0 {
+			p = p[:end]
+		}
+		n, _ := strconv.Atoi(p)
+		v.Parts = append(v.Parts, n)
+		if end > 0 {
+			break
+		}
+	}
+	if len(v.Parts) > 0 {
+		v.Major = v.Parts[0]
+	}
+	if len(v.Parts) > 1 {
+		v.Minor = v.Parts[1]
+	}
+	if len(v.Parts) > 2 {
+		v.Patch = v.Parts[2]
+	}
+	return v
+}
+
+func (v Version) String() string {
+	return v.Raw
+}
+
+// IsZero reports whether no version could be parsed.
+func (v Version) IsZero() bool {
+	return len(v.Parts) == 0
+}
+
+// Compare returns -1, 0 or 1 as v is lower than, equal to or greater than o.
+// Missing parts count as 0, so 7 equals 7.0.
+func (v Version) Compare(o Version) int {
+	for i := 0; i < len(v.Parts) || i < len(o.Parts); i++ {
+		var x, y int
+		if i < len(v.Parts) {
+			x = v.Parts[i]
+		}
+		if i < len(o.Parts) {
+			y = o.Parts[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// AtLeast reports whether v is at least the version given by parts, e.g.
+// AtLeast(3, 18).
+func (v Version) AtLeast(parts ...int) bool {
+	return v.Compare(Version{Parts: parts}) >= 0
+}
+
+// hasPrefix reports whether the parts of o are a prefix of v, so 20.04.6
+// equals 20.04 and 7.9.2009 equals 7.
+func (v Version) hasPrefix(o Version) bool {
+	if len(o.Parts) > len(v.Parts) {
+		return v.Compare(o) == 0
+	}
+	for i, p := range o.Parts {
+		if v.Parts[i] != p {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchVersion checks version against comma separated constraints such as
+// ">=20.04,<24.04". A constraint without operator or with = matches the
+// versions starting with it, "7" matches 7.9.2009, and the other operators
+// agree with it: 7.9.2009 is <=7 but neither >7 nor <7. An empty constraint
+// is an error, and a version that cannot be parsed matches nothing.
+func MatchVersion(version, constraints string) (bool, error) {
+	v := ParseVersion(version)
+	match := !v.IsZero()
+	for _, c := range strings.Split(constraints, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			return false, fmt.Errorf("empty constraint in %q", constraints)
+		}
+		raw := strings.TrimSpace(strings.TrimLeft(c, "<>=!"))
+		op := strings.TrimSpace(c[:len(c)-len(strings.TrimLeft(c, "<>=!"))])
+		want := ParseVersion(raw)
+		if want.IsZero() {
+			return false, fmt.Errorf("invalid version %q in constraint %q", raw, c)
+		}
+		cmp, prefix := v.Compare(want), v.hasPrefix(want)
+		var ok bool
+		switch op {
+		case ">=":
+			ok = cmp >= 0 || prefix
+		case ">":
+			ok = cmp > 0 && !prefix
+		case "<=":
+			ok = cmp <= 0 || prefix
+		case "<":
+			ok = cmp < 0 && !prefix
+		case "!=":
+			ok = !prefix
+		case "=", "==", "":
+			ok = prefix
+		default:
+			return false, fmt.Errorf("invalid operator %q in constraint %q", op, c)
+		}
+		// keep checking the remaining constraints for errors
+		match = match && ok
+	}
+	return match, nil
+}
+
+// Match checks the system against a constraint made of a distro and
+// optional version constraints, e.g. "ubuntu>=20.04,<24.04", "centos7",
+// "rhel-family>=8" or "kernel>=3.18". A "-family" suffix matches the ID and
+// every distro listing it in ID_LIKE; "kernel" checks the kernel release.
+func (d *Data) Match(constraint string) (bool, error) {
+	constraint = strings.TrimSpace(constraint)
+	i := strings.IndexAny(constraint, "<>=!")
+	if i < 0 {
+		i = len(constraint)
+	}
+	name, versions := strings.ToLower(strings.TrimSpace(constraint[:i])), constraint[i:]
+	// "centos7" is short for "centos=7"
+	if j := strings.IndexAny(name, "0123456789"); j > 0 && versions == "" {
+		name, versions = name[:j], name[j:]
+	}
+	version := d.VersionID
+	switch {
+	case name == "kernel":
+		version = d.Kernel
+	case strings.HasSuffix(name, "-family"):
+		if !d.IsFamily(strings.TrimSuffix(name, "-family")) {
+			return false, nil
+		}
+	case name != d.ID:
+		return false, nil
+	}
+	if versions == "" {
+		return true, nil
+	}
+	return MatchVersion(version, versions)
+}
+
+// IsFamily reports whether the system is id or lists it in ID_LIKE.
+func (d *Data) IsFamily(id string) bool {
+	if d.ID == id {
+		return true
+	}
+	for _, like := range strings.Fields(d.IDLike) {
+		if like == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Satisfies is like Match but treats an invalid constraint as no match.
+func (d *Data) Satisfies(constraint string) bool {
+	ok, err := d.Match(constraint)
+	return err == nil && ok
+}
@@ -0,0 +1,96 @@
+package os
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in    string
+		parts []int
+	}{
+		{in: "7.9.2009", parts: []int{7, 9, 2009}},
+		{in: "22.04", parts: []int{22, 4}},
+		{in: "5.15.0-91-generic", parts: []int{5, 15, 0}},
+		{in: "3.10.0-1160.el7.x86_64", parts: []int{3, 10, 0}},
+		{in: " 8 ", parts: []int{8}},
+		{in: "7.", parts: []int{7}},
+		{in: ""},
+		{in: "."},
+		{in: "rolling"},
+	}
+	for _, tt := range tests {
+		v := ParseVersion(tt.in)
+		if !reflect.DeepEqual(v.Parts, tt.parts) {
+			t.Errorf("ParseVersion(%q).Parts = %v, want %v", tt.in, v.Parts, tt.parts)
+		}
+		if v.IsZero() != (len(tt.parts) == 0) {
+			t.Errorf("ParseVersion(%q).IsZero() = %v", tt.in, v.IsZero())
+		}
+	}
+}
+
+func TestMatchVersion(t *testing.T) {
+	tests := []struct {
+		version     string
+		constraints string
+		want        bool
+		wantErr     bool
+	}{
+		{version: "7.9.2009", constraints: "7", want: true},
+		{version: "7.9.2009", constraints: "=7", want: true},
+		{version: "7.9.2009", constraints: "==7.9", want: true},
+		{version: "7.9.2009", constraints: "<=7", want: true},
+		{version: "7.9.2009", constraints: ">=7", want: true},
+		{version: "7.9.2009", constraints: "<7"},
+		{version: "7.9.2009", constraints: ">7"},
+		{version: "7.9.2009", constraints: "!=7"},
+		{version: "7.9.2009", constraints: "<8", want: true},
+		{version: "8.6", constraints: ">7", want: true},
+		{version: "6.10", constraints: "<=7", want: true},
+		{version: "70", constraints: "7"},
+		{version: "7", constraints: "7.0", want: true},
+		{version: "22.04", constraints: ">=20.04, <24.04", want: true},
+		{version: "24.04", constraints: ">=20.04,<24.04"},
+		{version: "", constraints: "<8"},
+		{version: "", constraints: "!=8"},
+		{version: "7", constraints: "", wantErr: true},
+		{version: "7", constraints: ">=7,", wantErr: true},
+		{version: "7", constraints: ">=", wantErr: true},
+		{version: "7", constraints: "~7", wantErr: true},
+		{version: "7", constraints: "=>7", wantErr: true},
+		{version: "6", constraints: ">=7,<>8", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := MatchVersion(tt.version, tt.constraints)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("MatchVersion(%q, %q) = %v, %v, want %v, error %v", tt.version, tt.constraints, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	d := &Data{ID: "rocky", IDLike: "rhel centos fedora", VersionID: "8.9", Kernel: "4.18.0-513.el8.x86_64"}
+	tests := []struct {
+		constraint string
+		want       bool
+		wantErr    bool
+	}{
+		{constraint: "rocky", want: true},
+		{constraint: "rocky8", want: true},
+		{constraint: "rocky>=8,<9", want: true},
+		{constraint: "rhel-family>=8", want: true},
+		{constraint: "rhel>=8"},
+		{constraint: "centos8"},
+		{constraint: "kernel>=3.18", want: true},
+		{constraint: "kernel<4.18"},
+		{constraint: "rocky>=", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := d.Match(tt.constraint)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Match(%q) = %v, %v, want %v, error %v", tt.constraint, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,449 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"stkey/pkg/script"
+	"strings"
+)
+
+const (
+	// AptSourcesList is the main one-line style sources file.
+	AptSourcesList = "/etc/apt/sources.list"
+	// AptSourcesDir holds additional .list and deb822 .sources files.
+	AptSourcesDir = "/etc/apt/sources.list.d"
+	// AptKeyringsDir holds the keys referenced by Signed-By.
+	AptKeyringsDir = "/etc/apt/keyrings"
+)
+
+// AptFormat is the syntax of an apt sources file.
+type AptFormat int
+
+const (
+	// OneLine is the "deb [options] uri suite components" format of .list files.
+	OneLine AptFormat = iota
+	// Deb822 is the stanza format of .sources files.
+	Deb822
+)
+
+// oneLineOptions maps the one-line option names to the deb822 field names.
+var oneLineOptions = map[string]string{
+	"arch":              "Architectures",
+	"lang":              "Languages",
+	"target":            "Targets",
+	"pdiffs":            "PDiffs",
+	"by-hash":           "By-Hash",
+	"allow-insecure":    "Allow-Insecure",
+	"trusted":           "Trusted",
+	"signed-by":         "Signed-By",
+	"check-valid-until": "Check-Valid-Until",
+}
+
+// AptSource is an apt repository, a line of a .list file or a stanza of a
+// .sources file.
+type AptSource struct {
+	Types      []string
+	URIs       []string
+	Suites     []string
+	Components []string
+	// Options holds the other fields by deb822 name, e.g. Signed-By.
+	Options map[string]string
+	Enabled bool
+	// DisabledByOps is set for sources disabled by SetEnabled, only these
+	// are enabled again.
+	DisabledByOps bool
+	// Comments are the comment and blank lines preceding the source.
+	Comments []string
+
+	// line is the original one-line source, written unchanged unless the
+	// source was modified, canonical its rendering when parsed.
+	line, canonical string
+}
+
+// opsDisabled prefixes one-line sources disabled by ops and precedes
+// deb822 stanzas disabled by ops.
+const opsDisabled = "# ops-disabled:"
+
+// Option returns the deb822 field name.
+func (s *AptSource) Option(name string) string {
+	return s.Options[name]
+}
+
+// SetOption sets the deb822 field name, removing it if value is empty.
+func (s *AptSource) SetOption(name, value string) {
+	if s.Options == nil {
+		s.Options = map[string]string{}
+	}
+	if value == "" {
+		delete(s.Options, name)
+		return
+	}
+	s.Options[name] = value
+}
+
+// AptFile is a parsed apt sources file.
+type AptFile struct {
+	Path    string
+	Format  AptFormat
+	Sources []*AptSource
+	// Trailer holds comment lines after the last source.
+	Trailer []string
+}
+
+// FormatOf returns the format of an apt sources file by its extension.
+func FormatOf(path string) AptFormat {
+	if strings.HasSuffix(path, ".sources") {
+		return Deb822
+	}
+	return OneLine
+}
+
+// ParseApt parses data in the given format.
+func ParseApt(data []byte, format AptFormat) (*AptFile, error) {
+	if format == Deb822 {
+		return parseDeb822(data)
+	}
+	return parseOneLine(data)
+}
+
+func parseOneLine(data []byte) (*AptFile, error) {
+	f := &AptFile{Format: OneLine}
+	var comments []string
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		body := strings.TrimSpace(line)
+		disabled := strings.HasPrefix(body, opsDisabled)
+		if disabled {
+			body = strings.TrimSpace(strings.TrimPrefix(body, opsDisabled))
+		} else if body == "" || strings.HasPrefix(body, "#") {
+			// sources commented out by hand are kept as comments
+			comments = append(comments, line)
+			continue
+		}
+		src, err := parseOneLineSource(body)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		src.Enabled = !disabled
+		src.DisabledByOps = disabled
+		src.Comments = comments
+		src.line = body
+		src.canonical = src.oneLineBody()
+		comments = nil
+		f.Sources = append(f.Sources, src)
+	}
+	f.Trailer = comments
+	return f, s.Err()
+}
+
+func parseOneLineSource(line string) (*AptSource, error) {
+	if i := strings.Index(line, " #"); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("invalid source %q", line)
+	}
+	src := &AptSource{Types: []string{fields[0]}, Options: map[string]string{}}
+	if fields[0] != "deb" && fields[0] != "deb-src" {
+		return nil, fmt.Errorf("invalid source type %q", fields[0])
+	}
+	fields = fields[1:]
+	if strings.HasPrefix(fields[0], "[") {
+		var opts []string
+		for len(fields) > 0 {
+			f := fields[0]
+			fields = fields[1:]
+			opts = append(opts, f)
+			if strings.HasSuffix(f, "]") {
+				break
+			}
+		}
+		for _, o := range strings.Fields(strings.Trim(strings.Join(opts, " "), "[]")) {
+			k, v, ok := strings.Cut(o, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid option %q", o)
+			}
+			if name, ok := oneLineOptions[k]; ok {
+				k = name
+			}
+			src.Options[k] = strings.ReplaceAll(v, ",", " ")
+		}
+	}
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid source %q", line)
+	}
+	src.URIs = []string{fields[0]}
+	src.Suites = []string{fields[1]}
+	src.Components = fields[2:]
+	return src, nil
+}
+
+func parseDeb822(data []byte) (*AptFile, error) {
+	f := &AptFile{Format: Deb822}
+	var comments []string
+	var cur *AptSource
+	var last string
+	fields := map[string]string{}
+	flush := func() error {
+		if cur == nil {
+			return nil
+		}
+		if err := cur.fromFields(fields); err != nil {
+			return err
+		}
+		comments := cur.Comments[:0]
+		for _, c := range cur.Comments {
+			if strings.TrimSpace(c) == opsDisabled {
+				cur.DisabledByOps = !cur.Enabled
+				continue
+			}
+			comments = append(comments, c)
+		}
+		cur.Comments = comments
+		f.Sources = append(f.Sources, cur)
+		cur, last, fields = nil, "", map[string]string{}
+		return nil
+	}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			if err := flush(); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+		case strings.HasPrefix(trimmed, "#"):
+			// comments inside a stanza are moved before it
+			if cur == nil {
+				comments = append(comments, line)
+			} else {
+				cur.Comments = append(cur.Comments, line)
+			}
+		case line[0] == ' ' || line[0] == '\t':
+			if last == "" {
+				return nil, fmt.Errorf("line %d: unexpected continuation line", n)
+			}
+			if trimmed == "." {
+				trimmed = ""
+			}
+			fields[last] += "\n" + trimmed
+		default:
+			k, v, ok := strings.Cut(line, ":")
+			if !ok {
+				return nil, fmt.Errorf("line %d: invalid field %q", n, trimmed)
+			}
+			if cur == nil {
+				cur = &AptSource{Options: map[string]string{}, Comments: comments}
+				comments = nil
+			}
+			last = strings.TrimSpace(k)
+			fields[last] = strings.TrimSpace(v)
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	f.Trailer = comments
+	return f, s.Err()
+}
+
+func (s *AptSource) fromFields(fields map[string]string) error {
+	s.Enabled = true
+	for k, v := range fields {
+		switch strings.ToLower(k) {
+		case "types":
+			s.Types = strings.Fields(v)
+		case "uris":
+			s.URIs = strings.Fields(v)
+		case "suites":
+			s.Suites = strings.Fields(v)
+		case "components":
+			s.Components = strings.Fields(v)
+		case "enabled":
+			s.Enabled = strings.ToLower(v) != "no"
+		default:
+			s.Options[k] = v
+		}
+	}
+	if len(s.Types) == 0 || len(s.URIs) == 0 || len(s.Suites) == 0 {
+		return fmt.Errorf("stanza requires Types, URIs and Suites")
+	}
+	return nil
+}
+
+// ReadAptFile reads and parses the apt sources file at path, resolved under
+// the root set by [script.SetRoot].
+func ReadAptFile(path string) (*AptFile, error) {
+	data, err := os.ReadFile(script.Path(path))
+	if err != nil {
+		return nil, err
+	}
+	f, err := ParseApt(data, FormatOf(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	f.Path = path
+	return f, nil
+}
+
+// ReadAptSources parses sources.list and every .list and .sources file in
+// sources.list.d.
+func ReadAptSources() ([]*AptFile, error) {
+	var paths []string
+	if _, err := os.Stat(script.Path(AptSourcesList)); err == nil {
+		paths = append(paths, AptSourcesList)
+	}
+	for _, ext := range []string{"*.list", "*.sources"} {
+		matches, err := filepath.Glob(filepath.Join(script.Path(AptSourcesDir), ext))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			paths = append(paths, filepath.Join(AptSourcesDir, filepath.Base(m)))
+		}
+	}
+	var files []*AptFile
+	for _, p := range paths {
+		f, err := ReadAptFile(p)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// Name returns the name ops uses for the file: the base name without
+// extension, "sources" for /etc/apt/sources.list.
+func (f *AptFile) Name() string {
+	base := filepath.Base(f.Path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// SetEnabled disables the enabled sources of the file, or enables the
+// sources it disabled before. Sources disabled by other means are left
+// alone. It reports whether any source changed.
+func (f *AptFile) SetEnabled(enabled bool) bool {
+	changed := false
+	for _, s := range f.Sources {
+		if enabled == s.Enabled || (enabled && !s.DisabledByOps) {
+			continue
+		}
+		s.Enabled = enabled
+		s.DisabledByOps = !enabled
+		changed = true
+	}
+	return changed
+}
+
+// Bytes renders the file in its format.
+func (f *AptFile) Bytes() []byte {
+	var b bytes.Buffer
+	for i, s := range f.Sources {
+		if f.Format == Deb822 && i > 0 {
+			b.WriteString("\n")
+		}
+		for _, c := range s.Comments {
+			b.WriteString(c + "\n")
+		}
+		if f.Format == Deb822 {
+			s.writeDeb822(&b)
+		} else {
+			s.writeOneLine(&b)
+		}
+	}
+	for _, c := range f.Trailer {
+		b.WriteString(c + "\n")
+	}
+	return b.Bytes()
+}
+
+// Write writes the file back to f.Path.
+func (f *AptFile) Write() error {
+	return script.WriteFileAtomic(f.Path, f.Bytes(), 0644)
+}
+
+func (s *AptSource) optionNames() []string {
+	names := make([]string, 0, len(s.Options))
+	for k := range s.Options {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// oneLineBody renders the source as "deb [options] uri suite components"
+// lines without the disabled prefix.
+func (s *AptSource) oneLineBody() string {
+	var opts []string
+	for _, k := range s.optionNames() {
+		name := strings.ToLower(k)
+		for short, long := range oneLineOptions {
+			if long == k {
+				name = short
+			}
+		}
+		opts = append(opts, name+"="+strings.Join(strings.Fields(s.Options[k]), ","))
+	}
+	var lines []string
+	for _, t := range s.Types {
+		for _, uri := range s.URIs {
+			for _, suite := range s.Suites {
+				line := t + " "
+				if len(opts) > 0 {
+					line += "[" + strings.Join(opts, " ") + "] "
+				}
+				lines = append(lines, line+strings.Join(append([]string{uri, suite}, s.Components...), " "))
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (s *AptSource) writeOneLine(b *bytes.Buffer) {
+	body := s.oneLineBody()
+	if s.line != "" && body == s.canonical {
+		body = s.line
+	}
+	for _, line := range strings.Split(body, "\n") {
+		if !s.Enabled {
+			line = opsDisabled + " " + line
+		}
+		b.WriteString(line + "\n")
+	}
+}
+
+func (s *AptSource) writeDeb822(b *bytes.Buffer) {
+	if s.DisabledByOps && !s.Enabled {
+		b.WriteString(opsDisabled + "\n")
+	}
+	if !s.Enabled {
+		b.WriteString("Enabled: no\n")
+	}
+	b.WriteString("Types: " + strings.Join(s.Types, " ") + "\n")
+	b.WriteString("URIs: " + strings.Join(s.URIs, " ") + "\n")
+	b.WriteString("Suites: " + strings.Join(s.Suites, " ") + "\n")
+	if len(s.Components) > 0 {
+		b.WriteString("Components: " + strings.Join(s.Components, " ") + "\n")
+	}
+	for _, k := range s.optionNames() {
+		// continuation lines of multi-line values (e.g. an embedded Signed-By
+		// key) start with a space, empty lines are written as " ."
+		lines := strings.Split(s.Options[k], "\n")
+		for i := 1; i < len(lines); i++ {
+			if lines[i] == "" {
+				lines[i] = "."
+			}
+			lines[i] = " " + lines[i]
+		}
+		b.WriteString(k + ": " + strings.Join(lines, "\n") + "\n")
+	}
+}
@@ -0,0 +1,181 @@
+package repo
+
+import (
+	"reflect"
+	"testing"
+)
+
+const ubuntuSources = `# See http://help.ubuntu.com/community/UpgradeNotes for how to upgrade to
+# newer versions of the distribution.
+deb http://archive.ubuntu.com/ubuntu/ jammy main restricted
+# deb-src http://archive.ubuntu.com/ubuntu/ jammy main restricted
+
+## Major bug fix updates produced after the final release of the
+## distribution.
+deb  http://archive.ubuntu.com/ubuntu/ jammy-updates main restricted # updates
+deb [arch=amd64 signed-by=/etc/apt/keyrings/docker.gpg] https://download.docker.com/linux/ubuntu jammy stable
+
+`
+
+const deb822Sources = `# local mirror
+Types: deb
+URIs: http://mirrors.example.com/ubuntu/
+Suites: jammy jammy-updates
+Components: main universe
+Signed-By: /usr/share/keyrings/ubuntu-archive-keyring.gpg
+
+Enabled: no
+Types: deb-src
+URIs: http://mirrors.example.com/ubuntu/
+Suites: jammy
+Components: main
+`
+
+func TestParseAptRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		format AptFormat
+	}{
+		{name: "one-line", data: ubuntuSources, format: OneLine},
+		{name: "deb822", data: deb822Sources, format: Deb822},
+		{name: "empty", data: "", format: OneLine},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseApt([]byte(tt.data), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(f.Bytes()); got != tt.data {
+				t.Errorf("Bytes() =\n%s\nwant\n%s", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestParseAptOneLine(t *testing.T) {
+	f, err := ParseApt([]byte(ubuntuSources), OneLine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Sources) != 3 {
+		t.Fatalf("parsed %d sources, want 3", len(f.Sources))
+	}
+	docker := f.Sources[2]
+	want := &AptSource{
+		Types:      []string{"deb"},
+		URIs:       []string{"https://download.docker.com/linux/ubuntu"},
+		Suites:     []string{"jammy"},
+		Components: []string{"stable"},
+		Options:    map[string]string{"Architectures": "amd64", "Signed-By": "/etc/apt/keyrings/docker.gpg"},
+		Enabled:    true,
+	}
+	got := *docker
+	got.Comments, got.line, got.canonical = nil, "", ""
+	if !reflect.DeepEqual(&got, want) {
+		t.Errorf("source = %+v, want %+v", got, want)
+	}
+	if updates := f.Sources[1]; len(updates.Comments) != 4 || updates.Components[1] != "restricted" {
+		t.Errorf("updates source = %+v, want 4 preceding lines and the inline comment dropped", updates)
+	}
+}
+
+func TestAptSetEnabled(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		format AptFormat
+		// disabled 禁用后的内容
+		disabled string
+	}{
+		{
+			name:   "one-line",
+			data:   ubuntuSources,
+			format: OneLine,
+			disabled: `# See http://help.ubuntu.com/community/UpgradeNotes for how to upgrade to
+# newer versions of the distribution.
+# ops-disabled: deb http://archive.ubuntu.com/ubuntu/ jammy main restricted
+# deb-src http://archive.ubuntu.com/ubuntu/ jammy main restricted
+
+## Major bug fix updates produced after the final release of the
+## distribution.
+# ops-disabled: deb  http://archive.ubuntu.com/ubuntu/ jammy-updates main restricted # updates
+# ops-disabled: deb [arch=amd64 signed-by=/etc/apt/keyrings/docker.gpg] https://download.docker.com/linux/ubuntu jammy stable
+
+`,
+		},
+		{
+			name:   "deb822",
+			data:   deb822Sources,
+			format: Deb822,
+			disabled: `# local mirror
+# ops-disabled:
+Enabled: no
+Types: deb
+URIs: http://mirrors.example.com/ubuntu/
+Suites: jammy jammy-updates
+Components: main universe
+Signed-By: /usr/share/keyrings/ubuntu-archive-keyring.gpg
+
+Enabled: no
+Types: deb-src
+URIs: http://mirrors.example.com/ubuntu/
+Suites: jammy
+Components: main
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseApt([]byte(tt.data), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !f.SetEnabled(false) {
+				t.Fatal("SetEnabled(false) changed nothing")
+			}
+			if got := string(f.Bytes()); got != tt.disabled {
+				t.Fatalf("disabled =\n%s\nwant\n%s", got, tt.disabled)
+			}
+			if f.SetEnabled(false) {
+				t.Error("SetEnabled(false) changed a disabled file")
+			}
+
+			// 只启用ops禁用的软件源
+			f, err = ParseApt([]byte(tt.disabled), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !f.SetEnabled(true) {
+				t.Fatal("SetEnabled(true) changed nothing")
+			}
+			if got := string(f.Bytes()); got != tt.data {
+				t.Errorf("enabled again =\n%s\nwant\n%s", got, tt.data)
+			}
+			if f.SetEnabled(true) {
+				t.Error("SetEnabled(true) enabled a source disabled by hand")
+			}
+		})
+	}
+}
+
+func TestCheckName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"docker-ce", true},
+		{"epel_7.local", true},
+		{"", false},
+		{".hidden", false},
+		{"../../etc/cron.d/x", false},
+		{"a/b", false},
+		{"with space", false},
+	}
+	for _, tt := range tests {
+		if err := CheckName(tt.name); (err == nil) != tt.valid {
+			t.Errorf("CheckName(%q) = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
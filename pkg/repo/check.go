@@ -0,0 +1,116 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"stkey/pkg/script"
+	"strings"
+	"time"
+)
+
+// MetadataURLs returns the repomd.xml URL of every baseurl of r, any of them
+// being reachable makes the repo usable. Repos using mirrorlist or metalink
+// return that URL instead.
+func (r *YumRepo) MetadataURLs(vars map[string]string) []string {
+	var urls []string
+	for _, u := range strings.Fields(r.Get("baseurl")) {
+		u = ExpandYumVars(u, vars)
+		urls = append(urls, strings.TrimRight(u, "/")+"/repodata/repomd.xml")
+	}
+	if len(urls) == 0 {
+		for _, k := range []string{"metalink", "mirrorlist"} {
+			if u := r.Get(k); u != "" {
+				urls = append(urls, ExpandYumVars(u, vars))
+			}
+		}
+	}
+	return urls
+}
+
+// MetadataURLs returns, for every URI and suite of s, the alternative
+// InRelease and Release URLs; one of each group must be reachable.
+func (s *AptSource) MetadataURLs() [][]string {
+	var groups [][]string
+	for _, uri := range s.URIs {
+		uri = strings.TrimRight(uri, "/")
+		for _, suite := range s.Suites {
+			if strings.HasSuffix(suite, "/") {
+				// flat repository, the suite is a path relative to the URI and
+				// may have no Release file
+				base := uri + "/" + strings.TrimPrefix(suite, "./")
+				groups = append(groups, []string{base + "InRelease", base + "Release", base + "Packages"})
+				continue
+			}
+			base := uri + "/dists/" + suite + "/"
+			groups = append(groups, []string{base + "InRelease", base + "Release"})
+		}
+	}
+	return groups
+}
+
+// Checker validates repos by fetching their metadata.
+type Checker struct {
+	Client *http.Client
+}
+
+// NewChecker returns a checker with a 15s timeout.
+func NewChecker() *Checker {
+	return &Checker{Client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+// Fetch reports whether url is reachable, file:// URLs are checked locally
+// under the root set by [script.SetRoot].
+func (c *Checker) Fetch(url string) error {
+	if path, ok := strings.CutPrefix(url, "file://"); ok {
+		_, err := os.Stat(script.Path(path))
+		return err
+	}
+	if path, ok := strings.CutPrefix(url, "file:"); ok {
+		_, err := os.Stat(script.Path(path))
+		return err
+	}
+	resp, err := c.Client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: unexpected HTTP response status: %s", url, resp.Status)
+	}
+	return nil
+}
+
+// Any returns nil if one of urls is reachable.
+func (c *Checker) Any(urls []string) error {
+	if len(urls) == 0 {
+		return errors.New("no metadata URL")
+	}
+	var errs []error
+	for _, u := range urls {
+		err := c.Fetch(u)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// CheckYum validates r by fetching repomd.xml from one of its baseurls.
+func (c *Checker) CheckYum(r *YumRepo, vars map[string]string) error {
+	return c.Any(r.MetadataURLs(vars))
+}
+
+// CheckApt validates s by fetching the Release file of every URI and suite.
+func (c *Checker) CheckApt(s *AptSource) error {
+	for _, group := range s.MetadataURLs() {
+		if err := c.Any(group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
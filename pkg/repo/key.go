@@ -0,0 +1,73 @@
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"stkey/pkg/script"
+)
+
+// YumKeysDir is where rpm GPG keys referenced by gpgkey=file:// are stored.
+const YumKeysDir = "/etc/pki/rpm-gpg"
+
+// validName matches the file names apt reads from sources.list.d, which
+// are also safe as yum repo ids and key file names.
+var validName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// CheckName returns an error unless name can be used as a repo and key
+// file name, it must not contain path separators or start with a dot.
+func CheckName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid repo name %q, use letters, digits, _, . and -", name)
+	}
+	return nil
+}
+
+// IsArmored reports whether key is an ASCII-armored OpenPGP key.
+func IsArmored(key []byte) bool {
+	return bytes.Contains(key, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----"))
+}
+
+// AptKeyPath returns the keyring path for the key of the repo name. apt
+// reads ASCII-armored keys only with the .asc extension.
+func AptKeyPath(name string, key []byte) string {
+	ext := ".gpg"
+	if IsArmored(key) {
+		ext = ".asc"
+	}
+	return filepath.Join(AptKeyringsDir, name+ext)
+}
+
+// InstallAptKey writes key to /etc/apt/keyrings, replacing the deprecated
+// apt-key add, and returns the path to use as Signed-By.
+func InstallAptKey(name string, key []byte) (string, error) {
+	if err := os.MkdirAll(script.Path(AptKeyringsDir), 0755); err != nil {
+		return "", err
+	}
+	path := AptKeyPath(name, key)
+	// remove a previous key in the other format
+	for _, ext := range []string{".gpg", ".asc"} {
+		if old := filepath.Join(AptKeyringsDir, name+ext); old != path {
+			_ = os.Remove(script.Path(old))
+		}
+	}
+	return path, script.WriteFileAtomic(path, key, 0644)
+}
+
+// RemoveAptKey removes the keyring of the repo name.
+func RemoveAptKey(name string) {
+	for _, ext := range []string{".gpg", ".asc"} {
+		_ = os.Remove(script.Path(filepath.Join(AptKeyringsDir, name+ext)))
+	}
+}
+
+// InstallYumKey writes key to /etc/pki/rpm-gpg and returns its path.
+func InstallYumKey(name string, key []byte) (string, error) {
+	if err := os.MkdirAll(script.Path(YumKeysDir), 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(YumKeysDir, "RPM-GPG-KEY-"+name)
+	return path, script.WriteFileAtomic(path, key, 0644)
+}
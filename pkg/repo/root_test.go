@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"stkey/pkg/script"
+	"testing"
+)
+
+// withRoot writes files under a temporary root and makes it the script root
+// for the test.
+func withRoot(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, text := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	script.SetRoot(root)
+	t.Cleanup(func() { script.SetRoot("") })
+	return root
+}
+
+func TestReadYumDirRoot(t *testing.T) {
+	root := withRoot(t, map[string]string{
+		"/etc/yum.repos.d/CentOS-Base.repo": centosBase,
+		"/etc/yum/vars/contentdir":          "altarch\n",
+	})
+	files, err := ReadYumDir(YumReposDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != "/etc/yum.repos.d/CentOS-Base.repo" {
+		t.Fatalf("ReadYumDir() = %v, want CentOS-Base.repo by its path on the host", files)
+	}
+	files[0].Remove("updates")
+	if err := files[0].Write(); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := ReadYumFile(files[0].Path); err != nil || f.Repo("updates") != nil {
+		t.Errorf("updates not removed under %s: %v", root, err)
+	}
+	if got := YumVars("7", "aarch64")["contentdir"]; got != "altarch" {
+		t.Errorf("contentdir = %q, want altarch from the vars under the root", got)
+	}
+	if _, err := InstallYumKey("test", []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, YumKeysDir, "RPM-GPG-KEY-test")); err != nil {
+		t.Errorf("key not written under the root: %v", err)
+	}
+}
+
+func TestReadAptSourcesRoot(t *testing.T) {
+	root := withRoot(t, map[string]string{
+		AptSourcesList: ubuntuSources,
+		filepath.Join(AptSourcesDir, "docker.list"): "deb https://download.docker.com/linux/ubuntu jammy stable\n",
+	})
+	files, err := ReadAptSources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	if len(paths) != 2 || paths[0] != AptSourcesList || paths[1] != filepath.Join(AptSourcesDir, "docker.list") {
+		t.Errorf("ReadAptSources() paths = %q, want the host paths", paths)
+	}
+	path, err := InstallAptKey("docker", []byte("binary key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, path)); err != nil {
+		t.Errorf("key not written under the root: %v", err)
+	}
+	RemoveAptKey("docker")
+	if _, err := os.Stat(filepath.Join(root, path)); !os.IsNotExist(err) {
+		t.Errorf("key not removed under the root: %v", err)
+	}
+}
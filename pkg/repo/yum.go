@@ -0,0 +1,263 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"stkey/pkg/script"
+	"strings"
+)
+
+// YumReposDir is where yum and dnf read .repo files from.
+const YumReposDir = "/etc/yum.repos.d"
+
+// Option is a key=value line of a .repo section. Comment and blank lines
+// inside a section are kept as options with an empty Key and the raw line
+// as Value.
+type Option struct {
+	Key   string
+	Value string
+}
+
+// YumRepo is a [section] of a .repo file.
+type YumRepo struct {
+	ID      string
+	Options []Option
+
+	// parsed is set for sections read from a file, which keep their own
+	// blank lines.
+	parsed bool
+}
+
+// Get returns the value of key, or "" if unset.
+func (r *YumRepo) Get(key string) string {
+	for _, o := range r.Options {
+		if o.Key == key {
+			return o.Value
+		}
+	}
+	return ""
+}
+
+// Set sets key to value, adding the option after the last one if it is
+// not present.
+func (r *YumRepo) Set(key, value string) {
+	last := -1
+	for i, o := range r.Options {
+		if o.Key == key {
+			r.Options[i].Value = value
+			return
+		}
+		if o.Key != "" {
+			last = i
+		}
+	}
+	r.Options = append(r.Options[:last+1], append([]Option{{Key: key, Value: value}}, r.Options[last+1:]...)...)
+}
+
+// Unset removes key.
+func (r *YumRepo) Unset(key string) {
+	opts := r.Options[:0]
+	for _, o := range r.Options {
+		if o.Key != key {
+			opts = append(opts, o)
+		}
+	}
+	r.Options = opts
+}
+
+// Enabled reports whether the repo is enabled, yum defaults to enabled=1.
+func (r *YumRepo) Enabled() bool {
+	switch strings.ToLower(r.Get("enabled")) {
+	case "0", "false", "no", "off":
+		return false
+	}
+	return true
+}
+
+// SetEnabled sets enabled=1 or enabled=0.
+func (r *YumRepo) SetEnabled(enabled bool) {
+	if enabled {
+		r.Set("enabled", "1")
+	} else {
+		r.Set("enabled", "0")
+	}
+}
+
+// YumFile is a parsed .repo file.
+type YumFile struct {
+	Path string
+	// Header holds the lines before the first section.
+	Header []string
+	Repos  []*YumRepo
+}
+
+// ParseYum parses the INI content of a .repo file.
+func ParseYum(data []byte) (*YumFile, error) {
+	f := &YumFile{}
+	var cur *YumRepo
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "["):
+			if !strings.HasSuffix(trimmed, "]") {
+				return nil, fmt.Errorf("line %d: invalid section %q", n, trimmed)
+			}
+			cur = &YumRepo{ID: strings.TrimSpace(trimmed[1 : len(trimmed)-1]), parsed: true}
+			f.Repos = append(f.Repos, cur)
+		case trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";"):
+			if cur == nil {
+				f.Header = append(f.Header, line)
+			} else {
+				cur.Options = append(cur.Options, Option{Value: line})
+			}
+		case cur == nil:
+			return nil, fmt.Errorf("line %d: option outside of a section", n)
+		case line[0] == ' ' || line[0] == '\t':
+			// continuation of a multi-line value, e.g. several baseurls
+			if len(cur.Options) == 0 || cur.Options[len(cur.Options)-1].Key == "" {
+				return nil, fmt.Errorf("line %d: unexpected continuation line", n)
+			}
+			cur.Options[len(cur.Options)-1].Value += "\n" + trimmed
+		default:
+			k, v, ok := strings.Cut(trimmed, "=")
+			if !ok {
+				return nil, fmt.Errorf("line %d: invalid option %q", n, trimmed)
+			}
+			cur.Options = append(cur.Options, Option{Key: strings.TrimSpace(k), Value: strings.TrimSpace(v)})
+		}
+	}
+	return f, s.Err()
+}
+
+// ReadYumFile reads and parses the .repo file at path, resolved under the
+// root set by [script.SetRoot].
+func ReadYumFile(path string) (*YumFile, error) {
+	data, err := os.ReadFile(script.Path(path))
+	if err != nil {
+		return nil, err
+	}
+	f, err := ParseYum(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	f.Path = path
+	return f, nil
+}
+
+// Repo returns the repo with the given id, or nil.
+func (f *YumFile) Repo(id string) *YumRepo {
+	for _, r := range f.Repos {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// Remove deletes the repo with the given id and reports whether it existed.
+func (f *YumFile) Remove(id string) bool {
+	for i, r := range f.Repos {
+		if r.ID == id {
+			f.Repos = append(f.Repos[:i], f.Repos[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// endsBlank reports whether the last line of the section is blank.
+func (r *YumRepo) endsBlank() bool {
+	if len(r.Options) == 0 {
+		return false
+	}
+	last := r.Options[len(r.Options)-1]
+	return last.Key == "" && strings.TrimSpace(last.Value) == ""
+}
+
+// Bytes renders the file in .repo INI format.
+func (f *YumFile) Bytes() []byte {
+	var b bytes.Buffer
+	for _, l := range f.Header {
+		b.WriteString(l + "\n")
+	}
+	// added sections are separated by a blank line unless the previous one
+	// ends with a blank line
+	blank := len(f.Header) == 0 || strings.TrimSpace(f.Header[len(f.Header)-1]) == ""
+	for _, r := range f.Repos {
+		if !blank && !r.parsed {
+			b.WriteString("\n")
+		}
+		blank = r.endsBlank()
+		b.WriteString("[" + r.ID + "]\n")
+		for _, o := range r.Options {
+			if o.Key == "" {
+				b.WriteString(o.Value + "\n")
+				continue
+			}
+			b.WriteString(o.Key + "=" + strings.ReplaceAll(o.Value, "\n", "\n\t") + "\n")
+		}
+	}
+	return b.Bytes()
+}
+
+// Write writes the file back to f.Path.
+func (f *YumFile) Write() error {
+	return script.WriteFileAtomic(f.Path, f.Bytes(), 0644)
+}
+
+// ReadYumDir parses every .repo file in dir, sorted by name.
+func ReadYumDir(dir string) ([]*YumFile, error) {
+	paths, err := filepath.Glob(filepath.Join(script.Path(dir), "*.repo"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var files []*YumFile
+	for _, p := range paths {
+		f, err := ReadYumFile(filepath.Join(dir, filepath.Base(p)))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// ExpandYumVars substitutes $var and ${var} in s.
+func ExpandYumVars(s string, vars map[string]string) string {
+	return os.Expand(s, func(k string) string {
+		if v, ok := vars[k]; ok {
+			return v
+		}
+		return "$" + k
+	})
+}
+
+// YumVars returns the yum variables for releasever and basearch, overridden
+// by the files in /etc/yum/vars and /etc/dnf/vars.
+func YumVars(releasever, basearch string) map[string]string {
+	vars := map[string]string{
+		"releasever": releasever,
+		"basearch":   basearch,
+		"arch":       basearch,
+		"contentdir": "centos",
+	}
+	for _, dir := range []string{"/etc/yum/vars", "/etc/dnf/vars"} {
+		entries, _ := os.ReadDir(script.Path(dir))
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			if data, err := os.ReadFile(script.Path(filepath.Join(dir, e.Name()))); err == nil {
+				vars[e.Name()] = strings.TrimSpace(string(data))
+			}
+		}
+	}
+	return vars
+}
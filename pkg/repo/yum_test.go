@@ -0,0 +1,101 @@
+package repo
+
+import "testing"
+
+const centosBase = `# CentOS-Base.repo
+#
+# The mirror system uses the connecting IP address of the client.
+
+[base]
+name=CentOS-$releasever - Base
+mirrorlist=http://mirrorlist.centos.org/?release=$releasever&arch=$basearch&repo=os
+#baseurl=http://mirror.centos.org/centos/$releasever/os/$basearch/
+gpgcheck=1
+gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-CentOS-7
+
+#released updates
+[updates]
+name=CentOS-$releasever - Updates
+baseurl=http://mirror1.example.com/centos/$releasever/updates/$basearch/
+	http://mirror2.example.com/centos/$releasever/updates/$basearch/
+
+gpgcheck=1
+[extras]
+name=CentOS-$releasever - Extras
+`
+
+func TestParseYumRoundTrip(t *testing.T) {
+	for _, data := range []string{centosBase, "", "[a]\nname=a\n"} {
+		f, err := ParseYum([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(f.Bytes()); got != data {
+			t.Errorf("Bytes() =\n%s\nwant\n%s", got, data)
+		}
+	}
+}
+
+func TestParseYum(t *testing.T) {
+	f, err := ParseYum([]byte(centosBase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Header) != 4 || len(f.Repos) != 3 {
+		t.Fatalf("parsed %d header lines and %d repos, want 4 and 3", len(f.Header), len(f.Repos))
+	}
+	base := f.Repo("base")
+	if got := base.Get("baseurl"); got != "" {
+		t.Errorf("commented baseurl parsed as %q", got)
+	}
+	if !base.Enabled() {
+		t.Error("base disabled, yum defaults to enabled=1")
+	}
+	updates := f.Repo("updates")
+	if got, want := updates.Get("baseurl"), "http://mirror1.example.com/centos/$releasever/updates/$basearch/\nhttp://mirror2.example.com/centos/$releasever/updates/$basearch/"; got != want {
+		t.Errorf("baseurl = %q, want %q", got, want)
+	}
+
+	// 新增的选项写在空行和注释之前
+	base.SetEnabled(false)
+	updates.Set("gpgkey", "file:///etc/pki/rpm-gpg/RPM-GPG-KEY-CentOS-7")
+	want := `# CentOS-Base.repo
+#
+# The mirror system uses the connecting IP address of the client.
+
+[base]
+name=CentOS-$releasever - Base
+mirrorlist=http://mirrorlist.centos.org/?release=$releasever&arch=$basearch&repo=os
+#baseurl=http://mirror.centos.org/centos/$releasever/os/$basearch/
+gpgcheck=1
+gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-CentOS-7
+enabled=0
+
+#released updates
+[updates]
+name=CentOS-$releasever - Updates
+baseurl=http://mirror1.example.com/centos/$releasever/updates/$basearch/
+	http://mirror2.example.com/centos/$releasever/updates/$basearch/
+
+gpgcheck=1
+gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-CentOS-7
+[extras]
+name=CentOS-$releasever - Extras
+`
+	if got := string(f.Bytes()); got != want {
+		t.Errorf("Bytes() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseYumErrors(t *testing.T) {
+	for _, data := range []string{
+		"name=outside\n",
+		"[base\nname=x\n",
+		"[base]\n\tcontinued\n",
+		"[base]\nnot an option\n",
+	} {
+		if _, err := ParseYum([]byte(data)); err == nil {
+			t.Errorf("ParseYum(%q) succeeded", data)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package script
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// BackupFunc saves a copy of the file path before it is replaced by
+// [Pipe.WriteFile], [Pipe.AppendFile] or [WriteFileAtomic]. It is only
+// called for existing files, and an error aborts the write.
+type BackupFunc func(path string) error
+
+var (
+	backupMu sync.Mutex
+	backup   BackupFunc
+)
+
+// SetBackup sets the backup hook of pipes created afterwards and of
+// [WriteFileAtomic]. nil, the default, disables backups.
+func SetBackup(f BackupFunc) {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+	backup = f
+}
+
+func defaultBackup() BackupFunc {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+	return backup
+}
+
+// WithBackup sets the backup hook of files subsequently written by the
+// pipe, see [BackupFunc].
+func (p *Pipe) WithBackup(f BackupFunc) *Pipe {
+	p.backup = f
+	return p
+}
+
+// BackupSuffix returns a backup hook copying each file to the same name
+// with suffix appended, e.g. ".ops.bak". Only the first write of a file by
+// the program is backed up, so the copy holds the file as it was before the
+// program touched it.
+func BackupSuffix(suffix string) BackupFunc {
+	var mu sync.Mutex
+	done := map[string]bool{}
+	return func(path string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if done[path] {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := writeAtomic(path+suffix, f, false, 0600, nil, nil); err != nil {
+			return fmt.Errorf("backup %s: %w", path, err)
+		}
+		done[path] = true
+		return nil
+	}
+}
+
+// WriteFileAtomic replaces the file path, resolved under the root set by
+// [SetRoot], with data, see [Pipe.WriteFile]. perm is the mode of a new
+// file.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	_, err := writeAtomic(Path(path), bytes.NewReader(data), false, perm, defaultBackup(), nil)
+	return err
+}
+
+// writeAtomic writes r, after the current contents of name when appending,
+// to a temporary file in the same directory, syncs it and renames it over
+// name, so that readers and crashes see either the old or the new contents.
+// An existing file keeps its mode, owner and extended attributes (e.g. its
+// SELinux label); a symlink is followed and its target replaced. check, if
+// not nil, is called once r is exhausted, and an error it returns, e.g. of
+// a failed filter producing r, aborts the write. It returns the number of
+// bytes copied from r.
+func writeAtomic(name string, r io.Reader, appending bool, perm os.FileMode, backup BackupFunc, check func() error) (n int64, err error) {
+	if target, err := filepath.EvalSymlinks(name); err == nil {
+		name = target
+	}
+	fi, err := os.Stat(name)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	if exists && !fi.Mode().IsRegular() {
+		return 0, fmt.Errorf("%s is not a regular file", name)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if appending && exists {
+		old, err := os.Open(name)
+		if err != nil {
+			return 0, err
+		}
+		_, err = io.Copy(tmp, old)
+		old.Close()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if n, err = io.Copy(tmp, r); err != nil {
+		return 0, err
+	}
+	if check != nil {
+		if err = check(); err != nil {
+			return 0, err
+		}
+	}
+
+	mode := perm
+	if exists {
+		mode = fi.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		return 0, err
+	}
+	if exists {
+		if err = copyOwner(tmp, fi); err != nil {
+			return 0, fmt.Errorf("keep owner of %s: %w", name, err)
+		}
+		if err = copyXattrs(name, tmp.Name()); err != nil {
+			return 0, fmt.Errorf("keep extended attributes of %s: %w", name, err)
+		}
+	}
+	if err = tmp.Sync(); err != nil {
+		return 0, err
+	}
+	if err = tmp.Close(); err != nil {
+		return 0, err
+	}
+	if exists && backup != nil {
+		if err = backup(name); err != nil {
+			return 0, err
+		}
+	}
+	if err = os.Rename(tmp.Name(), name); err != nil {
+		return 0, err
+	}
+	syncDir(filepath.Dir(name))
+	return n, nil
+}
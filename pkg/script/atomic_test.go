@@ -0,0 +1,105 @@
+package script_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"stkey/pkg/script"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "conf")
+	if err := os.WriteFile(path, []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+	var backedUp []string
+	script.SetBackup(func(p string) error {
+		backedUp = append(backedUp, p)
+		return nil
+	})
+	t.Cleanup(func() { script.SetBackup(nil) })
+
+	if err := script.WriteFileAtomic(link, []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "new\n" {
+		t.Errorf("target = %q, want new", b)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("symlink replaced: %v", err)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0600 {
+		t.Errorf("mode = %o, want the 600 of the replaced file", fi.Mode().Perm())
+	}
+	if len(backedUp) != 1 || backedUp[0] != path {
+		t.Errorf("backed up %q, want %s", backedUp, path)
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, ".*")); len(left) != 0 {
+		t.Errorf("temporary files left: %q", left)
+	}
+}
+
+func TestWriteFileFailedFilter(t *testing.T) {
+	dir := t.TempDir()
+	for _, appending := range []bool{false, true} {
+		path := filepath.Join(dir, "conf")
+		if err := os.WriteFile(path, []byte("keep\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fail := errors.New("filter failed")
+		p := script.Echo("line 1\nline 2\n").Filter(func(r io.Reader, w io.Writer) error {
+			// emit part of the input before failing
+			_, _ = io.CopyN(w, r, 4)
+			return fail
+		})
+		var err error
+		if appending {
+			_, err = p.AppendFile(path)
+		} else {
+			_, err = p.WriteFile(path)
+		}
+		if !errors.Is(err, fail) {
+			t.Errorf("appending %v: error = %v, want the filter error", appending, err)
+		}
+		if b, _ := os.ReadFile(path); string(b) != "keep\n" {
+			t.Errorf("appending %v: file = %q, want it unchanged", appending, b)
+		}
+		if left, _ := filepath.Glob(filepath.Join(dir, ".*")); len(left) != 0 {
+			t.Errorf("temporary files left: %q", left)
+		}
+	}
+}
+
+func TestWriteFileNotRegular(t *testing.T) {
+	_, err := script.Echo("x").WriteFile(t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "not a regular file") {
+		t.Errorf("WriteFile() of a directory = %v", err)
+	}
+}
+
+func TestWriteFileAtomicRoot(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	script.SetRoot(root)
+	t.Cleanup(func() { script.SetRoot("") })
+
+	if err := script.WriteFileAtomic("/etc/ops-test.conf", []byte("x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "etc/ops-test.conf")); err != nil || string(b) != "x\n" {
+		t.Errorf("file under root = %q, %v, want x", b, err)
+	}
+	if _, err := os.Stat("/etc/ops-test.conf"); !os.IsNotExist(err) {
+		t.Errorf("/etc/ops-test.conf written outside the root: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package script
+
+import (
+	"errors"
+	"io"
+
+	"bitbucket.org/creachadair/shell"
+)
+
+// Command creates a pipe that runs the program name with the arguments args
+// and produces its combined output, like [Exec] but without parsing a
+// command line: every argument is passed as is, so values coming from files
+// or the network cannot inject further arguments.
+func Command(name string, args ...string) *Pipe {
+	return NewPipe().Command(name, args...)
+}
+
+// CommandAsRoot is [Command] with root privileges, see [Pipe.AsRoot].
+func CommandAsRoot(name string, args ...string) *Pipe {
+	return NewPipe().AsRoot().Command(name, args...)
+}
+
+// Command runs the program name with the arguments args, sending it the
+// contents of the pipe as input. See [Command], and [Pipe.Exec] for error
+// handling details.
+func (p *Pipe) Command(name string, args ...string) *Pipe {
+	argv := append([]string{name}, args...)
+	return p.Filter(func(r io.Reader, w io.Writer) error {
+		if name == "" {
+			return errors.New("empty command name")
+		}
+		return p.execArgs(QuoteArgs(argv...), argv, r, w)
+	})
+}
+
+// RunCommand is [Pipe.Run] for the program name with the arguments args.
+func (p *Pipe) RunCommand(name string, args ...string) (*Result, error) {
+	if p.Error() != nil {
+		return nil, p.Error()
+	}
+	if name == "" {
+		err := errors.New("empty command name")
+		p.SetError(err)
+		return nil, err
+	}
+	argv := append([]string{name}, args...)
+	return p.runArgs(QuoteArgs(argv...), argv)
+}
+
+// Quote returns s quoted for a POSIX shell, for the rare command lines that
+// have to go through sh -c:
+//
+//	Command("/bin/sh", "-c", "command -v "+Quote(name))
+func Quote(s string) string {
+	return shell.Quote(s)
+}
+
+// QuoteArgs quotes each of args and joins them with spaces.
+func QuoteArgs(args ...string) string {
+	return shell.Join(args)
+}
@@ -0,0 +1,115 @@
+package script
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Escalation is the way commands marked with [Pipe.AsRoot] gain root
+// privileges.
+type Escalation string
+
+const (
+	// EscalationNone runs the commands as is, the program runs as root.
+	EscalationNone Escalation = "none"
+	// EscalationSudo prefixes the commands with sudo.
+	EscalationSudo Escalation = "sudo"
+	// EscalationAuto is [EscalationNone] for root and [EscalationSudo]
+	// for other users.
+	EscalationAuto Escalation = "auto"
+)
+
+var (
+	escalationMu sync.Mutex
+	escalation   = EscalationAuto
+)
+
+// ParseEscalation parses the name of an escalation strategy.
+func ParseEscalation(s string) (Escalation, error) {
+	switch e := Escalation(s); e {
+	case EscalationNone, EscalationSudo, EscalationAuto:
+		return e, nil
+	}
+	return "", fmt.Errorf("unknown privilege escalation %q, want none, sudo or auto", s)
+}
+
+// SetEscalation sets the strategy used by pipes run [Pipe.AsRoot].
+func SetEscalation(e Escalation) {
+	escalationMu.Lock()
+	defer escalationMu.Unlock()
+	escalation = e
+}
+
+// currentEscalation resolves [EscalationAuto] for the running user.
+func currentEscalation() Escalation {
+	escalationMu.Lock()
+	e := escalation
+	escalationMu.Unlock()
+	if e != EscalationAuto {
+		return e
+	}
+	if os.Geteuid() == 0 {
+		return EscalationNone
+	}
+	return EscalationSudo
+}
+
+// Credential is the user and groups a command runs as.
+type Credential struct {
+	Uid    uint32
+	Gid    uint32
+	Groups []uint32
+}
+
+// ExecAsRoot creates a pipe that runs cmdLine with root privileges, see
+// [Pipe.AsRoot].
+func ExecAsRoot(cmdLine string) *Pipe {
+	return NewPipe().AsRoot().Exec(cmdLine)
+}
+
+// AsRoot makes commands subsequently run by the pipe gain root privileges
+// using the strategy set by [SetEscalation], so that command lines do not
+// need to embed sudo.
+func (p *Pipe) AsRoot() *Pipe {
+	p.asRoot = true
+	return p
+}
+
+// WithEnv adds environment variables in the form "KEY=value" to those
+// inherited by commands subsequently run by the pipe, e.g.
+//
+//	NewPipe().WithEnv("LC_ALL=C").Exec("chronyc tracking")
+func (p *Pipe) WithEnv(env ...string) *Pipe {
+	p.env = append(p.env, env...)
+	return p
+}
+
+// WithDir sets the working directory of commands subsequently run by the
+// pipe, instead of the working directory of the program.
+func (p *Pipe) WithDir(dir string) *Pipe {
+	p.dir = dir
+	return p
+}
+
+// WithCredential runs commands subsequently run by the pipe as the user uid
+// and group gid, which requires the program to run as root. Not supported
+// on Windows.
+func (p *Pipe) WithCredential(uid, gid uint32, groups ...uint32) *Pipe {
+	p.credential = &Credential{Uid: uid, Gid: gid, Groups: groups}
+	return p
+}
+
+// argv returns args adjusted for the escalation strategy. sudo resets the
+// environment, so the variables of the pipe are passed through env(1).
+func (p *Pipe) argv(args []string) []string {
+	if !p.asRoot || p.credential != nil || currentEscalation() != EscalationSudo {
+		return args
+	}
+	argv := []string{"sudo"}
+	if len(p.env) > 0 {
+		argv = append(argv, "env")
+		argv = append(argv, p.env...)
+	}
+	return append(argv, args...)
+}
@@ -0,0 +1,150 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WaitDelay bounds the time [Pipe.Exec] waits for the output of a killed
+// command, e.g. when a grandchild outside its process group keeps the output
+// open.
+var WaitDelay = 5 * time.Second
+
+// ErrTimeout matches the error of a command killed by [Pipe.WithTimeout] or
+// by the deadline of the pipe's context, see [errors.Is].
+var ErrTimeout = errors.New("command timed out")
+
+// TimeoutError is the error status of a pipe whose command was killed
+// because it ran out of time.
+type TimeoutError struct {
+	Command string
+	// Timeout is the limit set by [Pipe.WithTimeout], zero when the deadline
+	// came from the context.
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Timeout > 0 {
+		return fmt.Sprintf("command [%s] timed out after %s", e.Command, e.Timeout)
+	}
+	return fmt.Sprintf("command [%s] timed out", e.Command)
+}
+
+// Is makes errors.Is(err, ErrTimeout) and
+// errors.Is(err, context.DeadlineExceeded) report true.
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout || target == context.DeadlineExceeded
+}
+
+// IsTimeout reports whether err is the error of a timed out command.
+func IsTimeout(err error) bool {
+	return errors.Is(err, ErrTimeout)
+}
+
+var (
+	defaultCtxMu sync.Mutex
+	defaultCtx   = context.Background()
+	// running counts the commands started and not yet waited for.
+	running atomic.Int64
+)
+
+// SetDefaultContext sets the context of pipes created afterwards, so that
+// cancelling ctx, e.g. on Ctrl-C, kills every command run by the program.
+func SetDefaultContext(ctx context.Context) {
+	defaultCtxMu.Lock()
+	defer defaultCtxMu.Unlock()
+	defaultCtx = ctx
+}
+
+func defaultContext() context.Context {
+	defaultCtxMu.Lock()
+	defer defaultCtxMu.Unlock()
+	return defaultCtx
+}
+
+// WaitCommands waits up to timeout for all running commands to exit, and
+// reports whether they did.
+func WaitCommands(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for running.Load() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+func (p *Pipe) context() context.Context {
+	if p.ctx == nil {
+		return context.Background()
+	}
+	return p.ctx
+}
+
+// commandContext returns the context of a single command, bounded by the
+// pipe's timeout.
+func (p *Pipe) commandContext() (context.Context, context.CancelFunc) {
+	if p.timeout > 0 {
+		return context.WithTimeout(p.context(), p.timeout)
+	}
+	return context.WithCancel(p.context())
+}
+
+// command returns the command run for args, set up with the environment,
+// working directory and privileges of the pipe.
+func (p *Pipe) command(args []string, stdin io.Reader, stdout, stderr io.Writer) *Cmd {
+	return &Cmd{
+		Argv:       p.argv(args),
+		Env:        p.env,
+		Dir:        p.dir,
+		Credential: p.credential,
+		Stdin:      stdin,
+		Stdout:     stdout,
+		Stderr:     stderr,
+	}
+}
+
+// run executes c with the pipe's [Executor], translating a non-zero exit
+// into an [*ExitError] and a done context into a [*TimeoutError] or
+// [context.Canceled]. Start errors are also written to w.
+func (p *Pipe) run(ctx context.Context, c *Cmd, cmdLine string, w io.Writer) (*Result, error) {
+	if ctx.Err() != nil {
+		return &Result{Argv: c.Argv, ExitCode: -1}, p.contextError(ctx, cmdLine)
+	}
+	flush := p.teeLines(c, cmdLine)
+	res, err := p.executor().Execute(ctx, c)
+	flush()
+	if res == nil {
+		res = &Result{Argv: c.Argv, ExitCode: -1}
+	}
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return res, err
+	}
+	if res.Success() {
+		return res, nil
+	}
+	if ctx.Err() != nil {
+		err = p.contextError(ctx, cmdLine)
+		fmt.Fprintln(w, err)
+		return res, err
+	}
+	return res, &ExitError{Result: res}
+}
+
+func (p *Pipe) contextError(ctx context.Context, cmdLine string) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		e := &TimeoutError{Command: cmdLine}
+		if p.ctx == nil || p.ctx.Err() == nil {
+			e.Timeout = p.timeout
+		}
+		return e
+	}
+	return fmt.Errorf("command [%s] canceled: %w", cmdLine, ctx.Err())
+}
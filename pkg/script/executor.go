@@ -0,0 +1,249 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Cmd is a command to be run by an [Executor].
+type Cmd struct {
+	// Argv is the program and its arguments, after privilege escalation.
+	Argv []string
+	// Env holds variables added to the environment of the program.
+	Env        []string
+	Dir        string
+	Credential *Credential
+	Stdin      io.Reader
+	Stdout     io.Writer
+	Stderr     io.Writer
+}
+
+// Executor runs the commands of pipes. Execute returns an error only when
+// the command could not be started; its exit status is reported in the
+// [Result]. The context is done when the command must be killed.
+type Executor interface {
+	Execute(ctx context.Context, c *Cmd) (*Result, error)
+}
+
+var (
+	executorMu sync.Mutex
+	executor   Executor = OSExecutor{}
+)
+
+// SetExecutor sets the executor of pipes created afterwards, e.g. a [Fake]
+// in tests. The default is [OSExecutor].
+func SetExecutor(e Executor) {
+	executorMu.Lock()
+	defer executorMu.Unlock()
+	executor = e
+}
+
+func defaultExecutor() Executor {
+	executorMu.Lock()
+	defer executorMu.Unlock()
+	return executor
+}
+
+// WithExecutor sets the executor of commands subsequently run by the pipe.
+func (p *Pipe) WithExecutor(e Executor) *Pipe {
+	p.exec = e
+	return p
+}
+
+func (p *Pipe) executor() Executor {
+	if p.exec == nil {
+		return OSExecutor{}
+	}
+	return p.exec
+}
+
+// OSExecutor runs commands as child processes. Each command runs in its own
+// process group, which is killed as a whole when the context is done.
+type OSExecutor struct{}
+
+// Execute runs c and waits for it to exit.
+func (OSExecutor) Execute(ctx context.Context, c *Cmd) (*Result, error) {
+	res := &Result{Argv: c.Argv, ExitCode: -1}
+	cmd := exec.CommandContext(ctx, c.Argv[0], c.Argv[1:]...)
+	res.Path = cmd.Path
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	cmd.Dir = c.Dir
+	cmd.Stdin = c.Stdin
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	setProcessGroup(cmd)
+	if c.Credential != nil {
+		if err := setCredential(cmd, c.Credential); err != nil {
+			return res, err
+		}
+	}
+	cmd.WaitDelay = WaitDelay
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return res, err
+	}
+	running.Add(1)
+	_ = cmd.Wait()
+	running.Add(-1)
+	res.Duration = time.Since(start)
+	if cmd.ProcessState != nil {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+		res.Signal = exitSignal(cmd.ProcessState)
+	}
+	return res, nil
+}
+
+// Call is a command recorded by a [Recorder].
+type Call struct {
+	Argv  []string
+	Env   []string
+	Dir   string
+	Stdin string
+}
+
+// String returns the quoted command line of the call.
+func (c Call) String() string {
+	return QuoteArgs(c.Argv...)
+}
+
+// Recorder records the commands it executes, with their standard input,
+// and passes them on to Next. With a nil Next every command succeeds
+// without output, like a dry run.
+type Recorder struct {
+	Next Executor
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// NewRecorder returns a recorder passing commands on to next.
+func NewRecorder(next Executor) *Recorder {
+	return &Recorder{Next: next}
+}
+
+// Execute records c and executes it with r.Next.
+func (r *Recorder) Execute(ctx context.Context, c *Cmd) (*Result, error) {
+	call := Call{
+		Argv: append([]string{}, c.Argv...),
+		Env:  append([]string{}, c.Env...),
+		Dir:  c.Dir,
+	}
+	if c.Stdin != nil {
+		b, err := io.ReadAll(c.Stdin)
+		if err != nil {
+			return &Result{Argv: c.Argv, ExitCode: -1}, err
+		}
+		call.Stdin = string(b)
+		// give the next executor its own copy of the input
+		cc := *c
+		cc.Stdin = bytes.NewReader(b)
+		c = &cc
+	}
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	r.mu.Unlock()
+	if r.Next == nil {
+		return &Result{Argv: c.Argv}, nil
+	}
+	return r.Next.Execute(ctx, c)
+}
+
+// Calls returns the commands recorded so far.
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call{}, r.calls...)
+}
+
+// Reset forgets the recorded commands.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+// FakeRule is a canned response of a [Fake].
+type FakeRule struct {
+	// Pattern is matched against the quoted command line, see [Call.String].
+	Pattern  *regexp.Regexp
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	// Err is returned as a start error, e.g. to simulate a missing program.
+	Err error
+}
+
+// Fake answers commands with the output and exit code of the first rule
+// matching them, without running anything. Commands matching no rule exit
+// with status 127, like a shell for an unknown program.
+type Fake struct {
+	mu    sync.Mutex
+	rules []FakeRule
+}
+
+// NewFake returns a fake without rules.
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+// On adds a rule answering commands matching the regular expression
+// pattern with stdout and exitCode.
+func (f *Fake) On(pattern, stdout string, exitCode int) *Fake {
+	return f.Add(FakeRule{Pattern: regexp.MustCompile(pattern), Stdout: stdout, ExitCode: exitCode})
+}
+
+// Add adds rule after the existing rules.
+func (f *Fake) Add(rule FakeRule) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, rule)
+	return f
+}
+
+// Execute writes the canned output of the first rule matching c.
+func (f *Fake) Execute(ctx context.Context, c *Cmd) (*Result, error) {
+	line := QuoteArgs(c.Argv...)
+	res := &Result{Argv: c.Argv, Path: c.Argv[0]}
+	if c.Stdin != nil {
+		_, _ = io.Copy(io.Discard, c.Stdin)
+	}
+	f.mu.Lock()
+	var rule *FakeRule
+	for i := range f.rules {
+		if f.rules[i].Pattern.MatchString(line) {
+			rule = &f.rules[i]
+			break
+		}
+	}
+	f.mu.Unlock()
+	if rule == nil {
+		res.ExitCode = 127
+		res.Stderr = fmt.Sprintf("fake: no rule for [%s]\n", line)
+		writeTo(c.Stderr, res.Stderr)
+		return res, nil
+	}
+	if rule.Err != nil {
+		res.ExitCode = -1
+		return res, rule.Err
+	}
+	res.ExitCode = rule.ExitCode
+	writeTo(c.Stdout, rule.Stdout)
+	writeTo(c.Stderr, rule.Stderr)
+	return res, nil
+}
+
+func writeTo(w io.Writer, s string) {
+	if w != nil && s != "" {
+		_, _ = io.WriteString(w, s)
+	}
+}
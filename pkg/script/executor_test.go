@@ -0,0 +1,108 @@
+package script_test
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"stkey/pkg/script"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	rec := script.NewRecorder(nil)
+	out, err := script.Echo("input\n").WithExecutor(rec).WithEnv("LC_ALL=C").WithDir("/tmp").
+		Command("grep", "-e", "a b").String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "" {
+		t.Errorf("output = %q, want none from a dry run", out)
+	}
+	script.NewPipe().WithExecutor(rec).Exec("echo 'x y'").Wait()
+
+	want := []script.Call{
+		{Argv: []string{"grep", "-e", "a b"}, Env: []string{"LC_ALL=C"}, Dir: "/tmp", Stdin: "input\n"},
+		{Argv: []string{"echo", "x y"}, Env: []string{}},
+	}
+	if got := rec.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Calls() = %#v, want %#v", got, want)
+	}
+	if got, want := rec.Calls()[0].String(), "grep -e 'a b'"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	rec.Reset()
+	if got := rec.Calls(); len(got) != 0 {
+		t.Errorf("Calls() after Reset = %v, want none", got)
+	}
+}
+
+func TestRecorderPassesInputToNext(t *testing.T) {
+	rec := script.NewRecorder(script.NewFake().On(`^cat$`, "canned\n", 0))
+	out, err := script.Echo("input\n").WithExecutor(rec).Exec("cat").String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "canned\n" {
+		t.Errorf("output = %q, want the fake's output", out)
+	}
+	if got := rec.Calls()[0].Stdin; got != "input\n" {
+		t.Errorf("Stdin = %q, want %q", got, "input\n")
+	}
+}
+
+func TestFake(t *testing.T) {
+	errStart := errors.New("not found")
+	fake := script.NewFake().
+		On(`^systemctl is-active`, "active\n", 0).
+		On(`^systemctl`, "", 3).
+		Add(script.FakeRule{Pattern: regexp.MustCompile(`^missing`), Err: errStart}).
+		Add(script.FakeRule{Pattern: regexp.MustCompile(`^sysctl -p`), Stdout: "a = 1\n", Stderr: "bad\n", ExitCode: 255})
+
+	tests := []struct {
+		cmd    string
+		stdout string
+		stderr string
+		exit   int
+		err    error
+	}{
+		{cmd: "systemctl is-active chronyd", stdout: "active\n"},
+		{cmd: "systemctl restart chronyd", exit: 3},
+		{cmd: "sysctl -p", stdout: "a = 1\n", stderr: "bad\n", exit: 255},
+		{cmd: "missing --flag", exit: -1, err: errStart},
+		{cmd: "unknown", stderr: "fake: no rule for [unknown]\n", exit: 127},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			res, err := script.NewPipe().WithExecutor(fake).Run(tt.cmd)
+			if res.Stdout != tt.stdout || res.Stderr != tt.stderr || res.ExitCode != tt.exit {
+				t.Errorf("Run() = stdout %q stderr %q exit %d, want %q %q %d",
+					res.Stdout, res.Stderr, res.ExitCode, tt.stdout, tt.stderr, tt.exit)
+			}
+			var exitErr *script.ExitError
+			switch {
+			case tt.err != nil:
+				if !errors.Is(err, tt.err) {
+					t.Errorf("error = %v, want %v", err, tt.err)
+				}
+			case tt.exit != 0:
+				if !errors.As(err, &exitErr) || exitErr.ExitCode != tt.exit {
+					t.Errorf("error = %v, want exit status %d", err, tt.exit)
+				}
+			case err != nil:
+				t.Errorf("error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestSetExecutor(t *testing.T) {
+	rec := script.NewRecorder(nil)
+	script.SetExecutor(rec)
+	defer script.SetExecutor(script.OSExecutor{})
+
+	script.CommandAsRoot("rm", "-rf", "/").Wait()
+	calls := rec.Calls()
+	if len(calls) != 1 || calls[0].Argv[len(calls[0].Argv)-1] != "/" {
+		t.Fatalf("Calls() = %v, want the command recorded and not run", calls)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+
+package script
+
+import (
+	"os"
+	"syscall"
+)
+
+// copyOwner gives f the owner and group of the file described by fi.
+func copyOwner(f *os.File, fi os.FileInfo) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return f.Chown(int(st.Uid), int(st.Gid))
+}
+
+// syncDir flushes the directory entries of dir, making a rename durable.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+}
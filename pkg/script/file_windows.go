@@ -0,0 +1,13 @@
+//go:build windows
+
+package script
+
+import "os"
+
+// copyOwner is a no-op on Windows, where files have no uid and gid.
+func copyOwner(f *os.File, fi os.FileInfo) error {
+	return nil
+}
+
+// syncDir is a no-op on Windows, which cannot sync directories.
+func syncDir(dir string) {}
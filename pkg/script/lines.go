@@ -0,0 +1,163 @@
+package script
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Streams of the lines passed to a [LineHandler].
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// Line is a line of output of a command, without its trailing newline.
+type Line struct {
+	// Step is the name set by [Pipe.WithStep] or [SetStep].
+	Step    string
+	Command string
+	// Stream is [StreamStdout] or [StreamStderr]. When standard error is
+	// not routed elsewhere by [Pipe.WithStderr] it still ends up in the
+	// pipe's contents, but its lines are reported as [StreamStderr].
+	Stream string
+	Text   string
+}
+
+// LineHandler receives the output of commands line by line, as they write
+// it. The lines of a command are passed one at a time, in order per stream.
+type LineHandler func(Line)
+
+var (
+	linesMu     sync.Mutex
+	lineHandler LineHandler
+	step        string
+)
+
+// SetLineHandler sets the line handler of pipes created afterwards, e.g.
+// [LogLines] to send the output of every command to the log. nil disables
+// it.
+func SetLineHandler(h LineHandler) {
+	linesMu.Lock()
+	defer linesMu.Unlock()
+	lineHandler = h
+}
+
+// SetStep sets the step name of pipes created afterwards, see
+// [Pipe.WithStep].
+func SetStep(s string) {
+	linesMu.Lock()
+	defer linesMu.Unlock()
+	step = s
+}
+
+func defaultLines() (LineHandler, string) {
+	linesMu.Lock()
+	defer linesMu.Unlock()
+	return lineHandler, step
+}
+
+// WithLineHandler passes each line written by commands subsequently run by
+// the pipe to h, in addition to the pipe's contents. Whether the output is
+// also echoed to the terminal is up to the sink: [Pipe.Stdout] prints it,
+// [Pipe.Wait] does not. Handlers are not called for output discarded by
+// [Pipe.WithStderr](io.Discard).
+func (p *Pipe) WithLineHandler(h LineHandler) *Pipe {
+	p.lineHandler = h
+	return p
+}
+
+// WithLogger logs each line written by commands subsequently run by the
+// pipe to l, see [LogLines] and [Pipe.WithLineHandler].
+func (p *Pipe) WithLogger(l *zap.Logger) *Pipe {
+	return p.WithLineHandler(LogLines(l))
+}
+
+// WithStep names the step of the program running the pipe's commands, which
+// is passed to the line handler, e.g. "kernel" or "docker".
+func (p *Pipe) WithStep(s string) *Pipe {
+	p.step = s
+	return p
+}
+
+// LogLines returns a line handler logging standard output lines at info
+// level and standard error lines at warn level, with the fields step,
+// command and stream.
+func LogLines(l *zap.Logger) LineHandler {
+	return func(line Line) {
+		log := l.Info
+		if line.Stream == StreamStderr {
+			log = l.Warn
+		}
+		log(line.Text,
+			zap.String("step", line.Step),
+			zap.String("command", line.Command),
+			zap.String("stream", line.Stream))
+	}
+}
+
+// teeLines makes c pass its output to the pipe's line handler, and returns
+// a function passing the last unterminated lines once c has exited.
+func (p *Pipe) teeLines(c *Cmd, cmdLine string) func() {
+	if p.lineHandler == nil {
+		return func() {}
+	}
+	mu := &sync.Mutex{}
+	stdout := &lineWriter{w: c.Stdout, mu: mu, emit: p.emitter(cmdLine, StreamStdout)}
+	stderr := &lineWriter{w: c.Stderr, mu: mu, emit: p.emitter(cmdLine, StreamStderr)}
+	if c.Stdout != nil && c.Stdout != io.Discard {
+		c.Stdout = stdout
+	}
+	if c.Stderr != nil && c.Stderr != io.Discard {
+		c.Stderr = stderr
+	}
+	return func() {
+		stdout.flush()
+		stderr.flush()
+	}
+}
+
+func (p *Pipe) emitter(cmdLine, stream string) func(string) {
+	h, s := p.lineHandler, p.step
+	return func(text string) {
+		h(Line{Step: s, Command: cmdLine, Stream: stream, Text: text})
+	}
+}
+
+// lineWriter passes what is written to w, and each complete line to emit.
+// The writers of a command share mu, so that the handler is never called
+// concurrently for the same command.
+type lineWriter struct {
+	w    io.Writer
+	mu   *sync.Mutex
+	emit func(string)
+	buf  []byte
+}
+
+func (lw *lineWriter) Write(b []byte) (int, error) {
+	n, err := lw.w.Write(b)
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	lw.buf = append(lw.buf, b[:n]...)
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		lw.emit(strings.TrimSuffix(string(lw.buf[:i]), "\r"))
+		lw.buf = lw.buf[i+1:]
+	}
+	return n, err
+}
+
+func (lw *lineWriter) flush() {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	if len(lw.buf) > 0 {
+		lw.emit(strings.TrimSuffix(string(lw.buf), "\r"))
+		lw.buf = nil
+	}
+}
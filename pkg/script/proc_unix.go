@@ -0,0 +1,34 @@
+//go:build !windows
+
+package script
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts cmd as the leader of a new process group, and makes
+// the context cancellation kill the whole group, so that the children of a
+// shell or of sudo do not outlive it.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// exitSignal returns the name of the signal that killed the process, "" if
+// it exited normally.
+func exitSignal(state *os.ProcessState) string {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return ws.Signal().String()
+	}
+	return ""
+}
+
+// setCredential makes cmd run as the user and groups of c.
+func setCredential(cmd *exec.Cmd, c *Credential) error {
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: c.Uid, Gid: c.Gid, Groups: c.Groups}
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package script
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op on Windows, where the context cancellation
+// only kills the command itself.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// exitSignal returns "", Windows processes are not killed by signals.
+func exitSignal(state *os.ProcessState) string {
+	return ""
+}
+
+// setCredential fails, Windows has no uid and gid.
+func setCredential(cmd *exec.Cmd, c *Credential) error {
+	return errors.New("running commands as another user is not supported on windows")
+}
@@ -0,0 +1,101 @@
+package script
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"bitbucket.org/creachadair/shell"
+)
+
+// Result is the outcome of a command run by [Pipe.Run].
+type Result struct {
+	// Argv is the command line after splitting, Path the resolved
+	// executable of Argv[0].
+	Argv []string
+	Path string
+	// Stdout and Stderr are the separate outputs of the command.
+	Stdout string
+	Stderr string
+	// ExitCode is -1 when the command did not start or was killed by a
+	// signal, see Signal.
+	ExitCode int
+	// Signal is the name of the signal that killed the command, e.g. "killed".
+	Signal   string
+	Duration time.Duration
+}
+
+// Success reports whether the command exited with status 0.
+func (r *Result) Success() bool {
+	return r.ExitCode == 0
+}
+
+// StderrLines returns the non-empty lines of Stderr.
+func (r *Result) StderrLines() []string {
+	var lines []string
+	for _, line := range strings.Split(r.Stderr, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// ExitError is the error status of a pipe whose command exited with a
+// non-zero status or was killed by a signal. Its message is the same as the
+// one of [exec.ExitError], e.g. "exit status 1" or "signal: killed".
+type ExitError struct {
+	*Result
+}
+
+func (e *ExitError) Error() string {
+	if e.Signal != "" {
+		return "signal: " + e.Signal
+	}
+	return "exit status " + strconv.Itoa(e.ExitCode)
+}
+
+// WithStderr routes the standard error of commands subsequently run by
+// [Pipe.Exec] and [Pipe.ExecForEach] to w, instead of interleaving it with
+// standard output in the pipe's contents.
+func (p *Pipe) WithStderr(w io.Writer) *Pipe {
+	p.stderr = w
+	return p
+}
+
+// Run runs cmdLine as an external command, sending it the contents of the
+// pipe as input, and waits for it to exit. Unlike [Pipe.Exec], the standard
+// output and standard error of the command are returned separately in the
+// [Result], together with its exit code and duration.
+//
+// A non-zero exit status is returned as an [*ExitError], which holds the
+// same result; a command killed by [Pipe.WithTimeout] returns a
+// [*TimeoutError]. The error is also set on the pipe.
+func (p *Pipe) Run(cmdLine string) (*Result, error) {
+	if p.Error() != nil {
+		return nil, p.Error()
+	}
+	args, ok := shell.Split(cmdLine)
+	if !ok || len(args) == 0 {
+		err := fmt.Errorf("unbalanced quotes or backslashes in [%s]", cmdLine)
+		p.SetError(err)
+		return nil, err
+	}
+	return p.runArgs(cmdLine, args)
+}
+
+func (p *Pipe) runArgs(cmdLine string, args []string) (*Result, error) {
+	ctx, cancel := p.commandContext()
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	res, err := p.run(ctx, p.command(args, p.Reader, &stdout, &stderr), cmdLine, io.Discard)
+	res.Stdout = stdout.String()
+	res.Stderr = stderr.String()
+	if err != nil {
+		p.SetError(err)
+	}
+	return res, err
+}
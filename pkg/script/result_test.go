@@ -0,0 +1,81 @@
+package script_test
+
+import (
+	"bytes"
+	"errors"
+	"stkey/pkg/script"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	p := script.Echo("in\n")
+	res, err := p.Run(`sh -c 'cat; echo err >&2; exit 3'`)
+	var exitErr *script.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("Run() error = %v, want an *ExitError", err)
+	}
+	if exitErr.Result != res || err.Error() != "exit status 3" {
+		t.Errorf("ExitError = %q with result %p, want exit status 3 with %p", err, exitErr.Result, res)
+	}
+	if res.Stdout != "in\n" || res.Stderr != "err\n" || res.ExitCode != 3 || res.Success() {
+		t.Errorf("Run() = stdout %q stderr %q exit %d", res.Stdout, res.Stderr, res.ExitCode)
+	}
+	if got := p.ExitStatus(); got != 3 {
+		t.Errorf("ExitStatus() = %d, want 3", got)
+	}
+
+	res, err = script.NewPipe().Run("true")
+	if err != nil || !res.Success() || res.ExitCode != 0 {
+		t.Errorf("Run(true) = %+v, %v", res, err)
+	}
+	if _, err := script.NewPipe().Run(`echo 'unbalanced`); err == nil {
+		t.Error("Run() with unbalanced quotes succeeded")
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	p := script.NewPipe().WithTimeout(50 * time.Millisecond)
+	_, err := p.Run("sleep 5")
+	var timeoutErr *script.TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Errorf("Run() error = %v, want a *TimeoutError", err)
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{err: nil, want: 0},
+		{err: &script.ExitError{Result: &script.Result{ExitCode: 2}}, want: 2},
+		{err: &script.ExitError{Result: &script.Result{ExitCode: -1, Signal: "killed"}}, want: -1},
+		// the text of an error alone is not an exit status
+		{err: errors.New("wrapped: exit status 5"), want: 0},
+	}
+	for _, tt := range tests {
+		p := script.NewPipe()
+		p.SetError(tt.err)
+		if got := p.ExitStatus(); got != tt.want {
+			t.Errorf("ExitStatus() with %v = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWithStderr(t *testing.T) {
+	var stderr bytes.Buffer
+	out, err := script.NewPipe().WithStderr(&stderr).Exec(`sh -c 'echo out; echo err >&2'`).String()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "out\n" || stderr.String() != "err\n" {
+		t.Errorf("stdout %q stderr %q, want them separated", out, stderr.String())
+	}
+
+	out, _ = script.NewPipe().Exec(`sh -c 'echo out; echo err >&2'`).String()
+	if !strings.Contains(out, "out\n") || !strings.Contains(out, "err\n") {
+		t.Errorf("output = %q, want stderr interleaved without WithStderr", out)
+	}
+}
@@ -0,0 +1,33 @@
+package script
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+var (
+	rootMu sync.Mutex
+	root   string
+)
+
+// SetRoot makes [File], [IfExists], [Pipe.WriteFile] and [Pipe.AppendFile]
+// resolve absolute paths under dir, so that code editing /etc can be run
+// against a scratch directory. An empty dir restores the real filesystem.
+// Commands are not affected.
+func SetRoot(dir string) {
+	rootMu.Lock()
+	defer rootMu.Unlock()
+	root = dir
+}
+
+// Path returns name resolved under the root set by [SetRoot]. Relative names
+// are returned as is.
+func Path(name string) string {
+	rootMu.Lock()
+	r := root
+	rootMu.Unlock()
+	if r == "" || !filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(r, name)
+}
@@ -3,13 +3,14 @@ package script
 import (
 	"bufio"
 	"container/ring"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -17,6 +18,7 @@ import (
 	"strings"
 	"sync"
 	"text/template"
+	"time"
 
 	"bitbucket.org/creachadair/shell"
 )
@@ -24,9 +26,20 @@ import (
 // Pipe represents a pipe object with an associated [ReadAutoCloser].
 type Pipe struct {
 	// Reader is the underlying reader.
-	Reader     ReadAutoCloser
-	stdout     io.Writer
-	httpClient *http.Client
+	Reader      ReadAutoCloser
+	stdout      io.Writer
+	stderr      io.Writer
+	httpClient  *http.Client
+	ctx         context.Context
+	timeout     time.Duration
+	env         []string
+	dir         string
+	credential  *Credential
+	asRoot      bool
+	exec        Executor
+	lineHandler LineHandler
+	step        string
+	backup      BackupFunc
 
 	// because pipe stages are concurrent, protect 'err'
 	mu  *sync.Mutex
@@ -67,7 +80,7 @@ func Exec(cmdLine string) *Pipe {
 // File creates a pipe that reads from the file path.
 func File(path string) *Pipe {
 	p := NewPipe()
-	f, err := os.Open(path)
+	f, err := os.Open(Path(path))
 	if err != nil {
 		return p.WithError(err)
 	}
@@ -120,7 +133,7 @@ func Get(URL string) *Pipe {
 //	IfExists("/foo/bar").Exec("/usr/bin/something")
 func IfExists(path string) *Pipe {
 	p := NewPipe()
-	_, err := os.Stat(path)
+	_, err := os.Stat(Path(path))
 	if err != nil {
 		return p.WithError(err)
 	}
@@ -164,13 +177,18 @@ func ListFiles(path string) *Pipe {
 // NewPipe creates a new pipe with an empty reader (use [Pipe.WithReader] to
 // attach another reader to it).
 func NewPipe() *Pipe {
-	return &Pipe{
+	p := &Pipe{
 		Reader:     ReadAutoCloser{},
 		mu:         &sync.Mutex{},
 		err:        nil,
 		stdout:     os.Stdout,
 		httpClient: http.DefaultClient,
+		ctx:        defaultContext(),
+		exec:       defaultExecutor(),
+		backup:     defaultBackup(),
 	}
+	p.lineHandler, p.step = defaultLines()
+	return p
 }
 
 // Post creates a pipe that makes an HTTP POST request to URL, with an empty
@@ -192,13 +210,11 @@ func Stdin() *Pipe {
 
 // AppendFile appends the contents of the pipe to the file path, creating it if
 // necessary, and returns the number of bytes successfully written, or an
-// error.
+// error. Like [Pipe.WriteFile], it replaces the file atomically.
 func (p *Pipe) AppendFile(path string) (int64, error) {
-	return p.writeOrAppendFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY)
+	return p.writeOrAppendFile(path, true)
 }
 
-var exitStatusPattern = regexp.MustCompile(`exit status (\d+)$`)
-
 // Basename reads paths from the pipe, one per line, and removes any leading
 // directory components from each. So, for example, /usr/local/bin/foo would
 // become just foo. This is the complementary operation to [Pipe.Dirname].
@@ -312,7 +328,7 @@ func (p *Pipe) Dirname() *Pipe {
 // status is anything other than HTTP 200-299, the pipe's error status is set.
 func (p *Pipe) Do(req *http.Request) *Pipe {
 	return p.Filter(func(r io.Reader, w io.Writer) error {
-		resp, err := p.httpClient.Do(req)
+		resp, err := p.httpClient.Do(req.WithContext(p.context()))
 		if err != nil {
 			return err
 		}
@@ -378,25 +394,28 @@ func (p *Pipe) Error() error {
 // because [Pipe.String] is a no-op if the pipe's error status is set, if you
 // want output you will need to reset the error status before calling
 // [Pipe.String].
+//
+// If the command is killed because it exceeded the limit set by
+// [Pipe.WithTimeout], the error status is a [*TimeoutError]; if the pipe's
+// context was cancelled, it wraps [context.Canceled].
 func (p *Pipe) Exec(cmdLine string) *Pipe {
 	return p.Filter(func(r io.Reader, w io.Writer) error {
 		args, ok := shell.Split(cmdLine) // strings.Fields doesn't handle quotes
-		if !ok {
+		if !ok || len(args) == 0 {
 			return fmt.Errorf("unbalanced quotes or backslashes in [%s]", cmdLine)
 		}
-		cmd := exec.Command(args[0], args[1:]...)
-		cmd.Stdin = r
-		cmd.Stdout = w
-		cmd.Stderr = w
-		err := cmd.Start()
-		if err != nil {
-			fmt.Fprintln(w, err)
-			return err
-		}
-		return cmd.Wait()
+		return p.execArgs(cmdLine, args, r, w)
 	})
 }
 
+// execArgs runs args reading from r and writing the combined output to w.
+func (p *Pipe) execArgs(cmdLine string, args []string, r io.Reader, w io.Writer) error {
+	ctx, cancel := p.commandContext()
+	defer cancel()
+	_, err := p.run(ctx, p.command(args, r, w, p.stderrWriter(w)), cmdLine, w)
+	return err
+}
+
 // ExecForEach renders cmdLine as a Go template for each line of input, running
 // the resulting command, and produces the combined output of all these
 // commands in sequence. See [Pipe.Exec] for error handling details.
@@ -423,15 +442,12 @@ func (p *Pipe) ExecForEach(cmdLine string) *Pipe {
 			if !ok {
 				return fmt.Errorf("unbalanced quotes or backslashes in [%s]", cmdLine.String())
 			}
-			cmd := exec.Command(args[0], args[1:]...)
-			cmd.Stdout = w
-			cmd.Stderr = w
-			err = cmd.Start()
-			if err != nil {
-				fmt.Fprintln(w, err)
-				continue
+			ctx, cancel := p.commandContext()
+			_, err = p.run(ctx, p.command(args, nil, w, p.stderrWriter(w)), cmdLine.String(), w)
+			cancel()
+			if errors.Is(err, ErrTimeout) || errors.Is(err, context.Canceled) {
+				return err
 			}
-			err = cmd.Wait()
 			if err != nil {
 				fmt.Fprintln(w, err)
 				continue
@@ -443,21 +459,22 @@ func (p *Pipe) ExecForEach(cmdLine string) *Pipe {
 
 // ExitStatus returns the integer exit status of a previous command (for
 // example run by [Pipe.Exec]). This will be zero unless the pipe's error
-// status is set and the error matches the pattern “exit status %d”.
+// status is an [*ExitError]. It is -1 for a command killed by a signal.
 func (p *Pipe) ExitStatus() int {
-	if p.Error() == nil {
-		return 0
-	}
-	match := exitStatusPattern.FindStringSubmatch(p.Error().Error())
-	if len(match) < 2 {
-		return 0
+	var exitErr *ExitError
+	if errors.As(p.Error(), &exitErr) {
+		return exitErr.ExitCode
 	}
-	status, err := strconv.Atoi(match[1])
-	if err != nil {
-		// This seems unlikely, but...
-		return 0
+	return 0
+}
+
+// stderrWriter returns where commands write their standard error: the writer
+// set by [Pipe.WithStderr], or the pipe's output w.
+func (p *Pipe) stderrWriter(w io.Writer) io.Writer {
+	if p.stderr != nil {
+		return p.stderr
 	}
-	return status
+	return w
 }
 
 // Filter sends the contents of the pipe to the function filter and produces
@@ -812,6 +829,22 @@ func (p *Pipe) WithError(err error) *Pipe {
 	return p
 }
 
+// WithContext sets the context of the pipe: when ctx is done, commands
+// subsequently run by the pipe are killed together with their child
+// processes, and HTTP requests are aborted.
+func (p *Pipe) WithContext(ctx context.Context) *Pipe {
+	p.ctx = ctx
+	return p
+}
+
+// WithTimeout limits the run time of each command subsequently run by the
+// pipe to d. A command running longer is killed, and the pipe's error status
+// is set to a [*TimeoutError]. Zero means no limit.
+func (p *Pipe) WithTimeout(d time.Duration) *Pipe {
+	p.timeout = d
+	return p
+}
+
 // WithHTTPClient sets the HTTP client c for use with subsequent requests via
 // [Pipe.Do], [Pipe.HttpGet], or [Pipe.HttpPost]. For example, to make a request using
 // a client with a timeout:
@@ -838,23 +871,25 @@ func (p *Pipe) WithStdout(w io.Writer) *Pipe {
 	return p
 }
 
-// WriteFile writes the pipe's contents to the file path, truncating it if it
+// WriteFile writes the pipe's contents to the file path, replacing it if it
 // exists, and returns the number of bytes successfully written, or an error.
+//
+// The contents are written to a temporary file which is then renamed over
+// path, so that a crash never leaves a half-written file, and the pipe may
+// read from path itself. An existing file keeps its mode, owner and extended
+// attributes, and is first passed to the backup hook, see [Pipe.WithBackup];
+// a new file gets mode 0644.
 func (p *Pipe) WriteFile(path string) (int64, error) {
-	return p.writeOrAppendFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC)
+	return p.writeOrAppendFile(path, false)
 }
 
-func (p *Pipe) writeOrAppendFile(path string, mode int) (int64, error) {
+func (p *Pipe) writeOrAppendFile(path string, appending bool) (int64, error) {
 	if p.Error() != nil {
 		return 0, p.Error()
 	}
-	out, err := os.OpenFile(path, mode, 0666)
-	if err != nil {
-		p.SetError(err)
-		return 0, err
-	}
-	defer out.Close()
-	wrote, err := io.Copy(out, p)
+	// a failed filter reports its error once its output is read, which must
+	// not replace the file
+	wrote, err := writeAtomic(Path(path), p, appending, 0644, p.backup, p.Error)
 	if err != nil {
 		p.SetError(err)
 		return 0, err
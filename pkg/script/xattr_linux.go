@@ -0,0 +1,53 @@
+package script
+
+import (
+	"bytes"
+	"errors"
+	"syscall"
+)
+
+// copyXattrs copies the extended attributes of src, including its SELinux
+// label, to dst. Filesystems without extended attributes are skipped.
+func copyXattrs(src, dst string) error {
+	names, err := xattr(func(b []byte) (int, error) { return syscall.Listxattr(src, b) })
+	if errors.Is(err, syscall.ENOTSUP) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, name := range bytes.Split(bytes.TrimSuffix(names, []byte{0}), []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		attr := string(name)
+		value, err := xattr(func(b []byte) (int, error) { return syscall.Getxattr(src, attr, b) })
+		if err != nil {
+			return err
+		}
+		if err := syscall.Setxattr(dst, attr, value, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// xattr calls get with a buffer of the size it reports for a nil buffer,
+// retrying if the value grew in between.
+func xattr(get func([]byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := get(nil)
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		b := make([]byte, size)
+		n, err := get(b)
+		if errors.Is(err, syscall.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package script
+
+// copyXattrs is a no-op outside Linux.
+func copyXattrs(src, dst string) error {
+	return nil
+}
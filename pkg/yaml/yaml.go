@@ -0,0 +1,254 @@
+// Package yaml encodes Go values as YAML. It only covers what ops outputs:
+// structs (using their json tags), maps with string keys, slices and scalars.
+package yaml
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Marshal returns the YAML encoding of v.
+func Marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := encode(&b, reflect.ValueOf(v), 0, false); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+func fields(t reflect.Type) []field {
+	var fs []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		// like encoding/json, the exported fields of embedded unexported
+		// structs are promoted
+		if !f.IsExported() && !(f.Anonymous && indirectType(f.Type).Kind() == reflect.Struct) {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && indirectType(f.Type).Kind() == reflect.Struct {
+			for _, sub := range fields(indirectType(f.Type)) {
+				sub.index = append([]int{i}, sub.index...)
+				fs = append(fs, sub)
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fs = append(fs, field{name: name, index: []int{i}, omitEmpty: strings.Contains(opts, "omitempty")})
+	}
+	return fs
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+// isScalar reports whether v is written on the line of its key.
+func isScalar(v reflect.Value) bool {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	if _, ok := v.Interface().(time.Time); ok {
+		return true
+	}
+	if _, ok := v.Interface().(encoding.TextMarshaler); ok {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		return false
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return v.Len() == 0
+	}
+	return true
+}
+
+func encode(b *bytes.Buffer, v reflect.Value, indent int, inList bool) error {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			b.WriteString("null\n")
+			return nil
+		}
+		v = v.Elem()
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		b.WriteString(t.Format(time.RFC3339) + "\n")
+		return nil
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		if err != nil {
+			return err
+		}
+		b.WriteString(quote(string(text)) + "\n")
+		return nil
+	}
+	pad := strings.Repeat("  ", indent)
+	// the first key of a mapping inside a list goes on the "- " line
+	first := inList
+	writeKey := func(key string) {
+		if first {
+			first = false
+		} else {
+			b.WriteString(pad)
+		}
+		b.WriteString(quote(key) + ":")
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		fs := fields(v.Type())
+		if len(fs) == 0 {
+			b.WriteString("{}\n")
+			return nil
+		}
+		for _, f := range fs {
+			fv, err := v.FieldByIndexErr(f.index)
+			if err != nil || (f.omitEmpty && isEmpty(fv)) {
+				continue
+			}
+			writeKey(f.name)
+			if err := encodeValue(b, fv, indent); err != nil {
+				return err
+			}
+		}
+		if first {
+			b.WriteString("{}\n")
+		}
+	case reflect.Map:
+		if v.Len() == 0 {
+			b.WriteString("{}\n")
+			return nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("yaml: unsupported map key type %s", v.Type().Key())
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			writeKey(k.String())
+			if err := encodeValue(b, v.MapIndex(k), indent); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			b.WriteString("[]\n")
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 || !inList {
+				b.WriteString(pad)
+			}
+			b.WriteString("- ")
+			item := v.Index(i)
+			if isScalar(item) {
+				if err := encode(b, item, indent+1, false); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := encode(b, item, indent+1, true); err != nil {
+				return err
+			}
+		}
+	default:
+		b.WriteString(scalar(v) + "\n")
+	}
+	return nil
+}
+
+// encodeValue writes the value of a mapping key, on the same line for
+// scalars and indented on the following lines otherwise.
+func encodeValue(b *bytes.Buffer, v reflect.Value, indent int) error {
+	if isScalar(v) {
+		b.WriteString(" ")
+		return encode(b, v, indent+1, false)
+	}
+	b.WriteString("\n")
+	inner := v
+	for inner.Kind() == reflect.Pointer || inner.Kind() == reflect.Interface {
+		inner = inner.Elem()
+	}
+	if inner.Kind() == reflect.Slice || inner.Kind() == reflect.Array {
+		// block sequences are not indented under their key
+		return encode(b, v, indent, false)
+	}
+	return encode(b, v, indent+1, false)
+}
+
+func scalar(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case reflect.String:
+		return quote(v.String())
+	}
+	return quote(fmt.Sprint(v.Interface()))
+}
+
+// quote returns s, double quoted when it would otherwise be read back as
+// something other than the same string.
+func quote(s string) string {
+	if s == "" {
+		return `""`
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~", "y", "n":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	// YAML 1.1 reads 12:30 or 00:11:22:33:44:55 as sexagesimal numbers
+	if strings.Trim(s, "0123456789:._") == "" {
+		return strconv.Quote(s)
+	}
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@` \t") ||
+		strings.ContainsAny(s, "\n\r\t\\\"") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") ||
+		strings.HasSuffix(s, ":") || strings.HasSuffix(s, " ") {
+		return strconv.Quote(s)
+	}
+	return s
+}
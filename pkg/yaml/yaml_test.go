@@ -0,0 +1,150 @@
+package yaml
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+type base struct {
+	ID string `json:"id"`
+}
+
+type nic struct {
+	Name  string   `json:"name"`
+	Addrs []string `json:"addrs"`
+}
+
+type host struct {
+	base
+	Hostname string `json:"hostname"`
+	Cloud    string `json:"cloud,omitempty"`
+	Skipped  string `json:"-"`
+	NoTag    int    // 没有json标签时使用字段名
+	OS       struct {
+		Name string `json:"name"`
+	} `json:"os"`
+	NICs   []nic             `json:"nics"`
+	Labels map[string]string `json:"labels"`
+	Empty  []string          `json:"empty"`
+	Parent *host             `json:"parent"`
+	IP     net.IP            `json:"ip"`
+	Booted time.Time         `json:"booted"`
+}
+
+func TestMarshal(t *testing.T) {
+	h := &host{
+		base:     base{ID: "42"},
+		Hostname: "web1",
+		Skipped:  "secret",
+		NoTag:    3,
+		NICs: []nic{
+			{Name: "eth0", Addrs: []string{"10.0.0.5/24", "fe80::1/64"}},
+			{Name: "lo"},
+		},
+		Labels: map[string]string{"role": "web", "env": "prod"},
+		Empty:  []string{},
+		IP:     net.ParseIP("10.0.0.5"),
+		Booted: time.Date(2023, 10, 11, 4, 53, 20, 0, time.UTC),
+	}
+	h.OS.Name = "CentOS Linux"
+	want := `id: "42"
+hostname: web1
+NoTag: 3
+os:
+  name: CentOS Linux
+nics:
+- name: eth0
+  addrs:
+  - 10.0.0.5/24
+  - fe80::1/64
+- name: lo
+  addrs: []
+labels:
+  env: prod
+  role: web
+empty: []
+parent: null
+ip: "10.0.0.5"
+booted: 2023-10-11T04:53:20Z
+`
+	b, err := Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != want {
+		t.Errorf("Marshal() =\n%s\nwant\n%s", b, want)
+	}
+}
+
+func TestMarshalScalars(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{"", `""`},
+		{"plain text", "plain text"},
+		{"true", `"true"`},
+		{"No", `"No"`},
+		{"null", `"null"`},
+		{"1.10", `"1.10"`},
+		{"1e3", `"1e3"`},
+		{"12:30", `"12:30"`},
+		{"00:11:22:33:44:55", `"00:11:22:33:44:55"`},
+		{"- item", `"- item"`},
+		{"key: value", `"key: value"`},
+		{"a #comment", `"a #comment"`},
+		{"trailing:", `"trailing:"`},
+		{" leading", `" leading"`},
+		{"two\nlines", `"two\nlines"`},
+		{`back\slash`, `"back\\slash"`},
+		{"@home", `"@home"`},
+		{"http://example.com/a#b", "http://example.com/a#b"},
+		{true, "true"},
+		{-7, "-7"},
+		{uint64(1) << 63, "9223372036854775808"},
+		{0.5, "0.5"},
+		{[]int{}, "[]"},
+		{map[string]int{}, "{}"},
+		{struct{}{}, "{}"},
+		{(*host)(nil), "null"},
+	}
+	for _, tt := range tests {
+		b, err := Marshal(tt.v)
+		if err != nil {
+			t.Errorf("Marshal(%#v) error: %v", tt.v, err)
+			continue
+		}
+		if got := string(b); got != tt.want+"\n" {
+			t.Errorf("Marshal(%#v) = %q, want %q", tt.v, got, tt.want+"\n")
+		}
+	}
+}
+
+func TestMarshalNested(t *testing.T) {
+	v := map[string]interface{}{
+		"matrix": [][]int{{1, 2}, {}},
+		"list":   []map[string]int{{"a": 1, "b": 2}},
+	}
+	want := `list:
+- a: 1
+  b: 2
+matrix:
+- - 1
+  - 2
+- []
+`
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != want {
+		t.Errorf("Marshal() =\n%s\nwant\n%s", b, want)
+	}
+}
+
+func TestMarshalUnsupportedKey(t *testing.T) {
+	if _, err := Marshal(map[int]string{1: "a"}); err == nil {
+		t.Error("Marshal() of a map with int keys succeeded")
+	}
+}
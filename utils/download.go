@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"stkey/pkg/script"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Downloader 支持超时、指数退避重试、断点续传及SHA-256校验的下载器
+type Downloader struct {
+	Client *http.Client
+	// Timeout 单次请求的超时时间
+	Timeout time.Duration
+	// Retries 失败后的重试次数
+	Retries int
+	// Backoff 首次重试前的等待时间，之后每次翻倍，最多MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Progress 下载进度回调，total未知时为-1
+	Progress func(url string, done, total int64)
+	// ProgressInterval 两次进度回调的最小间隔
+	ProgressInterval time.Duration
+}
+
+// NewDownloader 返回默认配置的下载器
+func NewDownloader() *Downloader {
+	return &Downloader{
+		Client:           http.DefaultClient,
+		Timeout:          10 * time.Minute,
+		Retries:          3,
+		Backoff:          time.Second,
+		MaxBackoff:       30 * time.Second,
+		ProgressInterval: 2 * time.Second,
+	}
+}
+
+// permanentError 不需要重试的错误，如HTTP 404
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Download 下载url到filePath。数据先写入filePath.tmp，已存在的.tmp会通过HTTP Range续传；
+// sum不为空时校验SHA-256，校验通过后才重命名为filePath。.tmp不跟随符号链接，
+// 且只续传当前用户的文件。路径与PathExists一样按script.SetRoot设置的根目录解析
+func (d *Downloader) Download(filePath string, url string, sum string) error {
+	tmp := filePath + ".tmp"
+	backoff := d.Backoff
+	var err error
+	for attempt := 0; attempt <= d.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+			if d.MaxBackoff > 0 && backoff > d.MaxBackoff {
+				backoff = d.MaxBackoff
+			}
+		}
+		resumed := PathExists(tmp)
+		if err = d.fetch(tmp, url, sum); err == nil {
+			err = verifySHA256(tmp, sum)
+			if err == nil {
+				return os.Rename(script.Path(tmp), script.Path(filePath))
+			}
+			// 续传的内容可能已损坏，删除后从头下载；完整下载仍不匹配则不再重试
+			_ = os.Remove(script.Path(tmp))
+			if !resumed {
+				err = &permanentError{err}
+			}
+		}
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			_ = os.Remove(script.Path(tmp))
+			break
+		}
+	}
+	// 网络错误时保留.tmp，下次下载时续传
+	return fmt.Errorf("download %s: %w", url, err)
+}
+
+func (d *Downloader) fetch(tmp string, url string, sum string) error {
+	name := script.Path(tmp)
+	var offset int64
+	if fi, err := os.Lstat(name); err == nil {
+		if fi.Mode().IsRegular() {
+			offset = fi.Size()
+		} else {
+			// 不是普通文件(如符号链接)，不续传
+			_ = os.Remove(name)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return &permanentError{err}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	client := *d.Client
+	client.Timeout = d.Timeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flag := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			_ = os.Remove(name)
+			return fmt.Errorf("unexpected Content-Range %q", resp.Header.Get("Content-Range"))
+		}
+		flag |= os.O_APPEND
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// .tmp不短于远端文件，只有SHA-256校验通过时才视为完整，否则可能是其他下载残留的文件，删除后从头下载
+		if sum != "" && verifySHA256(tmp, sum) == nil {
+			return nil
+		}
+		_ = os.Remove(name)
+		resp.Body.Close()
+		return d.fetch(tmp, url, sum)
+	case resp.StatusCode/100 == 2:
+		// 从头下载时重新创建.tmp，不写入已存在的文件
+		offset = 0
+		_ = os.Remove(name)
+		flag |= os.O_EXCL
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5:
+		return fmt.Errorf("unexpected HTTP response status: %s", resp.Status)
+	default:
+		return &permanentError{fmt.Errorf("unexpected HTTP response status: %s", resp.Status)}
+	}
+
+	out, err := openPartial(name, flag)
+	if err != nil {
+		return &permanentError{err}
+	}
+	defer out.Close()
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	var w io.Writer = out
+	if d.Progress != nil {
+		w = &progressWriter{w: out, d: d, url: url, done: offset, total: total}
+	}
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return fmt.Errorf("short read: got %d of %d bytes", n, resp.ContentLength)
+	}
+	if d.Progress != nil {
+		d.Progress(url, offset+n, total)
+	}
+	return out.Sync()
+}
+
+func verifySHA256(path, sum string) error {
+	if sum == "" {
+		return nil
+	}
+	actual, err := SHA256File(path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actual, sum) {
+		return fmt.Errorf("sha256 mismatch: got %s, want %s", actual, sum)
+	}
+	return nil
+}
+
+type progressWriter struct {
+	w     io.Writer
+	d     *Downloader
+	url   string
+	done  int64
+	total int64
+	last  time.Time
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.done += int64(n)
+	if time.Since(p.last) >= p.d.ProgressInterval {
+		p.last = time.Now()
+		p.d.Progress(p.url, p.done, p.total)
+	}
+	return n, err
+}
@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"stkey/pkg/script"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var payload = bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+func sum(b []byte) string {
+	s := sha256.Sum256(b)
+	return hex.EncodeToString(s[:])
+}
+
+// fileServer 以http.ServeContent提供payload(支持Range)，前failures次请求返回503，并记录请求的Range头
+type fileServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	failures int
+	ranges   []string
+}
+
+func newFileServer(t *testing.T, failures int) *fileServer {
+	s := &fileServer{failures: failures}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+		fail := len(s.ranges) <= s.failures
+		s.mu.Unlock()
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		if fail {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "payload", time.Time{}, bytes.NewReader(payload))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fileServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.ranges...)
+}
+
+func testDownloader() *Downloader {
+	d := NewDownloader()
+	d.Backoff = time.Millisecond
+	d.Timeout = 10 * time.Second
+	return d
+}
+
+func TestDownload(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		failures int
+		// partial 下载前已存在的.tmp内容
+		partial []byte
+		sum     string
+		wantErr bool
+		// ranges 每次请求的Range头
+		ranges []string
+	}{
+		{name: "complete", sum: sum(payload), ranges: []string{""}},
+		{name: "without checksum", ranges: []string{""}},
+		{name: "retry after 503", failures: 2, sum: sum(payload), ranges: []string{"", "", ""}},
+		{name: "give up after retries", failures: 10, sum: sum(payload), wantErr: true, ranges: []string{"", "", "", ""}},
+		{name: "not found is not retried", path: "/missing", wantErr: true, ranges: []string{""}},
+		{
+			name:    "resume",
+			partial: payload[:1000],
+			sum:     sum(payload),
+			ranges:  []string{"bytes=1000-"},
+		},
+		{
+			name:    "resume complete partial",
+			partial: payload,
+			sum:     sum(payload),
+			ranges:  []string{"bytes=65536-"},
+		},
+		{
+			name:    "corrupt partial is downloaded again",
+			partial: []byte("garbage"),
+			sum:     sum(payload),
+			ranges:  []string{"bytes=7-", ""},
+		},
+		{
+			name:    "complete partial without checksum is downloaded again",
+			partial: append([]byte("stale"), payload[5:]...),
+			ranges:  []string{"bytes=65536-", ""},
+		},
+		{
+			name:    "oversized partial is downloaded again",
+			partial: append(append([]byte{}, payload...), "garbage"...),
+			sum:     sum(payload),
+			ranges:  []string{"bytes=65543-", ""},
+		},
+		{name: "checksum mismatch is not retried", sum: sum([]byte("other")), wantErr: true, ranges: []string{""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFileServer(t, tt.failures)
+			dst := filepath.Join(t.TempDir(), "file")
+			if tt.partial != nil {
+				if err := os.WriteFile(dst+".tmp", tt.partial, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			path := tt.path
+			if path == "" {
+				path = "/file"
+			}
+			err := testDownloader().Download(dst, srv.URL+path, tt.sum)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Download() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := srv.requests(); strings.Join(got, ",") != strings.Join(tt.ranges, ",") {
+				t.Errorf("Range headers %q, want %q", got, tt.ranges)
+			}
+			b, readErr := os.ReadFile(dst)
+			if tt.wantErr {
+				if readErr == nil {
+					t.Errorf("%s written despite the error", dst)
+				}
+				return
+			}
+			if !bytes.Equal(b, payload) {
+				t.Errorf("downloaded %d bytes, want the %d bytes of the payload", len(b), len(payload))
+			}
+			if _, err := os.Stat(dst + ".tmp"); !os.IsNotExist(err) {
+				t.Errorf(".tmp left after download: %v", err)
+			}
+		})
+	}
+}
+
+func TestDownloadKeepsPartialOnNetworkError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		_, _ = w.Write([]byte("0123456789"))
+	}))
+	defer srv.Close()
+	dst := filepath.Join(t.TempDir(), "file")
+	d := testDownloader()
+	d.Retries = 0
+	if err := d.Download(dst, srv.URL, ""); err == nil {
+		t.Fatal("Download() of a truncated response succeeded")
+	}
+	b, err := os.ReadFile(dst + ".tmp")
+	if err != nil || string(b) != "0123456789" {
+		t.Errorf(".tmp = %q, %v, want the partial content kept for resuming", b, err)
+	}
+}
+
+func TestDownloadDoesNotFollowSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+	srv := newFileServer(t, 0)
+	dir := t.TempDir()
+	victim := filepath.Join(dir, "victim")
+	if err := os.WriteFile(victim, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "file")
+	if err := os.Symlink(victim, dst+".tmp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := testDownloader().Download(dst, srv.URL+"/file", sum(payload)); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(victim); string(b) != "keep" {
+		t.Errorf("symlink target overwritten: %q", b)
+	}
+	if got := srv.requests(); len(got) != 1 || got[0] != "" {
+		t.Errorf("Range headers %q, want a full download instead of resuming through the symlink", got)
+	}
+}
+
+func TestDownloadUnderRoot(t *testing.T) {
+	srv := newFileServer(t, 0)
+	root := t.TempDir()
+	script.SetRoot(root)
+	t.Cleanup(func() { script.SetRoot("") })
+	// 根目录下残留的.tmp应被续传
+	if err := os.WriteFile(filepath.Join(root, "file.tmp"), payload[:1000], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := testDownloader().Download("/file", srv.URL+"/file", sum(payload)); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "file")); err != nil || !bytes.Equal(b, payload) {
+		t.Errorf("file under the root = %d bytes, %v", len(b), err)
+	}
+	if got := srv.requests(); len(got) != 1 || got[0] != "bytes=1000-" {
+		t.Errorf("Range headers %q, want the .tmp under the root resumed", got)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// openPartial 打开下载中的.tmp文件，不跟随符号链接，并拒绝写入其他用户的文件，
+// 避免在可写目录中被预先放置的符号链接或文件劫持
+func openPartial(name string, flag int) (*os.File, error) {
+	f, err := os.OpenFile(name, flag|syscall.O_NOFOLLOW, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Geteuid() {
+		f.Close()
+		return nil, fmt.Errorf("%s is owned by uid %d, not the current user", name, st.Uid)
+	}
+	return f, nil
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package utils
+
+import "os"
+
+// openPartial 打开下载中的.tmp文件
+func openPartial(name string, flag int) (*os.File, error) {
+	return os.OpenFile(name, flag, 0644)
+}
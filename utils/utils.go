@@ -1,12 +1,16 @@
 package utils
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
 	"crypto/md5"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"stkey/pkg/script"
 	"strings"
 )
@@ -18,14 +22,14 @@ func ContainsI(a string, b string) bool {
 	)
 }
 
+// Replace 替换文件中的字符串，原子写入并保留文件的权限、属主及SELinux标签
 func Replace(path, from, to string) error {
-	pipe := script.File(path)
-	file, err := pipe.Replace(from, to).String()
+	_, err := script.File(path).Replace(from, to).WriteFile(path)
 	if err != nil {
 		fmt.Println(path, err)
 		return fmt.Errorf("error writing file %s: %w", path, err)
 	}
-	return os.WriteFile(path, []byte(file), 0644)
+	return nil
 }
 
 func AppendFileIf(path, search, source string) error {
@@ -42,7 +46,7 @@ func AppendFileIf(path, search, source string) error {
 
 // TryCommand 嘗試執行指令，如果成功則返回true。兼容centos6.X
 func TryCommand(command string) bool {
-	p, _ := script.Exec("\"/bin/bash\"" + " \"-c\" " + "\"command -v \"" + command).String()
+	p, _ := script.Command("/bin/bash", "-c", "command -v "+script.Quote(command)).String()
 	if len(p) == 0 {
 		return false
 	} else {
@@ -53,7 +57,7 @@ func TryCommand(command string) bool {
 func MustMakeDir(path string) error {
 	_, err := script.IfExists(path).Echo("").Stdout()
 	if err != nil {
-		script.Exec("sudo mkdir -p " + path)
+		script.CommandAsRoot("mkdir", "-p", "--", path)
 		//os.MkdirAll(path, 755)
 		return nil
 	} else {
@@ -62,7 +66,7 @@ func MustMakeDir(path string) error {
 }
 
 func pathExists(path string) (bool, error) {
-	_, err := os.Stat(path)
+	_, err := os.Stat(script.Path(path))
 	if err == nil {
 		return true, nil
 	}
@@ -90,28 +94,72 @@ func HttpGet(url string) string {
 
 // DownloadFile 下載文件
 func DownloadFile(filePath string, url string) error {
-	// 創建臨時檔案
-	out, err := os.Create(filePath + ".tmp")
-	if err != nil {
-		return err
-	}
-	defer out.Close()
+	return NewDownloader().Download(filePath, url, "")
+}
 
-	// 下載文件
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
+// ExtractFile 从tar.gz/tgz/tar/zip压缩包中解压名为member的文件到dst
+func ExtractFile(archive, format, member, dst string) error {
+	var r io.ReadCloser
+	switch format {
+	case "zip":
+		zr, err := zip.OpenReader(script.Path(archive))
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if path.Clean(f.Name) == path.Clean(member) && !f.FileInfo().IsDir() {
+				if r, err = f.Open(); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	case "tar.gz", "tgz", "tar":
+		f, err := os.Open(script.Path(archive))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		var in io.Reader = f
+		if format != "tar" {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				return err
+			}
+			defer gz.Close()
+			in = gz
+		}
+		tr := tar.NewReader(in)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if path.Clean(h.Name) == path.Clean(member) && h.Typeflag == tar.TypeReg {
+				r = io.NopCloser(tr)
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
 	}
-	defer resp.Body.Close()
-	if _, err = io.Copy(out, resp.Body); err != nil {
-		return err
+	if r == nil {
+		return fmt.Errorf("%s not found in %s", member, archive)
 	}
+	defer r.Close()
 
-	// 重命名臨時檔案
-	if err = os.Rename(filePath+".tmp", filePath); err != nil {
-		return err
-	}
-	return nil
+	// 原子替换，避免覆盖正在运行的程序或留下不完整的文件
+	_, err := script.NewPipe().WithReader(r).WriteFile(dst)
+	return err
+}
+
+// SHA256File 计算文件的SHA-256值
+func SHA256File(filepath string) (string, error) {
+	return script.File(filepath).SHA256Sum()
 }
 
 // MD5File 计算文件的MD5值